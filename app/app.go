@@ -8,16 +8,48 @@ import (
 
 	"github.com/solher/snakepit-seed/constants"
 	"github.com/solher/snakepit-seed/database"
+	"github.com/solher/snakepit-seed/errs"
 	"github.com/solher/snakepit-seed/handlers"
+	"github.com/solher/snakepit-seed/interactors"
 	"github.com/solher/snakepit-seed/middlewares"
+	"github.com/solher/snakepit-seed/notifiers"
+	"github.com/solher/snakepit-seed/repositories"
+	"github.com/solher/snakepit-seed/stores"
+	"github.com/solher/snakepit-seed/utils"
+	"github.com/solher/snakepit-seed/workers"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/ansel1/merry"
 	"github.com/pressly/chi"
 	"github.com/solher/snakepit"
 	"github.com/spf13/viper"
 )
 
-func Builder(v *viper.Viper, l *logrus.Logger) (http.Handler, error) {
+type (
+	// Option customizes the app built by New.
+	Option func(*options)
+
+	options struct {
+		notifier notifiers.Notifier
+	}
+)
+
+// WithNotifier delivers the reset and verification tokens with the given notifier,
+// instead of the logger one.
+func WithNotifier(n notifiers.Notifier) Option {
+	return func(o *options) {
+		o.notifier = n
+	}
+}
+
+// New builds the app handler and starts its background workers, the returned function
+// stopping them.
+func New(v *viper.Viper, l *logrus.Logger, opts ...Option) (http.Handler, func(), error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	v.Set(
 		constants.DBURL,
 		strings.Replace(v.GetString(constants.DBURL), "tcp://", "http://", -1),
@@ -27,29 +59,109 @@ func Builder(v *viper.Viper, l *logrus.Logger) (http.Handler, error) {
 		strings.Replace(v.GetString(constants.AuthServerURL), "tcp://", "http://", -1),
 	)
 
-	distantSeed := database.NewEmptyProdSeed()
-
-	db := snakepit.NewArangoDBManager(
-		database.NewProdSeed(),
-		distantSeed,
-	).
-		LoggerOptions(false, false, false).
-		Connect(
-		v.GetString(constants.DBURL),
-		v.GetString(constants.DBName),
-		v.GetString(constants.DBUserName),
-		v.GetString(constants.DBUserPassword),
+	adminEmail, adminPassword, generated, err := database.AdminCredentials(v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seed, err := database.NewProdSeed(adminEmail, adminPassword, generated)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		db    *snakepit.ArangoDBManager
+		mem   *stores.Memory
+		sqlDB *stores.SQL
 	)
 
-	if err := db.LoadDistantSeed(); err != nil {
-		return nil, err
+	switch v.GetString(constants.DBBackend) {
+	case constants.DBBackendMemory:
+		mem = stores.NewMemory(v.GetDuration(constants.SessionsTTL))
+
+		if _, err := mem.Users.Insert(seed.Users); err != nil {
+			return nil, nil, err
+		}
+
+		if generated {
+			l.WithFields(logrus.Fields{
+				"email":    adminEmail,
+				"password": adminPassword,
+			}).Warn("Bootstrap admin created with a one-time password.")
+		}
+	case constants.DBBackendSQL:
+		// The local sessions are only stored in ArangoDB or in memory.
+		if v.GetString(constants.SessionsBackend) == constants.SessionsBackendLocal {
+			return nil, nil, merry.New("the local sessions backend is not supported by the sql database backend")
+		}
+
+		sqlDB, err = stores.NewSQL(v.GetString(constants.DBSQLDriver), v.GetString(constants.DBSQLDSN))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := checkSeeds(l, database.NewSQLManager(sqlDB, seed)); err != nil {
+			return nil, nil, err
+		}
+	default:
+		db = snakepit.NewArangoDBManager(
+			seed,
+			database.NewEmptyProdSeed(),
+		).
+			LoggerOptions(false, false, false).
+			Connect(
+				v.GetString(constants.DBURL),
+				v.GetString(constants.DBName),
+				v.GetString(constants.DBUserName),
+				v.GetString(constants.DBUserPassword),
+			)
+
+		if err := checkSeeds(l, database.NewManager(db, seed)); err != nil {
+			return nil, nil, err
+		}
+
+		// The seeds being in sync, the local one holds the distant constants.
+		seed.PopulateConstants(v)
+	}
+
+	notifier := o.notifier
+	if notifier == nil {
+		notifier = notifiers.NewLogger(l, v.GetBool(constants.LogTokens))
+
+		if v.GetBool(constants.LogTokens) {
+			l.Warn("The reset and verification tokens are written to the debug logs. This must only happen in development.")
+		}
+	}
+
+	trusted, err := utils.ParseTrustedProxies(v.GetStringSlice(constants.TrustedProxies))
+	if err != nil {
+		return nil, nil, err
 	}
 
-	distantSeed.PopulateConstants(v)
+	var verifier middlewares.SignatureVerifier
+	if !v.GetBool(constants.JWTEnabled) && v.GetString(constants.SessionsBackend) != constants.SessionsBackendLocal {
+		var err error
+		verifier, err = middlewares.NewSignatureVerifier(
+			v.GetString(constants.AuthHeadersSignature),
+			v.GetString(constants.AuthHeadersSecret),
+			v.GetString(constants.AuthHeadersPublicKey),
+		)
+		// Without any key, the development setups accepting unsigned headers run without verifier
+		// and refuse the signed ones. Any other configuration error is fatal.
+		unkeyed := v.GetString(constants.AuthHeadersSecret) == "" && v.GetString(constants.AuthHeadersPublicKey) == ""
+		switch {
+		case err == nil:
+		case unkeyed && v.GetBool(constants.AuthHeadersAllowUnsigned):
+			l.WithField("error", err).Warn("No auth server signature verifier configured. Only unsigned headers are accepted.")
+		default:
+			return nil, nil, err
+		}
+	}
 
 	router := chi.NewRouter()
 	json := snakepit.NewJSON()
 	cli := gentleman.New()
+	failures := stores.NewMemoryFailures(v.GetDuration(constants.LockoutResetAfter))
 
 	timer := snakepit.NewTimer("Middleware stack")
 
@@ -58,13 +170,169 @@ func Builder(v *viper.Viper, l *logrus.Logger) (http.Handler, error) {
 		v.GetString(constants.SwaggerScheme),
 	))
 	router.Use(snakepit.NewRequestID())
+	router.Use(middlewares.NewClientIP(trusted))
 	router.Use(snakepit.NewLogger(l))
 	router.Use(timer.Start)
 	router.Use(snakepit.NewRecoverer(json))
-	router.Use(middlewares.NewContext())
+	switch {
+	case v.GetBool(constants.JWTEnabled):
+		jwks, err := middlewares.NewJWKS(
+			v.GetString(constants.JWTJWKSFile),
+			v.GetString(constants.JWTJWKSURL),
+			v.GetDuration(constants.JWTJWKSRefresh),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		router.Use(middlewares.NewJWTContext(json, &middlewares.JWTOptions{
+			Keys:     jwks,
+			Issuer:   v.GetString(constants.JWTIssuer),
+			Audience: v.GetString(constants.JWTAudience),
+			Leeway:   v.GetDuration(constants.JWTLeeway),
+			Claims: middlewares.JWTClaimNames{
+				Key:        v.GetString(constants.JWTClaimKey),
+				Email:      v.GetString(constants.JWTClaimEmail),
+				FirstName:  v.GetString(constants.JWTClaimFirstName),
+				LastName:   v.GetString(constants.JWTClaimLastName),
+				Role:       v.GetString(constants.JWTClaimRole),
+				OwnerToken: v.GetString(constants.JWTClaimOwnerToken),
+			},
+		}))
+	case v.GetString(constants.SessionsBackend) == constants.SessionsBackendLocal:
+		router.Use(middlewares.NewLocalContext(func(l *logrus.Entry) middlewares.SessionFinder {
+			if mem != nil {
+				return mem.Sessions
+			}
+			repo := repositories.NewRepository(v, l, json, db, cli)
+			return interactors.NewLocalSessions(v, l, repo)
+		}))
+	default:
+		if v.GetBool(constants.AuthHeadersAllowUnsigned) {
+			l.Warn("Unsigned auth server headers are accepted. This must only happen in development.")
+		}
+
+		router.Use(middlewares.NewContext(
+			json,
+			verifier,
+			v.GetBool(constants.AuthHeadersAllowUnsigned),
+			v.GetDuration(constants.AuthHeadersMaxAge),
+		))
+	}
 	router.Use(timer.End)
 
-	router.Mount("/users", handlers.NewUsers(v, json, db, cli))
+	router.Mount("/users", handlers.NewUsers(v, json, db, mem, sqlDB, cli, notifier, failures))
+	router.Mount("/audit", handlers.NewAudit(v, json, db, mem, sqlDB, cli))
+
+	stops := []func(){}
+
+	if interval := v.GetDuration(constants.SessionsRevocationInterval); interval > 0 {
+		revocations := workers.NewSessionRevocations(l, interval, func(l *logrus.Entry) workers.PendingRetrier {
+			return newSessionRevocations(v, l, repositories.NewRepository(v, l, json, db, cli), mem, sqlDB)
+		})
+		revocations.Start()
+		stops = append(stops, revocations.Stop)
+	}
+
+	if interval := v.GetDuration(constants.UsersPurgeInterval); interval > 0 {
+		purge := workers.NewUsersPurge(l, interval, func(l *logrus.Entry) workers.UsersPurger {
+			repo := repositories.NewRepository(v, l, json, db, cli)
+
+			var (
+				usersStore  interactors.UsersStore
+				tokensStore interactors.TokensStore
+				auditStore  interactors.AuditStore
+			)
+
+			switch {
+			case mem != nil:
+				usersStore = mem.Users
+				tokensStore = mem.Tokens
+				auditStore = mem.Audit
+			case sqlDB != nil:
+				usersStore = sqlDB.Users
+				tokensStore = sqlDB.Tokens
+				auditStore = sqlDB.Audit
+			default:
+				usersStore = repositories.NewUsers(repo)
+				tokensStore = repositories.NewTokens(repo)
+				auditStore = repositories.NewAudit(repo)
+			}
+
+			revocations := newSessionRevocations(v, l, repo, mem, sqlDB)
+			audit := interactors.NewAudit(v, l, auditStore, nil)
+
+			return interactors.NewUsersPurge(v, l, usersStore, tokensStore, revocations, audit)
+		})
+		purge.Start()
+		stops = append(stops, purge.Stop)
+	}
+
+	stop := func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+
+	return router, stop, nil
+}
+
+// newSessionRevocations returns the session revocations interactor of the background workers,
+// for the configured database and sessions backends.
+func newSessionRevocations(
+	v *viper.Viper,
+	l *logrus.Entry,
+	repo *repositories.Repository,
+	mem *stores.Memory,
+	sqlDB *stores.SQL,
+) *interactors.SessionRevocations {
+	var sessionsInter interactors.SessionsCascader
+	switch {
+	case v.GetString(constants.SessionsBackend) != constants.SessionsBackendLocal:
+		sessionsInter = interactors.NewSessions(v, l, repo)
+	case mem != nil:
+		sessionsInter = mem.Sessions
+	default:
+		sessionsInter = interactors.NewLocalSessions(v, l, repo)
+	}
+
+	var store interactors.SessionRevocationsStore
+	switch {
+	case mem != nil:
+		store = mem.Revocations
+	case sqlDB != nil:
+		store = sqlDB.Revocations
+	default:
+		store = repositories.NewSessionRevocations(repo)
+	}
+
+	return interactors.NewSessionRevocations(v, l, store, sessionsInter)
+}
+
+// seedsDiffer compares the local seed with a database, like the db seed command does.
+type seedsDiffer interface {
+	DiffSeeds() ([]database.SeedChange, error)
+}
+
+// checkSeeds refuses to start when the database diverges from the local seed, logging each
+// divergence. The seeds are synced with the db seed command.
+func checkSeeds(l *logrus.Logger, d seedsDiffer) error {
+	changes, err := d.DiffSeeds()
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		l.WithFields(logrus.Fields{
+			"collection": change.Collection,
+			"key":        change.Key,
+			"fields":     change.Fields,
+		}).Errorf("Seed divergence: document %s.", change.Kind)
+	}
+
+	if len(changes) > 0 {
+		return merry.Here(errs.SeedsNotSync)
+	}
 
-	return router, nil
+	return nil
 }
@@ -0,0 +1,317 @@
+// Package apptest builds the app for integration tests. The users are stored in memory
+// or in a SQLite database, and the sessions by an in-process fake auth server, whose signed
+// headers are forged by the callers of each role.
+package apptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/app"
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/database"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/stores"
+)
+
+// App is a running test app, backed by its own fake auth server.
+type App struct {
+	*httptest.Server
+	AuthServer *AuthServer
+	Config     *viper.Viper
+	t          testing.TB
+	mailbox    *mailbox
+	mutex      sync.Mutex
+	users      int
+	tempDir    string
+	stop       func()
+}
+
+// New builds and starts the app with the given config, NewConfig being used when nil.
+// The app must be closed at the end of the test.
+func New(t testing.TB, v *viper.Viper) *App {
+	if v == nil {
+		v = NewConfig()
+	}
+
+	auth := NewAuthServer(v.GetDuration(constants.SessionsTTL))
+	v.Set(constants.AuthServerURL, auth.URL)
+
+	mailbox := newMailbox()
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	l.Hooks.Add(mailbox)
+
+	tempDir, err := prepareSQL(v)
+	if err != nil {
+		auth.Close()
+		t.Fatalf("Could not prepare the SQL database: %v", err)
+	}
+
+	handler, stop, err := app.New(v, l, app.WithNotifier(mailbox))
+	if err != nil {
+		auth.Close()
+		os.RemoveAll(tempDir)
+		t.Fatalf("Could not build the app: %v", err)
+	}
+
+	return &App{
+		Server:     httptest.NewServer(handler),
+		AuthServer: auth,
+		Config:     v,
+		t:          t,
+		mailbox:    mailbox,
+		tempDir:    tempDir,
+		stop:       stop,
+	}
+}
+
+func (a *App) Close() {
+	a.Server.Close()
+	a.stop()
+	a.AuthServer.Close()
+
+	if a.tempDir != "" {
+		os.RemoveAll(a.tempDir)
+	}
+}
+
+// prepareSQL creates the schema and the seeds of the SQL database of the config, the app refusing
+// to start without them. A temporary SQLite database is used when the DSN is empty, its directory
+// being returned to be removed once the app is closed.
+func prepareSQL(v *viper.Viper) (string, error) {
+	if v.GetString(constants.DBBackend) != constants.DBBackendSQL {
+		return "", nil
+	}
+
+	tempDir := ""
+
+	if v.GetString(constants.DBSQLDSN) == "" && v.GetString(constants.DBSQLDriver) == stores.SQLDriverSQLite {
+		dir, err := ioutil.TempDir("", "apptest")
+		if err != nil {
+			return "", err
+		}
+		tempDir = dir
+		v.Set(constants.DBSQLDSN, filepath.Join(dir, "users.db"))
+	}
+
+	db, err := stores.NewSQL(v.GetString(constants.DBSQLDriver), v.GetString(constants.DBSQLDSN))
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return "", err
+	}
+	defer db.Close()
+
+	email, password, generated, err := database.AdminCredentials(v)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return "", err
+	}
+
+	seed, err := database.NewProdSeed(email, password, generated)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return "", err
+	}
+
+	manager := database.NewSQLManager(db, seed)
+
+	if _, err := manager.MigrateTo(0, false); err != nil {
+		os.RemoveAll(tempDir)
+		return "", err
+	}
+
+	if _, err := manager.SyncSeeds(false); err != nil {
+		os.RemoveAll(tempDir)
+		return "", err
+	}
+
+	return tempDir, nil
+}
+
+// Anonymous returns a caller sending no auth server headers.
+func (a *App) Anonymous() *Caller {
+	return &Caller{app: a}
+}
+
+// Admin signs in as the bootstrap admin.
+func (a *App) Admin() *Caller {
+	return a.Signin(AdminEmail, AdminPassword)
+}
+
+// NewUser signs up a user with a new email and Password, then signs it in.
+func (a *App) NewUser() *Caller {
+	a.mutex.Lock()
+	a.users++
+	email := fmt.Sprintf("user%d@localhost", a.users)
+	a.mutex.Unlock()
+
+	user := &models.User{Email: email, Password: Password}
+
+	if res := a.Anonymous().Do("POST", "/users/signup", user, nil); res.StatusCode != http.StatusCreated {
+		a.t.Fatalf("Could not sign up %s: unexpected status %d.", email, res.StatusCode)
+	}
+
+	return a.Signin(email, Password)
+}
+
+// Signin signs in with the given credentials and returns a caller forging the headers
+// the auth server would send along the requests of the created session. With the local
+// sessions backend, the caller sends the session token as bearer token instead.
+func (a *App) Signin(email, password string) *Caller {
+	cred := &models.Credentials{Email: email, Password: password}
+	created := &models.Session{}
+
+	if res := a.Anonymous().Do("POST", "/users/signin", cred, created); res.StatusCode != http.StatusCreated {
+		a.t.Fatalf("Could not sign in %s: unexpected status %d.", email, res.StatusCode)
+	}
+
+	if a.Config.GetString(constants.SessionsBackend) == constants.SessionsBackendLocal {
+		caller := &Caller{app: a, Session: created, bearer: true}
+
+		user := &models.User{}
+		if res := caller.Do("GET", "/users/me", nil, user); res.StatusCode != http.StatusOK {
+			a.t.Fatalf("Could not find the user of %s: unexpected status %d.", email, res.StatusCode)
+		}
+		caller.User = user
+
+		return caller
+	}
+
+	session, ok := a.AuthServer.Session(created.Token)
+	if !ok {
+		a.t.Fatalf("Could not find the session of %s in the auth server.", email)
+	}
+
+	payload := &models.AuthServerPayload{}
+	if err := json.Unmarshal([]byte(session.Payload), payload); err != nil {
+		a.t.Fatalf("Could not unmarshal the session payload of %s: %v", email, err)
+	}
+
+	return &Caller{
+		app:     a,
+		User:    payload.User,
+		Role:    payload.Role,
+		Session: session,
+	}
+}
+
+// ResetToken returns the last password reset token sent to the email.
+func (a *App) ResetToken(email string) string {
+	return a.mailbox.token("resetToken", email)
+}
+
+// VerificationToken returns the last email verification token sent to the email.
+func (a *App) VerificationToken(email string) string {
+	return a.mailbox.token("verificationToken", email)
+}
+
+// BootstrapPassword returns the one-time password generated for the bootstrap admin
+// when the config sets none.
+func (a *App) BootstrapPassword() string {
+	return a.mailbox.token("password", a.Config.GetString(constants.AdminEmail))
+}
+
+// Caller sends requests to the app on behalf of a user, along the signed headers of one
+// of its sessions. The anonymous caller has no user and sends no headers.
+type Caller struct {
+	app     *App
+	User    *models.User
+	Role    models.Role
+	Session *models.Session
+	bearer  bool
+	extra   http.Header
+}
+
+// WithRole returns a copy of the caller whose headers carry the given role,
+// as if the auth server had granted it.
+func (c *Caller) WithRole(role models.Role) *Caller {
+	caller := *c
+	caller.Role = role
+	return &caller
+}
+
+// WithHeader returns a copy of the caller also sending the given header.
+func (c *Caller) WithHeader(key, value string) *Caller {
+	caller := *c
+	caller.extra = http.Header{}
+	for k, values := range c.extra {
+		caller.extra[k] = values
+	}
+	caller.extra.Set(key, value)
+	return &caller
+}
+
+// Header returns the auth server headers of the caller, signed with the configured secret,
+// or its bearer token with the local sessions backend.
+func (c *Caller) Header() http.Header {
+	if c.Session == nil {
+		return http.Header{}
+	}
+
+	if c.bearer {
+		return http.Header{"Authorization": []string{"Bearer " + c.Session.Token}}
+	}
+
+	return Headers(c.app.Config.GetString(constants.AuthHeadersSecret), c.User, c.Role, c.Session)
+}
+
+// Do sends the request to the app, with the body encoded in JSON when not nil.
+// The response body is decoded in out when not nil, and closed in any case.
+func (c *Caller) Do(method, path string, body, out interface{}) *http.Response {
+	var reader io.Reader
+	if body != nil {
+		m, err := json.Marshal(body)
+		if err != nil {
+			c.app.t.Fatalf("Could not marshal the request body: %v", err)
+		}
+		reader = bytes.NewReader(m)
+	}
+
+	req, err := http.NewRequest(method, c.app.URL+path, reader)
+	if err != nil {
+		c.app.t.Fatalf("Could not build the request: %v", err)
+	}
+
+	for key, values := range c.Header() {
+		req.Header[key] = values
+	}
+	for key, values := range c.extra {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.app.t.Fatalf("Could not send the request: %v", err)
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		c.app.t.Fatalf("Could not read the response body: %v", err)
+	}
+
+	if out != nil && len(data) != 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			c.app.t.Fatalf("Could not unmarshal the response body %q: %v", data, err)
+		}
+	}
+
+	return res
+}
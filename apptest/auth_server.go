@@ -0,0 +1,184 @@
+package apptest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+// AuthServer is an in-process fake of the auth server sessions API, as documented on
+// interactors.Sessions. It stores the sessions in memory and implements their creation,
+// listing, deletion and cascade deletion by owner token.
+type AuthServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	ttl      time.Duration
+	failing  bool
+	sessions map[string]models.Session
+}
+
+func NewAuthServer(ttl time.Duration) *AuthServer {
+	s := &AuthServer{
+		ttl:      ttl,
+		sessions: map[string]models.Session{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Session returns the stored session with the given token, payload included.
+func (s *AuthServer) Session(token string) (*models.Session, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, ok := s.sessions[token]
+	if !ok {
+		return nil, false
+	}
+
+	return &session, true
+}
+
+// Sessions returns the stored sessions of the given owner token.
+func (s *AuthServer) Sessions(ownerToken string) []models.Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sessions := []models.Session{}
+	for _, session := range s.sessions {
+		if session.OwnerToken == ownerToken {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions
+}
+
+// SetFailing makes every request fail with an internal error until reset,
+// simulating an unavailable auth server.
+func (s *AuthServer) SetFailing(failing bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failing = failing
+}
+
+func (s *AuthServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.failing {
+		renderError(w, http.StatusInternalServerError, "auth server unavailable")
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/sessions" && r.Method == "POST":
+		s.create(w, r)
+	case r.URL.Path == "/sessions" && r.Method == "GET":
+		s.findByOwnerTokens(w, r)
+	case r.URL.Path == "/sessions" && r.Method == "DELETE":
+		s.deleteCascade(w, r)
+	case strings.HasPrefix(r.URL.Path, "/sessions/") && r.Method == "DELETE":
+		s.delete(w, strings.TrimPrefix(r.URL.Path, "/sessions/"))
+	default:
+		renderError(w, http.StatusNotFound, "route not found")
+	}
+}
+
+func (s *AuthServer) create(w http.ResponseWriter, r *http.Request) {
+	session := models.Session{}
+
+	if err := json.NewDecoder(r.Body).Decode(&session); err != nil {
+		renderError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	validTo := now.Add(s.ttl)
+
+	session.Token = utils.GenToken(64)
+	session.Created = &now
+	session.ValidTo = &validTo
+
+	s.sessions[session.Token] = session
+
+	render(w, http.StatusCreated, session)
+}
+
+func (s *AuthServer) findByOwnerTokens(w http.ResponseWriter, r *http.Request) {
+	owners, ok := ownerTokens(w, r)
+	if !ok {
+		return
+	}
+
+	sessions := []models.Session{}
+	for _, session := range s.sessions {
+		if owners[session.OwnerToken] {
+			sessions = append(sessions, session)
+		}
+	}
+
+	render(w, http.StatusOK, sessions)
+}
+
+func (s *AuthServer) deleteCascade(w http.ResponseWriter, r *http.Request) {
+	owners, ok := ownerTokens(w, r)
+	if !ok {
+		return
+	}
+
+	sessions := []models.Session{}
+	for token, session := range s.sessions {
+		if owners[session.OwnerToken] {
+			sessions = append(sessions, session)
+			delete(s.sessions, token)
+		}
+	}
+
+	render(w, http.StatusOK, sessions)
+}
+
+func (s *AuthServer) delete(w http.ResponseWriter, token string) {
+	session, ok := s.sessions[token]
+	if !ok {
+		renderError(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	delete(s.sessions, token)
+
+	render(w, http.StatusOK, session)
+}
+
+func ownerTokens(w http.ResponseWriter, r *http.Request) (map[string]bool, bool) {
+	tokens := []string{}
+
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("ownerTokens")), &tokens); err != nil {
+		renderError(w, http.StatusBadRequest, "invalid owner tokens")
+		return nil, false
+	}
+
+	owners := map[string]bool{}
+	for _, token := range tokens {
+		owners[token] = true
+	}
+
+	return owners, true
+}
+
+func render(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func renderError(w http.ResponseWriter, status int, description string) {
+	render(w, status, map[string]string{"description": description})
+}
@@ -0,0 +1,103 @@
+package apptest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/middlewares"
+	"github.com/solher/snakepit-seed/stores"
+)
+
+const (
+	// AdminEmail and AdminPassword are the credentials of the bootstrap admin.
+	AdminEmail    = "admin@localhost"
+	AdminPassword = "admin-test-password"
+	// Password is the password of the users created by the harness.
+	Password = "user-test-password"
+	// Secret is the HMAC secret shared with the fake auth server.
+	Secret = "auth-server-test-secret"
+)
+
+// NewConfig returns the configuration of a test app: the users are stored in memory,
+// the sessions by the fake auth server and its headers are signed with Secret.
+// The values are defaults, so a test can override any of them with Set before calling New.
+func NewConfig() *viper.Viper {
+	v := viper.New()
+
+	v.SetDefault(constants.DBBackend, constants.DBBackendMemory)
+	v.SetDefault(constants.AdminEmail, AdminEmail)
+	v.SetDefault(constants.AdminPassword, AdminPassword)
+
+	v.SetDefault(constants.PolicyName, "snakepit")
+	v.SetDefault(constants.ResetTokenTTL, time.Hour)
+	v.SetDefault(constants.VerificationTokenTTL, 48*time.Hour)
+	v.SetDefault(constants.RequireVerifiedEmail, false)
+	v.SetDefault(constants.TwoFactorIssuer, "snakepit")
+	v.SetDefault(constants.TwoFactorSkew, 1)
+	v.SetDefault(constants.TwoFactorChallengeTTL, 5*time.Minute)
+	v.SetDefault(constants.LockoutAccountThreshold, 5)
+	v.SetDefault(constants.LockoutIPThreshold, 20)
+	v.SetDefault(constants.LockoutDuration, time.Minute)
+	v.SetDefault(constants.LockoutMaxDuration, time.Hour)
+	v.SetDefault(constants.LockoutResetAfter, 24*time.Hour)
+	v.SetDefault(constants.PasswordMinLength, 8)
+	v.SetDefault(constants.PasswordMaxLength, 72)
+	v.SetDefault(constants.PasswordRejectCommon, true)
+	v.SetDefault(constants.PasswordRejectEmail, true)
+	v.SetDefault(constants.PaginationDefaultLimit, 50)
+	v.SetDefault(constants.PaginationMaxLimit, 500)
+	// The short-lived test apps do not start the users purge worker.
+	v.SetDefault(constants.UsersPurgeRetention, 30*24*time.Hour)
+	v.SetDefault(constants.UsersPurgeInterval, 0)
+
+	v.SetDefault(constants.SessionsBackend, constants.SessionsBackendAuthServer)
+	v.SetDefault(constants.SessionsTTL, 30*24*time.Hour)
+	// The short-lived test apps do not start the revocations retry worker.
+	v.SetDefault(constants.SessionsRevocationInterval, 0)
+	v.SetDefault(constants.SessionsRevocationMaxBackoff, time.Hour)
+
+	v.SetDefault(constants.AuthHeadersSignature, middlewares.SignatureHMAC)
+	v.SetDefault(constants.AuthHeadersSecret, Secret)
+	v.SetDefault(constants.AuthHeadersAllowUnsigned, false)
+	v.SetDefault(constants.AuthHeadersMaxAge, time.Minute)
+
+	v.SetDefault(constants.SwaggerBasePath, "/")
+	v.SetDefault(constants.SwaggerScheme, "http")
+
+	return v
+}
+
+// NewSQLiteConfig returns NewConfig storing the users in a temporary SQLite database,
+// created by New and removed by Close.
+func NewSQLiteConfig() *viper.Viper {
+	v := NewConfig()
+
+	v.Set(constants.DBBackend, constants.DBBackendSQL)
+	v.Set(constants.DBSQLDriver, stores.SQLDriverSQLite)
+	v.Set(constants.DBSQLDSN, "")
+
+	return v
+}
+
+// Backends are the configs of the users storage backends the integration tests run against.
+// A config is built for each app, as New prepares its storage in it.
+var Backends = []struct {
+	Name   string
+	Config func() *viper.Viper
+}{
+	{"memory", NewConfig},
+	{"sqlite", NewSQLiteConfig},
+}
+
+// RunBackends runs the test as a subtest for each of the Backends.
+func RunBackends(t *testing.T, test func(t *testing.T, config func() *viper.Viper)) {
+	for _, b := range Backends {
+		b := b
+		t.Run(b.Name, func(t *testing.T) {
+			test(t, b.Config)
+		})
+	}
+}
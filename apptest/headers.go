@@ -0,0 +1,42 @@
+package apptest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+// Headers forges the auth server headers of a session of the user with the given role,
+// signed now with the HMAC secret the way the auth server does.
+func Headers(secret string, user *models.User, role models.Role, session *models.Session) http.Header {
+	return HeadersAt(secret, user, role, session, time.Now())
+}
+
+// HeadersAt forges the auth server headers like Headers, signed at the given time.
+func HeadersAt(secret string, user *models.User, role models.Role, session *models.Session, at time.Time) http.Header {
+	m, _ := json.Marshal(&models.AuthServerPayload{User: user, Role: role})
+	payload := base64.StdEncoding.EncodeToString(m)
+
+	m, _ = json.Marshal(session)
+	sess := base64.StdEncoding.EncodeToString(m)
+
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload + "\n" + sess + "\n" + session.Token + "\n" + timestamp))
+
+	header := http.Header{}
+	header.Set("Auth-Server-Payload", payload)
+	header.Set("Auth-Server-Session", sess)
+	header.Set("Auth-Server-Token", session.Token)
+	header.Set("Auth-Server-Timestamp", timestamp)
+	header.Set("Auth-Server-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	return header
+}
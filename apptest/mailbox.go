@@ -0,0 +1,62 @@
+package apptest
+
+import (
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+// mailbox is the notifier of the test apps, keeping the last tokens sent to each email.
+// It is also a logrus hook collecting the one-time password of the bootstrap admin, which
+// is only ever logged.
+type mailbox struct {
+	mutex  sync.Mutex
+	tokens map[string]string
+}
+
+func newMailbox() *mailbox {
+	return &mailbox{tokens: map[string]string{}}
+}
+
+func (m *mailbox) SendResetToken(user *models.User, token string) error {
+	m.put("resetToken", user.Email, token)
+	return nil
+}
+
+func (m *mailbox) SendVerificationToken(user *models.User, token string) error {
+	m.put("verificationToken", user.Email, token)
+	return nil
+}
+
+func (m *mailbox) Levels() []logrus.Level {
+	return []logrus.Level{logrus.WarnLevel}
+}
+
+func (m *mailbox) Fire(entry *logrus.Entry) error {
+	email, ok := entry.Data["email"].(string)
+	if !ok {
+		return nil
+	}
+
+	if password, ok := entry.Data["password"].(string); ok {
+		m.put("password", email, password)
+	}
+
+	return nil
+}
+
+func (m *mailbox) put(field, email, token string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.tokens[field+"/"+email] = token
+}
+
+func (m *mailbox) token(field, email string) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.tokens[field+"/"+email]
+}
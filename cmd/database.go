@@ -1,13 +1,18 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/solher/snakepit"
 	"github.com/solher/snakepit-seed/constants"
 	"github.com/solher/snakepit-seed/database"
+	"github.com/solher/snakepit-seed/stores"
 	dbCmd "github.com/solher/snakepit/database"
 	"github.com/solher/snakepit/root"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
@@ -15,35 +20,221 @@ func init() {
 	root.Cmd.AddCommand(dbCmd.Cmd)
 
 	dbCmd.Create = func(v *viper.Viper) error {
-		return initDatabaseManager(v).Create(
+		manager, err := initDatabaseManager(v)
+		if err != nil {
+			return err
+		}
+
+		return manager.Create(
 			v.GetString(constants.DBRootName),
 			v.GetString(constants.DBRootPassword),
 		)
 	}
 
 	dbCmd.Migrate = func(v *viper.Viper) error {
-		return initDatabaseManager(v).Migrate()
+		manager, err := initDatabaseManager(v)
+		if err != nil {
+			return err
+		}
+
+		applied, err := manager.MigrateTo(
+			v.GetInt(constants.DBMigrateTo),
+			v.GetBool(constants.DBMigrateDryRun),
+		)
+		if err != nil {
+			return err
+		}
+
+		printMigrations("Applying", applied, v.GetBool(constants.DBMigrateDryRun))
+
+		return nil
 	}
 
+	migrateCmd := subcommand(dbCmd.Cmd, "migrate")
+
+	migrateCmd.PersistentFlags().Int("to", 0, "target migration version (latest by default)")
+	root.Viper.BindPFlag(constants.DBMigrateTo, migrateCmd.PersistentFlags().Lookup("to"))
+	migrateCmd.PersistentFlags().Bool("dry-run", false, "list the migrations without running them")
+	root.Viper.BindPFlag(constants.DBMigrateDryRun, migrateCmd.PersistentFlags().Lookup("dry-run"))
+
+	migrateCmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show the state of the migrations.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := initDatabaseManager(root.Viper)
+			if err != nil {
+				return err
+			}
+
+			statuses, err := manager.Status()
+			if err != nil {
+				return err
+			}
+
+			for _, s := range statuses {
+				state := "pending"
+				if s.AppliedAt != nil {
+					state = "applied " + s.AppliedAt.Format(time.RFC3339)
+				}
+				if s.Modified {
+					state += " (modified or unregistered)"
+				}
+				fmt.Printf("%4d  %-40s %s\n", s.Version, s.Name, state)
+			}
+
+			return nil
+		},
+	})
+
+	migrateCmd.AddCommand(&cobra.Command{
+		Use:   "rollback",
+		Short: "Revert the migrations applied after the --to version.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			to := root.Viper.GetInt(constants.DBMigrateTo)
+			if !cmd.Flags().Changed("to") {
+				return errors.New("the --to flag is required")
+			}
+
+			manager, err := initDatabaseManager(root.Viper)
+			if err != nil {
+				return err
+			}
+
+			reverted, err := manager.Rollback(to, root.Viper.GetBool(constants.DBMigrateDryRun))
+			if err != nil {
+				return err
+			}
+
+			printMigrations("Reverting", reverted, root.Viper.GetBool(constants.DBMigrateDryRun))
+
+			return nil
+		},
+	})
+
 	dbCmd.Seed = func(v *viper.Viper) error {
-		return initDatabaseManager(v).SyncSeeds()
+		email, password, generated, err := database.AdminCredentials(v)
+		if err != nil {
+			return err
+		}
+
+		dryRun := v.GetBool(constants.DBSeedDryRun)
+
+		seed, err := database.NewProdSeed(email, password, generated)
+		if err != nil {
+			return err
+		}
+
+		manager, err := newDatabaseManager(v, seed)
+		if err != nil {
+			return err
+		}
+
+		changes, err := manager.SyncSeeds(dryRun)
+		if err != nil {
+			return err
+		}
+
+		printSeedChanges(changes, dryRun)
+
+		// The one-time password is only shown when the admin is actually created, as it is never stored.
+		for _, change := range changes {
+			if generated && !dryRun && change.Collection == "users" && change.Kind == database.SeedAdded {
+				fmt.Printf("Bootstrap admin %s created with the one-time password: %s\n", email, password)
+				fmt.Println("It must be changed at first login.")
+			}
+		}
+
+		return nil
 	}
 
+	seedCmd := subcommand(dbCmd.Cmd, "seed")
+
+	seedCmd.Flags().Bool("dry-run", false, "show the seed changes without applying them")
+	root.Viper.BindPFlag(constants.DBSeedDryRun, seedCmd.Flags().Lookup("dry-run"))
+
 	dbCmd.Drop = func(v *viper.Viper) error {
-		return initDatabaseManager(v).Drop(
+		manager, err := initDatabaseManager(v)
+		if err != nil {
+			return err
+		}
+
+		return manager.Drop(
 			v.GetString(constants.DBRootName),
 			v.GetString(constants.DBRootPassword),
 		)
 	}
 }
 
-func initDatabaseManager(v *viper.Viper) *database.Manager {
+func subcommand(cmd *cobra.Command, name string) *cobra.Command {
+	for _, c := range cmd.Commands() {
+		if c.Name() == name {
+			return c
+		}
+	}
+
+	panic("missing database subcommand: " + name)
+}
+
+func printMigrations(action string, migrations []database.Migration, dryRun bool) {
+	if len(migrations) == 0 {
+		fmt.Println("No migration to run.")
+		return
+	}
+
+	if dryRun {
+		action = "[dry run] " + action
+	}
+
+	for _, m := range migrations {
+		fmt.Printf("%s migration %d: %s\n", action, m.Version, m.Name)
+	}
+}
+
+func printSeedChanges(changes []database.SeedChange, dryRun bool) {
+	if len(changes) == 0 {
+		fmt.Println("The seeds are in sync.")
+		return
+	}
+
+	if dryRun {
+		fmt.Println("[dry run] Seed changes:")
+	}
+
+	for _, change := range changes {
+		fmt.Println(database.FormatSeedChange(&change))
+	}
+}
+
+// databaseManager is implemented by the ArangoDB and the SQL database managers.
+type databaseManager interface {
+	Create(rootName, rootPassword string) error
+	Drop(rootName, rootPassword string) error
+	Status() ([]database.MigrationStatus, error)
+	MigrateTo(to int, dryRun bool) ([]database.Migration, error)
+	Rollback(to int, dryRun bool) ([]database.Migration, error)
+	SyncSeeds(dryRun bool) ([]database.SeedChange, error)
+}
+
+func initDatabaseManager(v *viper.Viper) (databaseManager, error) {
+	return newDatabaseManager(v, database.NewEmptyProdSeed())
+}
+
+func newDatabaseManager(v *viper.Viper, seed *database.ProdSeed) (databaseManager, error) {
+	if v.GetString(constants.DBBackend) == constants.DBBackendSQL {
+		db, err := stores.NewSQL(v.GetString(constants.DBSQLDriver), v.GetString(constants.DBSQLDSN))
+		if err != nil {
+			return nil, err
+		}
+
+		return database.NewSQLManager(db, seed), nil
+	}
+
 	v.Set(
 		constants.DBURL,
 		strings.Replace(v.GetString(constants.DBURL), "tcp://", "http://", -1),
 	)
 
-	ara := snakepit.NewArangoDBManager(database.NewProdSeed(), database.NewEmptyProdSeed()).
+	ara := snakepit.NewArangoDBManager(seed, database.NewEmptyProdSeed()).
 		LoggerOptions(false, false, false).
 		Connect(
 		v.GetString(constants.DBURL),
@@ -52,5 +243,5 @@ func initDatabaseManager(v *viper.Viper) *database.Manager {
 		v.GetString(constants.DBUserPassword),
 	)
 
-	return database.NewManager(ara)
+	return database.NewManager(ara, seed), nil
 }
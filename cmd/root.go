@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"time"
+
 	"github.com/solher/snakepit-seed/constants"
 	"github.com/solher/snakepit/root"
 )
@@ -10,6 +12,9 @@ func init() {
 	root.Cmd.Short = "A simple Snakepit seed."
 
 	// DATABASE
+	root.Cmd.PersistentFlags().String("db", constants.DBBackendArangoDB, "database backend (arangodb, sql, or memory for development)")
+	root.Viper.BindPFlag(constants.DBBackend, root.Cmd.PersistentFlags().Lookup("db"))
+
 	root.Cmd.PersistentFlags().String("dbUrl", "http://localhost:8000", "database URL")
 	root.Viper.BindPFlag(constants.DBURL, root.Cmd.PersistentFlags().Lookup("dbUrl"))
 	root.Viper.RegisterAlias(constants.DBURL, "ARANGODB_PORT")
@@ -28,6 +33,26 @@ func init() {
 
 	root.Cmd.PersistentFlags().String("dbUserPassword", "qwertyuiop", "database main user password")
 	root.Viper.BindPFlag(constants.DBUserPassword, root.Cmd.PersistentFlags().Lookup("dbUserPassword"))
+
+	root.Cmd.PersistentFlags().String("dbSqlDriver", "sqlite3", "SQL database driver (postgres or sqlite3)")
+	root.Viper.BindPFlag(constants.DBSQLDriver, root.Cmd.PersistentFlags().Lookup("dbSqlDriver"))
+
+	root.Cmd.PersistentFlags().String("dbSqlDsn", "snakepit.db", "SQL database data source name")
+	root.Viper.BindPFlag(constants.DBSQLDSN, root.Cmd.PersistentFlags().Lookup("dbSqlDsn"))
+
+	// BOOTSTRAP ADMIN
+	root.Cmd.PersistentFlags().String("adminEmail", "admin@localhost", "bootstrap admin email")
+	root.Viper.BindPFlag(constants.AdminEmail, root.Cmd.PersistentFlags().Lookup("adminEmail"))
+
+	root.Cmd.PersistentFlags().String("adminPassword", "", "bootstrap admin password (a one-time password is generated if empty)")
+	root.Viper.BindPFlag(constants.AdminPassword, root.Cmd.PersistentFlags().Lookup("adminPassword"))
+
+	root.Cmd.PersistentFlags().String("adminPasswordFile", "", "file containing the bootstrap admin password")
+	root.Viper.BindPFlag(constants.AdminPasswordFile, root.Cmd.PersistentFlags().Lookup("adminPasswordFile"))
+
+	// USERS
+	root.Cmd.PersistentFlags().Duration("usersPurgeRetention", 30*24*time.Hour, "time the deleted users are kept before being purged")
+	root.Viper.BindPFlag(constants.UsersPurgeRetention, root.Cmd.PersistentFlags().Lookup("usersPurgeRetention"))
 }
 
 func Execute() {
@@ -1,15 +1,34 @@
 package cmd
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/solher/snakepit-seed/app"
 	"github.com/solher/snakepit-seed/constants"
 	"github.com/solher/snakepit/root"
 	"github.com/solher/snakepit/run"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
+// stopWorkers stops the background workers of the app built by the run command.
+var stopWorkers func()
+
 func init() {
-	run.Builder = app.Builder
+	run.Builder = func(v *viper.Viper, l *logrus.Logger) (http.Handler, error) {
+		handler, stop, err := app.New(v, l)
+		stopWorkers = stop
+		return handler, err
+	}
+
+	// The workers are stopped once the server is shut down.
+	run.Cmd.PostRun = func(cmd *cobra.Command, args []string) {
+		if stopWorkers != nil {
+			stopWorkers()
+		}
+	}
 
 	run.Logger.Formatter = &logrus.TextFormatter{
 		ForceColors: true,
@@ -18,11 +37,103 @@ func init() {
 	// APP
 	run.Cmd.PersistentFlags().String("policyName", "snakepit", "policy created when sign in")
 	root.Viper.BindPFlag(constants.PolicyName, run.Cmd.PersistentFlags().Lookup("policyName"))
+	run.Cmd.PersistentFlags().StringSlice("trustedProxies", nil, "IPs or CIDR ranges of the proxies whose forwarding headers are trusted")
+	root.Viper.BindPFlag(constants.TrustedProxies, run.Cmd.PersistentFlags().Lookup("trustedProxies"))
+	run.Cmd.PersistentFlags().Duration("resetTokenTTL", time.Hour, "validity duration of the password reset tokens")
+	root.Viper.BindPFlag(constants.ResetTokenTTL, run.Cmd.PersistentFlags().Lookup("resetTokenTTL"))
+	run.Cmd.PersistentFlags().Duration("verificationTokenTTL", 48*time.Hour, "validity duration of the email verification tokens")
+	root.Viper.BindPFlag(constants.VerificationTokenTTL, run.Cmd.PersistentFlags().Lookup("verificationTokenTTL"))
+	run.Cmd.PersistentFlags().Bool("requireVerifiedEmail", false, "refuse sign in to users with an unverified email")
+	root.Viper.BindPFlag(constants.RequireVerifiedEmail, run.Cmd.PersistentFlags().Lookup("requireVerifiedEmail"))
+	run.Cmd.PersistentFlags().Bool("logTokens", false, "write the reset and verification tokens to the debug logs (development only)")
+	root.Viper.BindPFlag(constants.LogTokens, run.Cmd.PersistentFlags().Lookup("logTokens"))
+	run.Cmd.PersistentFlags().String("twoFactorIssuer", "snakepit", "issuer displayed by the authenticator apps")
+	root.Viper.BindPFlag(constants.TwoFactorIssuer, run.Cmd.PersistentFlags().Lookup("twoFactorIssuer"))
+	run.Cmd.PersistentFlags().Int("twoFactorSkew", 1, "number of accepted TOTP time steps before and after the current one")
+	root.Viper.BindPFlag(constants.TwoFactorSkew, run.Cmd.PersistentFlags().Lookup("twoFactorSkew"))
+	run.Cmd.PersistentFlags().Duration("twoFactorChallengeTTL", 5*time.Minute, "validity duration of the two-factor sign in challenges")
+	root.Viper.BindPFlag(constants.TwoFactorChallengeTTL, run.Cmd.PersistentFlags().Lookup("twoFactorChallengeTTL"))
+	run.Cmd.PersistentFlags().Int("lockoutAccountThreshold", 5, "failed sign in attempts before locking an account (0 to disable)")
+	root.Viper.BindPFlag(constants.LockoutAccountThreshold, run.Cmd.PersistentFlags().Lookup("lockoutAccountThreshold"))
+	run.Cmd.PersistentFlags().Int("lockoutIpThreshold", 20, "failed sign in attempts before locking an IP (0 to disable)")
+	root.Viper.BindPFlag(constants.LockoutIPThreshold, run.Cmd.PersistentFlags().Lookup("lockoutIpThreshold"))
+	run.Cmd.PersistentFlags().Duration("lockoutDuration", time.Minute, "first lockout duration, doubled at each new failure")
+	root.Viper.BindPFlag(constants.LockoutDuration, run.Cmd.PersistentFlags().Lookup("lockoutDuration"))
+	run.Cmd.PersistentFlags().Duration("lockoutMaxDuration", time.Hour, "maximum lockout duration (0 for no cap)")
+	root.Viper.BindPFlag(constants.LockoutMaxDuration, run.Cmd.PersistentFlags().Lookup("lockoutMaxDuration"))
+	run.Cmd.PersistentFlags().Duration("lockoutResetAfter", 24*time.Hour, "duration without failure after which the counters are reset")
+	root.Viper.BindPFlag(constants.LockoutResetAfter, run.Cmd.PersistentFlags().Lookup("lockoutResetAfter"))
+	run.Cmd.PersistentFlags().Int("passwordMinLength", 8, "minimum password length")
+	root.Viper.BindPFlag(constants.PasswordMinLength, run.Cmd.PersistentFlags().Lookup("passwordMinLength"))
+	run.Cmd.PersistentFlags().Int("passwordMaxLength", 72, "maximum password length in bytes (72 at most)")
+	root.Viper.BindPFlag(constants.PasswordMaxLength, run.Cmd.PersistentFlags().Lookup("passwordMaxLength"))
+	run.Cmd.PersistentFlags().Bool("passwordRequireUpper", false, "require an uppercase letter in passwords")
+	root.Viper.BindPFlag(constants.PasswordRequireUpper, run.Cmd.PersistentFlags().Lookup("passwordRequireUpper"))
+	run.Cmd.PersistentFlags().Bool("passwordRequireLower", false, "require a lowercase letter in passwords")
+	root.Viper.BindPFlag(constants.PasswordRequireLower, run.Cmd.PersistentFlags().Lookup("passwordRequireLower"))
+	run.Cmd.PersistentFlags().Bool("passwordRequireDigit", false, "require a digit in passwords")
+	root.Viper.BindPFlag(constants.PasswordRequireDigit, run.Cmd.PersistentFlags().Lookup("passwordRequireDigit"))
+	run.Cmd.PersistentFlags().Bool("passwordRequireSymbol", false, "require a symbol in passwords")
+	root.Viper.BindPFlag(constants.PasswordRequireSymbol, run.Cmd.PersistentFlags().Lookup("passwordRequireSymbol"))
+	run.Cmd.PersistentFlags().Bool("passwordRejectCommon", true, "reject the most common passwords")
+	root.Viper.BindPFlag(constants.PasswordRejectCommon, run.Cmd.PersistentFlags().Lookup("passwordRejectCommon"))
+	run.Cmd.PersistentFlags().Bool("passwordRejectEmail", true, "reject passwords containing the user email")
+	root.Viper.BindPFlag(constants.PasswordRejectEmail, run.Cmd.PersistentFlags().Lookup("passwordRejectEmail"))
+	run.Cmd.PersistentFlags().Int("paginationDefaultLimit", 50, "page size used when the filter sets no limit")
+	root.Viper.BindPFlag(constants.PaginationDefaultLimit, run.Cmd.PersistentFlags().Lookup("paginationDefaultLimit"))
+	run.Cmd.PersistentFlags().Int("paginationMaxLimit", 500, "maximum page size")
+	root.Viper.BindPFlag(constants.PaginationMaxLimit, run.Cmd.PersistentFlags().Lookup("paginationMaxLimit"))
+
+	// SESSIONS
+	run.Cmd.PersistentFlags().String("sessionsBackend", constants.SessionsBackendAuthServer, "sessions backend (authServer or local, the latter being unsupported by the sql db backend)")
+	root.Viper.BindPFlag(constants.SessionsBackend, run.Cmd.PersistentFlags().Lookup("sessionsBackend"))
+	run.Cmd.PersistentFlags().Duration("sessionsTTL", 30*24*time.Hour, "validity duration of the local sessions")
+	root.Viper.BindPFlag(constants.SessionsTTL, run.Cmd.PersistentFlags().Lookup("sessionsTTL"))
+	run.Cmd.PersistentFlags().Duration("sessionsRevocationInterval", 30*time.Second, "interval between the retries of the failed session revocations")
+	root.Viper.BindPFlag(constants.SessionsRevocationInterval, run.Cmd.PersistentFlags().Lookup("sessionsRevocationInterval"))
+	run.Cmd.PersistentFlags().Duration("sessionsRevocationMaxBackoff", time.Hour, "maximum delay between two retries of a failed session revocation")
+	root.Viper.BindPFlag(constants.SessionsRevocationMaxBackoff, run.Cmd.PersistentFlags().Lookup("sessionsRevocationMaxBackoff"))
+
+	// USERS
+	run.Cmd.PersistentFlags().Duration("usersPurgeInterval", time.Hour, "interval between the purges of the deleted users (0 disables them)")
+	root.Viper.BindPFlag(constants.UsersPurgeInterval, run.Cmd.PersistentFlags().Lookup("usersPurgeInterval"))
+
+	// JWT
+	run.Cmd.PersistentFlags().Bool("jwtEnabled", false, "authenticate the requests with JWT bearer tokens")
+	root.Viper.BindPFlag(constants.JWTEnabled, run.Cmd.PersistentFlags().Lookup("jwtEnabled"))
+	run.Cmd.PersistentFlags().String("jwtJwksFile", "", "local JWKS file of the JWT verification keys")
+	root.Viper.BindPFlag(constants.JWTJWKSFile, run.Cmd.PersistentFlags().Lookup("jwtJwksFile"))
+	run.Cmd.PersistentFlags().String("jwtJwksUrl", "", "JWKS URL of the JWT verification keys")
+	root.Viper.BindPFlag(constants.JWTJWKSURL, run.Cmd.PersistentFlags().Lookup("jwtJwksUrl"))
+	run.Cmd.PersistentFlags().Duration("jwtJwksRefresh", time.Hour, "refresh interval of the keys loaded from the JWKS URL")
+	root.Viper.BindPFlag(constants.JWTJWKSRefresh, run.Cmd.PersistentFlags().Lookup("jwtJwksRefresh"))
+	run.Cmd.PersistentFlags().String("jwtIssuer", "", "expected JWT issuer (not checked if empty)")
+	root.Viper.BindPFlag(constants.JWTIssuer, run.Cmd.PersistentFlags().Lookup("jwtIssuer"))
+	run.Cmd.PersistentFlags().String("jwtAudience", "", "expected JWT audience (not checked if empty)")
+	root.Viper.BindPFlag(constants.JWTAudience, run.Cmd.PersistentFlags().Lookup("jwtAudience"))
+	run.Cmd.PersistentFlags().Duration("jwtLeeway", 30*time.Second, "tolerated clock skew on the JWT exp and nbf claims")
+	root.Viper.BindPFlag(constants.JWTLeeway, run.Cmd.PersistentFlags().Lookup("jwtLeeway"))
+	root.Viper.SetDefault(constants.JWTClaimKey, "sub")
+	root.Viper.SetDefault(constants.JWTClaimEmail, "email")
+	root.Viper.SetDefault(constants.JWTClaimFirstName, "given_name")
+	root.Viper.SetDefault(constants.JWTClaimLastName, "family_name")
+	root.Viper.SetDefault(constants.JWTClaimRole, "role")
+	root.Viper.SetDefault(constants.JWTClaimOwnerToken, "sub")
 
 	// SERVICES
 	run.Cmd.PersistentFlags().String("authServerUrl", "", "auth server URL")
 	root.Viper.BindPFlag(constants.AuthServerURL, run.Cmd.PersistentFlags().Lookup("authServerUrl"))
 	root.Viper.RegisterAlias(constants.AuthServerURL, "AUTH_SERVER_PORT")
+	run.Cmd.PersistentFlags().String("authServerSignature", "hmac", "auth server headers signature mode (hmac or ed25519)")
+	root.Viper.BindPFlag(constants.AuthHeadersSignature, run.Cmd.PersistentFlags().Lookup("authServerSignature"))
+	run.Cmd.PersistentFlags().String("authServerSecret", "", "auth server headers HMAC shared secret")
+	root.Viper.BindPFlag(constants.AuthHeadersSecret, run.Cmd.PersistentFlags().Lookup("authServerSecret"))
+	run.Cmd.PersistentFlags().String("authServerPublicKey", "", "auth server headers base64 encoded ed25519 public key")
+	root.Viper.BindPFlag(constants.AuthHeadersPublicKey, run.Cmd.PersistentFlags().Lookup("authServerPublicKey"))
+	run.Cmd.PersistentFlags().Bool("authServerAllowUnsigned", false, "accept unsigned auth server headers (development only)")
+	root.Viper.BindPFlag(constants.AuthHeadersAllowUnsigned, run.Cmd.PersistentFlags().Lookup("authServerAllowUnsigned"))
+	run.Cmd.PersistentFlags().Duration("authServerMaxAge", time.Minute, "maximum age of the signed auth server headers")
+	root.Viper.BindPFlag(constants.AuthHeadersMaxAge, run.Cmd.PersistentFlags().Lookup("authServerMaxAge"))
 
 	// SWAGGER
 	run.Cmd.PersistentFlags().String("swaggerBasePath", "/", "Swagger base path")
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/ansel1/merry"
+	"github.com/solher/snakepit"
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/database"
+	"github.com/solher/snakepit-seed/interactors"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/repositories"
+	"github.com/solher/snakepit-seed/stores"
+	"github.com/solher/snakepit/root"
+	"github.com/solher/snakepit/run"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/h2non/gentleman.v1"
+)
+
+func init() {
+	usersCmd := &cobra.Command{
+		Use:   "users",
+		Short: "Manage the users.",
+	}
+
+	purgeCmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Hard delete the users soft deleted for longer than the retention window.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun := root.Viper.GetBool(constants.UsersPurgeDryRun)
+
+			purge, err := newUsersPurge(root.Viper)
+			if err != nil {
+				return err
+			}
+
+			users, err := purge.Purge(dryRun)
+			if err != nil {
+				return err
+			}
+
+			printPurgedUsers(users, dryRun)
+
+			return nil
+		},
+	}
+
+	purgeCmd.Flags().Bool("dry-run", false, "list the users without purging them")
+	root.Viper.BindPFlag(constants.UsersPurgeDryRun, purgeCmd.Flags().Lookup("dry-run"))
+
+	usersCmd.AddCommand(purgeCmd)
+	root.Cmd.AddCommand(usersCmd)
+}
+
+func newUsersPurge(v *viper.Viper) (*interactors.UsersPurge, error) {
+	l := logrus.NewEntry(run.Logger)
+
+	var (
+		usersStore       interactors.UsersStore
+		tokensStore      interactors.TokensStore
+		revocationsStore interactors.SessionRevocationsStore
+		auditStore       interactors.AuditStore
+		sessionsInter    interactors.SessionsCascader
+	)
+
+	v.Set(
+		constants.AuthServerURL,
+		strings.Replace(v.GetString(constants.AuthServerURL), "tcp://", "http://", -1),
+	)
+
+	switch v.GetString(constants.DBBackend) {
+	case constants.DBBackendMemory:
+		return nil, merry.New("the memory database backend cannot be purged as it is not persisted")
+	case constants.DBBackendSQL:
+		db, err := stores.NewSQL(v.GetString(constants.DBSQLDriver), v.GetString(constants.DBSQLDSN))
+		if err != nil {
+			return nil, err
+		}
+
+		// The local sessions are not supported by the SQL backend.
+		repo := repositories.NewRepository(v, l, snakepit.NewJSON(), nil, gentleman.New())
+		usersStore = db.Users
+		tokensStore = db.Tokens
+		revocationsStore = db.Revocations
+		auditStore = db.Audit
+		sessionsInter = interactors.NewSessions(v, l, repo)
+	default:
+		v.Set(
+			constants.DBURL,
+			strings.Replace(v.GetString(constants.DBURL), "tcp://", "http://", -1),
+		)
+
+		db := snakepit.NewArangoDBManager(database.NewEmptyProdSeed(), database.NewEmptyProdSeed()).
+			LoggerOptions(false, false, false).
+			Connect(
+				v.GetString(constants.DBURL),
+				v.GetString(constants.DBName),
+				v.GetString(constants.DBUserName),
+				v.GetString(constants.DBUserPassword),
+			)
+
+		repo := repositories.NewRepository(v, l, snakepit.NewJSON(), db, gentleman.New())
+		usersStore = repositories.NewUsers(repo)
+		tokensStore = repositories.NewTokens(repo)
+		revocationsStore = repositories.NewSessionRevocations(repo)
+		auditStore = repositories.NewAudit(repo)
+
+		if v.GetString(constants.SessionsBackend) == constants.SessionsBackendLocal {
+			sessionsInter = interactors.NewLocalSessions(v, l, repo)
+		} else {
+			sessionsInter = interactors.NewSessions(v, l, repo)
+		}
+	}
+
+	revocations := interactors.NewSessionRevocations(v, l, revocationsStore, sessionsInter)
+	audit := interactors.NewAudit(v, l, auditStore, nil)
+
+	return interactors.NewUsersPurge(v, l, usersStore, tokensStore, revocations, audit), nil
+}
+
+func printPurgedUsers(users []models.User, dryRun bool) {
+	if len(users) == 0 {
+		fmt.Println("No user to purge.")
+		return
+	}
+
+	action := "Purged"
+	if dryRun {
+		action = "[dry run] Purging"
+	}
+
+	for _, user := range users {
+		fmt.Printf("%s user %s <%s>, deleted %s\n", action, user.Key, user.Email, user.DeletedAt.Format(time.RFC3339))
+	}
+}
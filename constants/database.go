@@ -1,3 +1,7 @@
 package constants
 
-const ()
+const (
+	DBMigrateTo     = "db.migrate.to"
+	DBMigrateDryRun = "db.migrate.dryRun"
+	DBSeedDryRun    = "db.seed.dryRun"
+)
@@ -7,3 +7,29 @@ const (
 )
 
 var Roles = []models.Role{RoleAdmin, RoleDeveloper, RoleUser}
+
+// OptionIncludeDeleted is the filter option including the soft deleted users in the results.
+const OptionIncludeDeleted = "includeDeleted"
+
+const (
+	AuditUserCreate           models.AuditAction = "user.create"
+	AuditUserUpdate           models.AuditAction = "user.update"
+	AuditUserReplace          models.AuditAction = "user.replace"
+	AuditUserPatch            models.AuditAction = "user.patch"
+	AuditUserDelete           models.AuditAction = "user.delete"
+	AuditUserRestore          models.AuditAction = "user.restore"
+	AuditUserPurge            models.AuditAction = "user.purge"
+	AuditUserPassword         models.AuditAction = "user.password"
+	AuditUserVerify           models.AuditAction = "user.verify"
+	AuditUserUnlock           models.AuditAction = "user.unlock"
+	AuditUserTwoFactorEnroll  models.AuditAction = "user.twoFactor.enroll"
+	AuditUserTwoFactorConfirm models.AuditAction = "user.twoFactor.confirm"
+	AuditUserTwoFactorDisable models.AuditAction = "user.twoFactor.disable"
+	AuditUserRecoveryCodes    models.AuditAction = "user.twoFactor.recoveryCodes"
+	AuditUserSignin           models.AuditAction = "user.signin"
+	AuditUserSigninFailed     models.AuditAction = "user.signin.failed"
+	AuditUserSigninLocked     models.AuditAction = "user.signin.locked"
+	AuditUserTwoFactorFailed  models.AuditAction = "user.signin.twoFactorFailed"
+	AuditUserSignout          models.AuditAction = "user.signout"
+	AuditUserSessionsDelete   models.AuditAction = "user.sessions.delete"
+)
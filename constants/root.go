@@ -7,4 +7,19 @@ const (
 	DBRootPassword = "db.root.password"
 	DBUserName     = "db.user.name"
 	DBUserPassword = "db.user.password"
+	DBBackend      = "db.backend"
+	DBSQLDriver    = "db.sql.driver"
+	DBSQLDSN       = "db.sql.dsn"
+)
+
+const (
+	DBBackendArangoDB = "arangodb"
+	DBBackendMemory   = "memory"
+	DBBackendSQL      = "sql"
+)
+
+const (
+	AdminEmail        = "app.admin.email"
+	AdminPassword     = "app.admin.password"
+	AdminPasswordFile = "app.admin.passwordFile"
 )
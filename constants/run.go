@@ -5,7 +5,73 @@ const (
 )
 
 const (
-	PolicyName = "app.policyName"
+	SessionsBackend              = "app.sessions.backend"
+	SessionsTTL                  = "app.sessions.ttl"
+	SessionsRevocationInterval   = "app.sessions.revocation.interval"
+	SessionsRevocationMaxBackoff = "app.sessions.revocation.maxBackoff"
+)
+
+const (
+	SessionsBackendAuthServer = "authServer"
+	SessionsBackendLocal      = "local"
+)
+
+const (
+	JWTEnabled         = "app.jwt.enabled"
+	JWTJWKSFile        = "app.jwt.jwksFile"
+	JWTJWKSURL         = "app.jwt.jwksUrl"
+	JWTJWKSRefresh     = "app.jwt.jwksRefresh"
+	JWTIssuer          = "app.jwt.issuer"
+	JWTAudience        = "app.jwt.audience"
+	JWTLeeway          = "app.jwt.leeway"
+	JWTClaimKey        = "app.jwt.claims.key"
+	JWTClaimEmail      = "app.jwt.claims.email"
+	JWTClaimFirstName  = "app.jwt.claims.firstName"
+	JWTClaimLastName   = "app.jwt.claims.lastName"
+	JWTClaimRole       = "app.jwt.claims.role"
+	JWTClaimOwnerToken = "app.jwt.claims.ownerToken"
+)
+
+const (
+	AuthHeadersSignature     = "services.authServer.signature.mode"
+	AuthHeadersSecret        = "services.authServer.signature.secret"
+	AuthHeadersPublicKey     = "services.authServer.signature.publicKey"
+	AuthHeadersAllowUnsigned = "services.authServer.signature.allowUnsigned"
+	AuthHeadersMaxAge        = "services.authServer.signature.maxAge"
+)
+
+const (
+	PolicyName           = "app.policyName"
+	TrustedProxies       = "app.trustedProxies"
+	ResetTokenTTL        = "app.resetTokenTTL"
+	VerificationTokenTTL = "app.verificationTokenTTL"
+	RequireVerifiedEmail = "app.requireVerifiedEmail"
+	LogTokens            = "app.logTokens"
+
+	TwoFactorIssuer       = "app.twoFactor.issuer"
+	TwoFactorSkew         = "app.twoFactor.skew"
+	TwoFactorChallengeTTL = "app.twoFactor.challengeTTL"
+
+	LockoutAccountThreshold = "app.lockout.accountThreshold"
+	LockoutIPThreshold      = "app.lockout.ipThreshold"
+	LockoutDuration         = "app.lockout.duration"
+	LockoutMaxDuration      = "app.lockout.maxDuration"
+	LockoutResetAfter       = "app.lockout.resetAfter"
+
+	PasswordMinLength     = "app.passwordPolicy.minLength"
+	PasswordMaxLength     = "app.passwordPolicy.maxLength"
+	PasswordRequireUpper  = "app.passwordPolicy.requireUpper"
+	PasswordRequireLower  = "app.passwordPolicy.requireLower"
+	PasswordRequireDigit  = "app.passwordPolicy.requireDigit"
+	PasswordRequireSymbol = "app.passwordPolicy.requireSymbol"
+	PasswordRejectCommon  = "app.passwordPolicy.rejectCommon"
+	PasswordRejectEmail   = "app.passwordPolicy.rejectEmail"
+
+	PaginationDefaultLimit = "app.pagination.defaultLimit"
+	PaginationMaxLimit     = "app.pagination.maxLimit"
+
+	UsersPurgeRetention = "app.users.purge.retention"
+	UsersPurgeInterval  = "app.users.purge.interval"
 )
 
 const (
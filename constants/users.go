@@ -0,0 +1,5 @@
+package constants
+
+const (
+	UsersPurgeDryRun = "users.purge.dryRun"
+)
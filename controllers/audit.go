@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite/filters"
+	"github.com/solher/snakepit"
+	"github.com/spf13/viper"
+)
+
+type (
+	AuditContext struct {
+		Filter *filters.Filter
+	}
+
+	AuditInter interface {
+		Find(f *filters.Filter) ([]models.AuditEntry, error)
+	}
+
+	Audit struct {
+		snakepit.Controller
+		Context *AuditContext
+		Inter   AuditInter
+	}
+)
+
+func NewAudit(
+	c *viper.Viper,
+	l *logrus.Entry,
+	j *snakepit.JSON,
+	ctx *AuditContext,
+	i AuditInter,
+) *Audit {
+	return &Audit{
+		Controller: *snakepit.NewController(c, l, j),
+		Context:    ctx,
+		Inter:      i,
+	}
+}
+
+// Find swagger:route GET /audit Audit AuditFind
+//
+// Find
+//
+// Finds the audit entries matched by filter, the most recent first unless sorted otherwise.
+// The page size is bounded by the configured maximum.
+//
+// Responses:
+//  200: AuditEntriesResponse
+func (c *Audit) Find(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	entries, err := c.Inter.Find(c.Context.Filter)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.InvalidFilter):
+			c.JSON.RenderError(ctx, w, 422, errs.APIInvalidFilter, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	c.JSON.Render(ctx, w, http.StatusOK, entries)
+}
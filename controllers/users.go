@@ -1,12 +1,16 @@
 package controllers
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/solher/snakepit-seed/errs"
 	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/ansel1/merry"
@@ -21,36 +25,75 @@ type (
 		CurrentUser    *models.User
 		CurrentSession *models.Session
 		Key            string
+		SessionID      string
 		Filter         *filters.Filter
+		Cursor         string
+		Fields         []string
+		ClientIP       string
+
+		MustChangePassword bool
 	}
 
 	UsersInter interface {
 		Create(users []models.User) ([]models.User, error)
 		Find(f *filters.Filter) ([]models.User, error)
+		FindPage(f *filters.Filter, cursor string, fields []string) ([]models.User, *models.Page, error)
+		Search(query string, offset, limit int) ([]models.User, *models.Page, error)
 		Update(user *models.User, f *filters.Filter) ([]models.User, error)
-		Delete(f *filters.Filter) ([]models.User, error)
+		Delete(f *filters.Filter, by string) ([]models.User, error)
 
 		FindByKey(key string, f *filters.Filter) (*models.User, error)
-		UpdateByKey(key string, user *models.User) (*models.User, error)
-		DeleteByKey(key string) (*models.User, error)
+		FindByKeyFields(key string, f *filters.Filter, fields []string) (*models.User, error)
+		UpdateByKey(key string, revs []string, user *models.User) (*models.User, error)
+		ReplaceByKey(key string, revs []string, user *models.User) (*models.User, error)
+		PatchByKey(key string, revs []string, patch map[string]interface{}) (*models.User, error)
+		DeleteByKey(key string, revs []string, by string) (*models.User, error)
+		Restore(key string) (*models.User, error)
 
 		Signup(user *models.User) (*models.User, error)
-		Signin(cred *models.Credentials, agent string) (*models.Session, error)
+		Signin(cred *models.Credentials, agent, ip string) (*models.Session, *models.TwoFactorChallenge, error)
 		Signout(accessToken string) (*models.Session, error)
 		UpdatePassword(key, password string) (*models.User, error)
+		Unlock(key string) (*models.User, error)
+		ForgotPassword(email string) error
+		ResetTokenOwner(token string) (*models.User, error)
+		ResetPassword(token, password string) (*models.User, error)
+		Verify(token string) (*models.User, error)
+		ResendVerification(key string) (*models.User, error)
+
+		EnrollTwoFactor(key string) (*models.TwoFactorSetup, error)
+		ConfirmTwoFactor(key, code string) (*models.RecoveryCodes, error)
+		DisableTwoFactor(key, code string) (*models.User, error)
+		RegenerateRecoveryCodes(key, code string) (*models.RecoveryCodes, error)
+		SigninTwoFactor(challenge, code, agent, ip string) (*models.Session, error)
+
+		FindSessions(key string) ([]models.Session, error)
+		DeleteSession(key, id string) (*models.Session, error)
+		DeleteSessions(key, exceptToken string) ([]models.Session, error)
 	}
 
 	UsersValidator interface {
+		Filter(f *filters.Filter) (*filters.Filter, error)
+		Fields(fields []string) ([]string, error)
 		Signin(cred *models.Credentials) (*models.Credentials, error)
 		Signup(user *models.User) (*models.User, error)
 		Create(users []models.User) ([]models.User, error)
 		Update(user *models.User) (*models.User, error)
-		UpdatePassword(pwd *models.Password) (*models.Password, error)
+		Replace(key string, user *models.User) (*models.User, error)
+		Patch(key string, patch map[string]interface{}) (map[string]interface{}, error)
+		Search(query string) (string, error)
+		UpdatePassword(pwd *models.Password, email string) (*models.Password, error)
+		ForgotPassword(forgot *models.PasswordForgot) (*models.PasswordForgot, error)
+		ResetPassword(reset *models.PasswordReset, email string) (*models.PasswordReset, error)
+		Verify(verification *models.Verification) (*models.Verification, error)
+		TwoFactorCode(code *models.TwoFactorCode) (*models.TwoFactorCode, error)
+		TwoFactorSignin(signin *models.TwoFactorSignin) (*models.TwoFactorSignin, error)
 		Output(users []models.User) []models.User
 	}
 
 	SessionsOutputValidator interface {
-		Output(users []models.Session) []models.Session
+		Output(sessions []models.Session) []models.Session
+		ListOutput(sessions []models.Session, currentToken string) []models.Session
 	}
 
 	Users struct {
@@ -103,7 +146,12 @@ func (c *Users) Signup(ctx context.Context, w http.ResponseWriter, r *http.Reque
 
 	user, err = c.Inter.Signup(user)
 	if err != nil {
-		c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		switch {
+		case merry.Is(err, errs.EmailTaken):
+			c.JSON.RenderError(ctx, w, 422, errs.APIEmailTaken, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
 		return
 	}
 
@@ -117,9 +165,12 @@ func (c *Users) Signup(ctx context.Context, w http.ResponseWriter, r *http.Reque
 // Sign in
 //
 // Signs in a user and returns a new session.
+// If the user enabled the two-factor authentication, a challenge is returned instead
+// and must be exchanged on /users/signin/2fa.
 //
 // Responses:
 //  201: SessionResponse
+//  202: TwoFactorChallengeResponse
 func (c *Users) Signin(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	cred := &models.Credentials{}
 
@@ -133,17 +184,26 @@ func (c *Users) Signin(ctx context.Context, w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	session, err := c.Inter.Signin(cred, r.UserAgent())
+	session, challenge, err := c.Inter.Signin(cred, r.UserAgent(), c.Context.ClientIP)
 	if err != nil {
 		switch {
 		case merry.Is(err, errs.NotFound):
 			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		case merry.Is(err, errs.AccountLocked):
+			c.renderAccountLocked(ctx, w, err)
+		case merry.Is(err, errs.EmailNotVerified):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIEmailNotVerified, err)
 		default:
 			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
 		}
 		return
 	}
 
+	if challenge != nil {
+		c.JSON.Render(ctx, w, http.StatusAccepted, challenge)
+		return
+	}
+
 	session = &c.SessionsValidator.Output([]models.Session{*session})[0]
 
 	c.JSON.Render(ctx, w, http.StatusCreated, session)
@@ -187,16 +247,20 @@ func (c *Users) Signout(ctx context.Context, w http.ResponseWriter, r *http.Requ
 //
 // Find
 //
-// Finds all the users matched by filter from the data source.
+// Finds a page of the users matched by filter from the data source.
+// The pages hold the filter limit of users, 50 by default and at most 500 unless configured otherwise.
+// The total count is returned in the X-Total-Count header and the adjacent pages in the Link header.
 //
 // Responses:
 //  200: UsersResponse
 func (c *Users) Find(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	users, err := c.Inter.Find(c.Context.Filter)
+	users, page, err := c.Inter.FindPage(c.Context.Filter, c.Context.Cursor, c.Context.Fields)
 	if err != nil {
 		switch {
 		case merry.Is(err, errs.InvalidFilter):
 			c.JSON.RenderError(ctx, w, 422, errs.APIInvalidFilter, err)
+		case merry.Is(err, errs.InvalidCursor):
+			c.JSON.RenderError(ctx, w, http.StatusBadRequest, errs.APIInvalidCursor, err)
 		default:
 			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
 		}
@@ -205,6 +269,46 @@ func (c *Users) Find(ctx context.Context, w http.ResponseWriter, r *http.Request
 
 	users = c.Validator.Output(users)
 
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if links := utils.PageLinks(r.URL, "cursor", page.Next, page.Prev); links != "" {
+		w.Header().Set("Link", links)
+	}
+	c.JSON.Render(ctx, w, http.StatusOK, users)
+}
+
+// Search swagger:route GET /users/search Users UsersSearch
+//
+// Search
+//
+// Searches the users by first name, last name or email words prefixes. The users are ranked by relevance.
+// The total count is returned in the X-Total-Count header and the adjacent pages in the Link header.
+//
+// Responses:
+//  200: UsersResponse
+func (c *Users) Search(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query, err := c.Validator.Search(params.Get("q"))
+	if err != nil {
+		c.JSON.RenderError(ctx, w, 422, errs.APIValidation, err)
+		return
+	}
+
+	offset, _ := strconv.Atoi(params.Get("offset"))
+	limit, _ := strconv.Atoi(params.Get("limit"))
+
+	users, page, err := c.Inter.Search(query, offset, limit)
+	if err != nil {
+		c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		return
+	}
+
+	users = c.Validator.Output(users)
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if links := utils.PageLinks(r.URL, "offset", page.Next, page.Prev); links != "" {
+		w.Header().Set("Link", links)
+	}
 	c.JSON.Render(ctx, w, http.StatusOK, users)
 }
 
@@ -217,7 +321,7 @@ func (c *Users) Find(ctx context.Context, w http.ResponseWriter, r *http.Request
 // Responses:
 //  200: UserResponse
 func (c *Users) FindByKey(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	user, err := c.Inter.FindByKey(c.Context.Key, c.Context.Filter)
+	user, err := c.Inter.FindByKeyFields(c.Context.Key, c.Context.Filter, c.Context.Fields)
 	if err != nil {
 		switch {
 		case merry.Is(err, errs.InvalidFilter):
@@ -232,6 +336,7 @@ func (c *Users) FindByKey(ctx context.Context, w http.ResponseWriter, r *http.Re
 
 	user = &c.Validator.Output([]models.User{*user})[0]
 
+	w.Header().Set("ETag", utils.ETag(user.Rev))
 	c.JSON.Render(ctx, w, http.StatusOK, user)
 }
 
@@ -259,7 +364,12 @@ func (c *Users) Create(ctx context.Context, w http.ResponseWriter, r *http.Reque
 
 	users, err = c.Inter.Create(users)
 	if err != nil {
-		c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		switch {
+		case merry.Is(err, errs.EmailTaken):
+			c.JSON.RenderError(ctx, w, 422, errs.APIEmailTaken, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
 		return
 	}
 
@@ -276,12 +386,12 @@ func (c *Users) Create(ctx context.Context, w http.ResponseWriter, r *http.Reque
 //
 // Delete
 //
-// Deletes all the users matched by filter in the data source.
+// Soft deletes all the users matched by filter. They can be restored until they are purged.
 //
 // Responses:
 //  200: UsersResponse
 func (c *Users) Delete(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	users, err := c.Inter.Delete(c.Context.Filter)
+	users, err := c.Inter.Delete(c.Context.Filter, c.currentUserKey())
 	if err != nil {
 		switch {
 		case merry.Is(err, errs.InvalidFilter):
@@ -301,16 +411,21 @@ func (c *Users) Delete(ctx context.Context, w http.ResponseWriter, r *http.Reque
 //
 // Delete by key
 //
-// Deletes a user by key in the data source.
+// Soft deletes a user by key. It can be restored until it is purged.
+// When an If-Match header is given, the deletion is refused if the user has been modified since.
 //
 // Responses:
 //  200: UserResponse
 func (c *Users) DeleteByKey(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	user, err := c.Inter.DeleteByKey(c.Context.Key)
+	revs := utils.ParseIfMatch(r.Header.Get("If-Match"))
+
+	user, err := c.Inter.DeleteByKey(c.Context.Key, revs, c.currentUserKey())
 	if err != nil {
 		switch {
 		case merry.Is(err, errs.NotFound):
 			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		case merry.Is(err, errs.PreconditionFailed):
+			c.JSON.RenderError(ctx, w, http.StatusPreconditionFailed, errs.APIPreconditionFailed, err)
 		default:
 			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
 		}
@@ -319,6 +434,7 @@ func (c *Users) DeleteByKey(ctx context.Context, w http.ResponseWriter, r *http.
 
 	user = &c.Validator.Output([]models.User{*user})[0]
 
+	w.Header().Set("ETag", utils.ETag(user.Rev))
 	c.JSON.Render(ctx, w, http.StatusOK, user)
 }
 
@@ -348,6 +464,8 @@ func (c *Users) Update(ctx context.Context, w http.ResponseWriter, r *http.Reque
 		switch {
 		case merry.Is(err, errs.InvalidFilter):
 			c.JSON.RenderError(ctx, w, 422, errs.APIInvalidFilter, err)
+		case merry.Is(err, errs.EmailTaken):
+			c.JSON.RenderError(ctx, w, 422, errs.APIEmailTaken, err)
 		default:
 			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
 		}
@@ -363,7 +481,9 @@ func (c *Users) Update(ctx context.Context, w http.ResponseWriter, r *http.Reque
 //
 // Update by key
 //
-// Updates a user by key in the data source.
+// Replaces a user by key in the data source. The fields omitted in the body are removed,
+// except the password, the two-factor settings and the fields only admins can modify.
+// When an If-Match header is given, the update is refused if the user has been modified since.
 //
 // Responses:
 //  200: UserResponse
@@ -374,17 +494,23 @@ func (c *Users) UpdateByKey(ctx context.Context, w http.ResponseWriter, r *http.
 		return
 	}
 
-	user, err := c.Validator.Update(user)
+	user, err := c.Validator.Replace(c.Context.Key, user)
 	if err != nil {
 		c.JSON.RenderError(ctx, w, 422, errs.APIValidation, err)
 		return
 	}
 
-	user, err = c.Inter.UpdateByKey(c.Context.Key, user)
+	revs := utils.ParseIfMatch(r.Header.Get("If-Match"))
+
+	user, err = c.Inter.ReplaceByKey(c.Context.Key, revs, user)
 	if err != nil {
 		switch {
 		case merry.Is(err, errs.NotFound):
 			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		case merry.Is(err, errs.PreconditionFailed):
+			c.JSON.RenderError(ctx, w, http.StatusPreconditionFailed, errs.APIPreconditionFailed, err)
+		case merry.Is(err, errs.EmailTaken):
+			c.JSON.RenderError(ctx, w, 422, errs.APIEmailTaken, err)
 		default:
 			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
 		}
@@ -393,6 +519,52 @@ func (c *Users) UpdateByKey(ctx context.Context, w http.ResponseWriter, r *http.
 
 	user = &c.Validator.Output([]models.User{*user})[0]
 
+	w.Header().Set("ETag", utils.ETag(user.Rev))
+	c.JSON.Render(ctx, w, http.StatusOK, user)
+}
+
+// PatchByKey swagger:route PATCH /users/{key} Users UsersPatchByKey
+//
+// Patch by key
+//
+// Applies a JSON merge patch (RFC 7396) to a user by key. Null values remove the matching fields.
+// When an If-Match header is given, the update is refused if the user has been modified since.
+//
+// Responses:
+//  200: UserResponse
+func (c *Users) PatchByKey(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	patch := map[string]interface{}{}
+
+	if ok := c.JSON.UnmarshalBody(ctx, w, r.Body, &patch); !ok {
+		return
+	}
+
+	patch, err := c.Validator.Patch(c.Context.Key, patch)
+	if err != nil {
+		c.JSON.RenderError(ctx, w, 422, errs.APIValidation, err)
+		return
+	}
+
+	revs := utils.ParseIfMatch(r.Header.Get("If-Match"))
+
+	user, err := c.Inter.PatchByKey(c.Context.Key, revs, patch)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		case merry.Is(err, errs.PreconditionFailed):
+			c.JSON.RenderError(ctx, w, http.StatusPreconditionFailed, errs.APIPreconditionFailed, err)
+		case merry.Is(err, errs.EmailTaken):
+			c.JSON.RenderError(ctx, w, 422, errs.APIEmailTaken, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	user = &c.Validator.Output([]models.User{*user})[0]
+
+	w.Header().Set("ETag", utils.ETag(user.Rev))
 	c.JSON.Render(ctx, w, http.StatusOK, user)
 }
 
@@ -411,13 +583,49 @@ func (c *Users) UpdatePassword(ctx context.Context, w http.ResponseWriter, r *ht
 		return
 	}
 
-	pwd, err := c.Validator.UpdatePassword(pwd)
+	user, err := c.Inter.FindByKey(c.Context.Key, nil)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	pwd, err = c.Validator.UpdatePassword(pwd, user.Email)
 	if err != nil {
 		c.JSON.RenderError(ctx, w, 422, errs.APIValidation, err)
 		return
 	}
 
-	user, err := c.Inter.UpdatePassword(c.Context.Key, pwd.Password)
+	user, err = c.Inter.UpdatePassword(c.Context.Key, pwd.Password)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	user = &c.Validator.Output([]models.User{*user})[0]
+
+	c.JSON.Render(ctx, w, http.StatusOK, user)
+}
+
+// Unlock swagger:route POST /users/{key}/unlock Users UsersUnlock
+//
+// Unlock
+//
+// Clears the failed sign in attempts of a user account.
+//
+// Responses:
+//  200: UserResponse
+func (c *Users) Unlock(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	user, err := c.Inter.Unlock(c.Context.Key)
 	if err != nil {
 		switch {
 		case merry.Is(err, errs.NotFound):
@@ -432,3 +640,462 @@ func (c *Users) UpdatePassword(ctx context.Context, w http.ResponseWriter, r *ht
 
 	c.JSON.Render(ctx, w, http.StatusOK, user)
 }
+
+// Restore swagger:route POST /users/{key}/restore Users UsersRestore
+//
+// Restore
+//
+// Restores a soft deleted user.
+//
+// Responses:
+//  200: UserResponse
+func (c *Users) Restore(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	user, err := c.Inter.Restore(c.Context.Key)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		case merry.Is(err, errs.PreconditionFailed):
+			c.JSON.RenderError(ctx, w, http.StatusPreconditionFailed, errs.APIPreconditionFailed, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	user = &c.Validator.Output([]models.User{*user})[0]
+
+	c.JSON.Render(ctx, w, http.StatusOK, user)
+}
+
+// ForgotPassword swagger:route POST /users/password/forgot Users UsersForgotPassword
+//
+// Forgot password
+//
+// Sends a password reset token to the user owning the given email.
+// The response is the same whether the email is known or not.
+//
+// Responses:
+//  204:
+func (c *Users) ForgotPassword(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	forgot := &models.PasswordForgot{}
+
+	if ok := c.JSON.UnmarshalBody(ctx, w, r.Body, forgot); !ok {
+		return
+	}
+
+	forgot, err := c.Validator.ForgotPassword(forgot)
+	if err != nil {
+		c.JSON.RenderError(ctx, w, 422, errs.APIValidation, err)
+		return
+	}
+
+	if err := c.Inter.ForgotPassword(forgot.Email); err != nil {
+		c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetPassword swagger:route POST /users/password/reset Users UsersResetPassword
+//
+// Reset password
+//
+// Sets a new password using a reset token and revokes all the user sessions.
+//
+// Responses:
+//  200: UserResponse
+func (c *Users) ResetPassword(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	reset := &models.PasswordReset{}
+
+	if ok := c.JSON.UnmarshalBody(ctx, w, r.Body, reset); !ok {
+		return
+	}
+
+	// The owner of the token is looked up first, the new password being checked against its email.
+	email := ""
+	if len(reset.Token) > 0 {
+		owner, err := c.Inter.ResetTokenOwner(reset.Token)
+		if err != nil {
+			switch {
+			case merry.Is(err, errs.InvalidToken):
+				c.JSON.RenderError(ctx, w, 422, errs.APIInvalidToken, err)
+			default:
+				c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+			}
+			return
+		}
+		email = owner.Email
+	}
+
+	reset, err := c.Validator.ResetPassword(reset, email)
+	if err != nil {
+		c.JSON.RenderError(ctx, w, 422, errs.APIValidation, err)
+		return
+	}
+
+	user, err := c.Inter.ResetPassword(reset.Token, reset.Password)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.InvalidToken):
+			c.JSON.RenderError(ctx, w, 422, errs.APIInvalidToken, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	user = &c.Validator.Output([]models.User{*user})[0]
+
+	c.JSON.Render(ctx, w, http.StatusOK, user)
+}
+
+// Verify swagger:route POST /users/verify Users UsersVerify
+//
+// Verify email
+//
+// Verifies the user email using a verification token.
+//
+// Responses:
+//  200: UserResponse
+func (c *Users) Verify(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	verification := &models.Verification{}
+
+	if ok := c.JSON.UnmarshalBody(ctx, w, r.Body, verification); !ok {
+		return
+	}
+
+	verification, err := c.Validator.Verify(verification)
+	if err != nil {
+		c.JSON.RenderError(ctx, w, 422, errs.APIValidation, err)
+		return
+	}
+
+	user, err := c.Inter.Verify(verification.Token)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.InvalidToken):
+			c.JSON.RenderError(ctx, w, 422, errs.APIInvalidToken, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	user = &c.Validator.Output([]models.User{*user})[0]
+
+	c.JSON.Render(ctx, w, http.StatusOK, user)
+}
+
+// ResendVerification swagger:route POST /users/me/verification Users UsersResendVerification
+//
+// Resend verification
+//
+// Sends a new email verification token to the current user.
+//
+// Responses:
+//  200: UserResponse
+func (c *Users) ResendVerification(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	user, err := c.Inter.ResendVerification(c.Context.Key)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		case merry.Is(err, errs.EmailAlreadyVerified):
+			c.JSON.RenderError(ctx, w, http.StatusConflict, errs.APIEmailAlreadyVerified, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	user = &c.Validator.Output([]models.User{*user})[0]
+
+	c.JSON.Render(ctx, w, http.StatusOK, user)
+}
+
+// SigninTwoFactor swagger:route POST /users/signin/2fa Users UsersSigninTwoFactor
+//
+// Sign in with two-factor
+//
+// Exchanges a sign in challenge and a TOTP or recovery code for a new session.
+//
+// Responses:
+//  201: SessionResponse
+func (c *Users) SigninTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	signin := &models.TwoFactorSignin{}
+
+	if ok := c.JSON.UnmarshalBody(ctx, w, r.Body, signin); !ok {
+		return
+	}
+
+	signin, err := c.Validator.TwoFactorSignin(signin)
+	if err != nil {
+		c.JSON.RenderError(ctx, w, 422, errs.APIValidation, err)
+		return
+	}
+
+	session, err := c.Inter.SigninTwoFactor(signin.Challenge, signin.Code, r.UserAgent(), c.Context.ClientIP)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.InvalidToken):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIInvalidToken, err)
+		case merry.Is(err, errs.InvalidCode):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIInvalidCode, err)
+		case merry.Is(err, errs.AccountLocked):
+			c.renderAccountLocked(ctx, w, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	session = &c.SessionsValidator.Output([]models.Session{*session})[0]
+
+	c.JSON.Render(ctx, w, http.StatusCreated, session)
+}
+
+// EnrollTwoFactor swagger:route POST /users/me/2fa Users UsersEnrollTwoFactor
+//
+// Enroll two-factor
+//
+// Generates a new TOTP secret for the current user. It must be confirmed before being enabled.
+//
+// Responses:
+//  201: TwoFactorSetupResponse
+func (c *Users) EnrollTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	setup, err := c.Inter.EnrollTwoFactor(c.Context.Key)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		case merry.Is(err, errs.TwoFactorAlreadyEnabled):
+			c.JSON.RenderError(ctx, w, http.StatusConflict, errs.APITwoFactorAlreadyEnabled, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	c.JSON.Render(ctx, w, http.StatusCreated, setup)
+}
+
+// ConfirmTwoFactor swagger:route POST /users/me/2fa/confirm Users UsersConfirmTwoFactor
+//
+// Confirm two-factor
+//
+// Enables the two-factor authentication of the current user and returns its recovery codes.
+//
+// Responses:
+//  200: RecoveryCodesResponse
+func (c *Users) ConfirmTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	code := &models.TwoFactorCode{}
+
+	if ok := c.JSON.UnmarshalBody(ctx, w, r.Body, code); !ok {
+		return
+	}
+
+	code, err := c.Validator.TwoFactorCode(code)
+	if err != nil {
+		c.JSON.RenderError(ctx, w, 422, errs.APIValidation, err)
+		return
+	}
+
+	codes, err := c.Inter.ConfirmTwoFactor(c.Context.Key, code.Code)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		case merry.Is(err, errs.TwoFactorAlreadyEnabled):
+			c.JSON.RenderError(ctx, w, http.StatusConflict, errs.APITwoFactorAlreadyEnabled, err)
+		case merry.Is(err, errs.TwoFactorNotEnabled):
+			c.JSON.RenderError(ctx, w, http.StatusConflict, errs.APITwoFactorNotEnabled, err)
+		case merry.Is(err, errs.InvalidCode):
+			c.JSON.RenderError(ctx, w, 422, errs.APIInvalidCode, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	c.JSON.Render(ctx, w, http.StatusOK, codes)
+}
+
+// DisableTwoFactor swagger:route POST /users/me/2fa/disable Users UsersDisableTwoFactor
+//
+// Disable two-factor
+//
+// Disables the two-factor authentication of the current user.
+//
+// Responses:
+//  200: UserResponse
+func (c *Users) DisableTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	code := &models.TwoFactorCode{}
+
+	if ok := c.JSON.UnmarshalBody(ctx, w, r.Body, code); !ok {
+		return
+	}
+
+	code, err := c.Validator.TwoFactorCode(code)
+	if err != nil {
+		c.JSON.RenderError(ctx, w, 422, errs.APIValidation, err)
+		return
+	}
+
+	user, err := c.Inter.DisableTwoFactor(c.Context.Key, code.Code)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		case merry.Is(err, errs.TwoFactorNotEnabled):
+			c.JSON.RenderError(ctx, w, http.StatusConflict, errs.APITwoFactorNotEnabled, err)
+		case merry.Is(err, errs.InvalidCode):
+			c.JSON.RenderError(ctx, w, 422, errs.APIInvalidCode, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	user = &c.Validator.Output([]models.User{*user})[0]
+
+	c.JSON.Render(ctx, w, http.StatusOK, user)
+}
+
+// RegenerateRecoveryCodes swagger:route POST /users/me/2fa/recovery Users UsersRegenerateRecoveryCodes
+//
+// Regenerate recovery codes
+//
+// Replaces the recovery codes of the current user.
+//
+// Responses:
+//  200: RecoveryCodesResponse
+func (c *Users) RegenerateRecoveryCodes(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	code := &models.TwoFactorCode{}
+
+	if ok := c.JSON.UnmarshalBody(ctx, w, r.Body, code); !ok {
+		return
+	}
+
+	code, err := c.Validator.TwoFactorCode(code)
+	if err != nil {
+		c.JSON.RenderError(ctx, w, 422, errs.APIValidation, err)
+		return
+	}
+
+	codes, err := c.Inter.RegenerateRecoveryCodes(c.Context.Key, code.Code)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		case merry.Is(err, errs.TwoFactorNotEnabled):
+			c.JSON.RenderError(ctx, w, http.StatusConflict, errs.APITwoFactorNotEnabled, err)
+		case merry.Is(err, errs.InvalidCode):
+			c.JSON.RenderError(ctx, w, 422, errs.APIInvalidCode, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	c.JSON.Render(ctx, w, http.StatusOK, codes)
+}
+
+// FindSessions swagger:route GET /users/{key}/sessions Users UsersFindSessions
+//
+// Find sessions
+//
+// Finds the active sessions of a user.
+//
+// Responses:
+//  200: SessionsResponse
+func (c *Users) FindSessions(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	sessions, err := c.Inter.FindSessions(c.Context.Key)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	sessions = c.SessionsValidator.ListOutput(sessions, c.Context.AccessToken)
+
+	c.JSON.Render(ctx, w, http.StatusOK, sessions)
+}
+
+// DeleteSession swagger:route DELETE /users/{key}/sessions/{session} Users UsersDeleteSession
+//
+// Delete session
+//
+// Revokes a session of a user, designated by its identifier.
+//
+// Responses:
+//  200: SessionResponse
+func (c *Users) DeleteSession(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	session, err := c.Inter.DeleteSession(c.Context.Key, c.Context.SessionID)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	session = &c.SessionsValidator.ListOutput([]models.Session{*session}, c.Context.AccessToken)[0]
+
+	c.JSON.Render(ctx, w, http.StatusOK, session)
+}
+
+// DeleteSessions swagger:route DELETE /users/{key}/sessions Users UsersDeleteSessions
+//
+// Delete sessions
+//
+// Revokes all the sessions of a user. When targeting the current user, the current session is kept.
+//
+// Responses:
+//  200: SessionsResponse
+func (c *Users) DeleteSessions(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	exceptToken := ""
+	if c.Context.CurrentUser != nil && c.Context.CurrentUser.Key == c.Context.Key {
+		exceptToken = c.Context.AccessToken
+	}
+
+	sessions, err := c.Inter.DeleteSessions(c.Context.Key, exceptToken)
+	if err != nil {
+		switch {
+		case merry.Is(err, errs.NotFound):
+			c.JSON.RenderError(ctx, w, http.StatusForbidden, errs.APIForbidden, err)
+		default:
+			c.JSON.RenderError(ctx, w, http.StatusInternalServerError, errs.APIInternal, err)
+		}
+		return
+	}
+
+	sessions = c.SessionsValidator.ListOutput(sessions, c.Context.AccessToken)
+
+	c.JSON.Render(ctx, w, http.StatusOK, sessions)
+}
+
+// currentUserKey returns the key of the authenticated user, empty when anonymous.
+func (c *Users) currentUserKey() string {
+	if c.Context.CurrentUser == nil {
+		return ""
+	}
+
+	return c.Context.CurrentUser.Key
+}
+
+// renderAccountLocked renders an AccountLocked error, telling in the Retry-After header
+// when the next attempt can be made.
+func (c *Users) renderAccountLocked(ctx context.Context, w http.ResponseWriter, err error) {
+	if wait, ok := merry.Value(err, "retryAfter").(time.Duration); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+	c.JSON.RenderError(ctx, w, http.StatusTooManyRequests, errs.APIAccountLocked, err)
+}
@@ -5,12 +5,22 @@ import (
 	"github.com/solher/snakepit"
 )
 
+// arangoDB is the ArangoDB database managed, implemented by *snakepit.ArangoDBManager.
+type arangoDB interface {
+	Runner
+	Create(rootName, rootPassword string) error
+	Drop(rootName, rootPassword string) error
+	Migrate() error
+}
+
 type Manager struct {
-	db *snakepit.ArangoDBManager
+	db         arangoDB
+	seed       *ProdSeed
+	migrations []Migration
 }
 
-func NewManager(db *snakepit.ArangoDBManager) *Manager {
-	return &Manager{db: db}
+func NewManager(db *snakepit.ArangoDBManager, seed *ProdSeed) *Manager {
+	return &Manager{db: db, seed: seed, migrations: migrations}
 }
 
 func (d *Manager) Create(rootName, rootPassword string) error {
@@ -25,14 +35,6 @@ func (d *Manager) Create(rootName, rootPassword string) error {
 	return nil
 }
 
-func (d *Manager) Migrate() error {
-	if err := d.db.Migrate(); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (d *Manager) Drop(rootName, rootPassword string) error {
 	if err := d.db.Drop(rootName, rootPassword); err != nil {
 		return err
@@ -40,11 +42,3 @@ func (d *Manager) Drop(rootName, rootPassword string) error {
 
 	return nil
 }
-
-func (d *Manager) SyncSeeds() error {
-	if err := d.db.SyncSeeds(); err != nil {
-		return err
-	}
-
-	return nil
-}
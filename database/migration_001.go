@@ -0,0 +1,84 @@
+package database
+
+import "github.com/solher/arangolite"
+
+var (
+	initialCollections = []string{
+		"resetTokens",
+		"verificationTokens",
+		"twoFactorChallenges",
+		"sessions",
+		"sessionRevocations",
+	}
+
+	initialIndexes = []arangolite.Runnable{
+		&arangolite.CreateHashIndex{
+			CollectionName: "users",
+			Fields:         []string{"email"},
+			Unique:         true,
+		},
+		&arangolite.CreateFullTextIndex{
+			CollectionName: "users",
+			Fields:         []string{"firstName"},
+		},
+		&arangolite.CreateFullTextIndex{
+			CollectionName: "users",
+			Fields:         []string{"lastName"},
+		},
+		&arangolite.CreateFullTextIndex{
+			CollectionName: "users",
+			Fields:         []string{"email"},
+		},
+		&arangolite.CreateHashIndex{
+			CollectionName: "resetTokens",
+			Fields:         []string{"hash"},
+			Unique:         true,
+		},
+		&arangolite.CreateHashIndex{
+			CollectionName: "resetTokens",
+			Fields:         []string{"userKey"},
+		},
+		&arangolite.CreateHashIndex{
+			CollectionName: "verificationTokens",
+			Fields:         []string{"hash"},
+			Unique:         true,
+		},
+		&arangolite.CreateHashIndex{
+			CollectionName: "verificationTokens",
+			Fields:         []string{"userKey"},
+		},
+		&arangolite.CreateHashIndex{
+			CollectionName: "twoFactorChallenges",
+			Fields:         []string{"hash"},
+			Unique:         true,
+		},
+		&arangolite.CreateHashIndex{
+			CollectionName: "twoFactorChallenges",
+			Fields:         []string{"userKey"},
+		},
+		// The local sessions only store the hash of their token.
+		&arangolite.CreateHashIndex{
+			CollectionName: "sessions",
+			Fields:         []string{"token"},
+			Unique:         true,
+		},
+		&arangolite.CreateHashIndex{
+			CollectionName: "sessions",
+			Fields:         []string{"ownerToken"},
+		},
+	}
+)
+
+func init() {
+	up := []arangolite.Runnable{}
+	for _, name := range initialCollections {
+		up = append(up, &arangolite.CreateCollection{Name: name})
+	}
+
+	register(Migration{
+		Version:     1,
+		Name:        "initial_schema",
+		Description: "Creates the collections and the indexes of the users, tokens and sessions.",
+		Up:          append(up, initialIndexes...),
+	})
+}
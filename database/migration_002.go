@@ -0,0 +1,18 @@
+package database
+
+import "github.com/solher/arangolite"
+
+func init() {
+	// The audit trail is append-only: the migration cannot be reverted, as it would drop it.
+	register(Migration{
+		Version:     2,
+		Name:        "audit",
+		Description: "Creates the audit collection and its indexes.",
+		Up: []arangolite.Runnable{
+			&arangolite.CreateCollection{Name: "audit"},
+			&arangolite.CreateHashIndex{CollectionName: "audit", Fields: []string{"target"}},
+			&arangolite.CreateHashIndex{CollectionName: "audit", Fields: []string{"actor"}},
+			&arangolite.CreateSkipListIndex{CollectionName: "audit", Fields: []string{"createdAt"}},
+		},
+	})
+}
@@ -0,0 +1,14 @@
+package database
+
+import "github.com/solher/arangolite"
+
+func init() {
+	register(Migration{
+		Version:     3,
+		Name:        "users_soft_delete",
+		Description: "Indexes the deletion time of the users, so that the purge does not scan the collection.",
+		Up: []arangolite.Runnable{
+			&arangolite.CreateSkipListIndex{CollectionName: "users", Fields: []string{"deletedAt"}},
+		},
+	})
+}
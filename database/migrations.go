@@ -0,0 +1,457 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+const (
+	migrationsCollection = "_migrations"
+	migrationsLockKey    = "lock"
+	// migrationsLockTTL is the duration after which the lock of a crashed runner is broken.
+	migrationsLockTTL = 30 * time.Minute
+)
+
+type (
+	// Runner runs queries against the database.
+	Runner interface {
+		Run(q arangolite.Runnable) ([]byte, error)
+	}
+
+	// Migration is a numbered schema or data change, made of the queries run by Up and
+	// reverted by Down. Down may be nil when the migration cannot be reverted. Content is
+	// derived from the queries on registration, so that the checksum changes with them.
+	Migration struct {
+		Version     int
+		Name        string
+		Description string
+		Content     string
+		Up          []arangolite.Runnable
+		Down        []arangolite.Runnable
+	}
+
+	// MigrationStatus is the state of a registered migration in the database.
+	MigrationStatus struct {
+		Version   int
+		Name      string
+		Checksum  string
+		AppliedAt *time.Time
+		// Whether the migration has been modified or unregistered since it was applied.
+		Modified bool
+	}
+
+	migrationRecord struct {
+		Key       string     `json:"_key"`
+		Version   int        `json:"version"`
+		Name      string     `json:"name"`
+		Checksum  string     `json:"checksum"`
+		AppliedAt *time.Time `json:"appliedAt"`
+	}
+)
+
+var migrations = []Migration{}
+
+// register adds a migration to the registry. It is meant to be called from the init
+// functions of the files declaring the migrations.
+func register(m Migration) {
+	migrations = registerIn(migrations, m)
+}
+
+func registerIn(registered []Migration, m Migration) []Migration {
+	if len(m.Up) == 0 {
+		panic(fmt.Sprintf("migration %d declares no query", m.Version))
+	}
+
+	for _, r := range registered {
+		if r.Version == m.Version {
+			panic(fmt.Sprintf("migration %d is registered twice", m.Version))
+		}
+	}
+
+	m.Content = migrationContent(m.Up, m.Down)
+
+	registered = append(registered, m)
+
+	sort.Sort(byVersion(registered))
+
+	return registered
+}
+
+// Checksum identifies the migration declaration, so that a migration modified or
+// renumbered after being applied can be detected.
+func (m *Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\n%s\n%s", m.Version, m.Name, m.Content)))
+	return hex.EncodeToString(sum[:])
+}
+
+// migrationContent returns the content of a migration from the queries of its Up and Down.
+func migrationContent(up, down []arangolite.Runnable) string {
+	content := []string{}
+
+	for _, q := range up {
+		content = append(content, queryContent(q))
+	}
+
+	content = append(content, "-- down")
+
+	for _, q := range down {
+		content = append(content, queryContent(q))
+	}
+
+	return strings.Join(content, "\n")
+}
+
+// queryContent returns the type and the JSON representation of a query. The AQL and the
+// bind variables of the AQL queries are unexported, so they are printed instead.
+func queryContent(q arangolite.Runnable) string {
+	if aql, ok := q.(*arangolite.Query); ok {
+		return fmt.Sprintf("%#v", *aql)
+	}
+
+	raw, err := json.Marshal(q)
+	if err != nil {
+		panic(err)
+	}
+
+	return fmt.Sprintf("%T%s", q, raw)
+}
+
+// runMigration runs the queries of a migration. The collections may already exist, when
+// created by a previous version of the seed.
+func runMigration(db Runner, queries []arangolite.Runnable) error {
+	for _, q := range queries {
+		_, err := db.Run(q)
+		if _, create := q.(*arangolite.CreateCollection); create && utils.IsDuplicateName(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Status returns the registered migrations with their application date, and the migrations
+// applied in the database but missing from the registry.
+func (d *Manager) Status() ([]MigrationStatus, error) {
+	if err := d.createMigrationsCollection(); err != nil {
+		return nil, err
+	}
+
+	records, err := d.migrationRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationStatuses(d.migrations, records), nil
+}
+
+// MigrateTo applies the pending migrations up to the given version, or all of them when to is 0.
+// The migrations to apply are returned. Nothing is written when dryRun is set.
+func (d *Manager) MigrateTo(to int, dryRun bool) ([]Migration, error) {
+	if !dryRun {
+		if err := d.db.Migrate(); err != nil {
+			return nil, err
+		}
+
+		if err := d.createMigrationsCollection(); err != nil {
+			return nil, err
+		}
+
+		if err := d.lockMigrations(); err != nil {
+			return nil, err
+		}
+		defer d.unlockMigrations()
+	}
+
+	records, err := d.checkedMigrationRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []Migration{}
+
+	for _, m := range d.migrations {
+		if _, ok := records[m.Version]; ok || (to > 0 && m.Version > to) {
+			continue
+		}
+		pending = append(pending, m)
+	}
+
+	if dryRun {
+		return pending, nil
+	}
+
+	for _, m := range pending {
+		if err := runMigration(d.db, m.Up); err != nil {
+			return nil, merry.Prependf(err, "migration %d (%s) failed", m.Version, m.Name)
+		}
+
+		now := time.Now().UTC()
+
+		q := arangolite.NewQuery(`
+			INSERT @record IN @@migrations
+		`).
+			Bind("@migrations", migrationsCollection).
+			Bind("record", &migrationRecord{
+				Key:       fmt.Sprint(m.Version),
+				Version:   m.Version,
+				Name:      m.Name,
+				Checksum:  m.Checksum(),
+				AppliedAt: &now,
+			})
+
+		if _, err := d.db.Run(q); err != nil {
+			return nil, err
+		}
+	}
+
+	return pending, nil
+}
+
+// Rollback reverts the applied migrations with a version greater than to, the most recent first.
+// The migrations to revert are returned. Nothing is written when dryRun is set.
+func (d *Manager) Rollback(to int, dryRun bool) ([]Migration, error) {
+	if !dryRun {
+		if err := d.createMigrationsCollection(); err != nil {
+			return nil, err
+		}
+
+		if err := d.lockMigrations(); err != nil {
+			return nil, err
+		}
+		defer d.unlockMigrations()
+	}
+
+	records, err := d.checkedMigrationRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := []Migration{}
+
+	for i := len(d.migrations) - 1; i >= 0; i-- {
+		m := d.migrations[i]
+		if _, ok := records[m.Version]; !ok || m.Version <= to {
+			continue
+		}
+		if m.Down == nil {
+			return nil, merry.Here(errs.MigrationIrreversible).WithMessagef("migration %d (%s) cannot be reverted", m.Version, m.Name)
+		}
+		reverted = append(reverted, m)
+	}
+
+	if dryRun {
+		return reverted, nil
+	}
+
+	for _, m := range reverted {
+		if err := runMigration(d.db, m.Down); err != nil {
+			return nil, merry.Prependf(err, "migration %d (%s) rollback failed", m.Version, m.Name)
+		}
+
+		q := arangolite.NewQuery(`
+			REMOVE @key IN @@migrations
+		`).
+			Bind("@migrations", migrationsCollection).
+			Bind("key", fmt.Sprint(m.Version))
+
+		if _, err := d.db.Run(q); err != nil {
+			return nil, err
+		}
+	}
+
+	return reverted, nil
+}
+
+func (d *Manager) createMigrationsCollection() error {
+	isSystem := true
+
+	_, err := d.db.Run(&arangolite.CreateCollection{Name: migrationsCollection, IsSystem: &isSystem})
+	if err != nil && !utils.IsDuplicateName(err) {
+		return err
+	}
+
+	return nil
+}
+
+// migrationRecords returns the applied migrations, none if the migrations collection does not exist yet.
+func (d *Manager) migrationRecords() (map[int]migrationRecord, error) {
+	q := arangolite.NewQuery(`
+		FOR m IN @@migrations
+		FILTER m._key != @lock
+		RETURN m
+	`).
+		Bind("@migrations", migrationsCollection).
+		Bind("lock", migrationsLockKey)
+
+	raw, err := d.db.Run(q)
+	if err != nil {
+		if utils.IsCollectionNotFound(err) {
+			return map[int]migrationRecord{}, nil
+		}
+		return nil, err
+	}
+
+	records := []migrationRecord{}
+
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	byVersion := map[int]migrationRecord{}
+	for _, record := range records {
+		byVersion[record.Version] = record
+	}
+
+	return byVersion, nil
+}
+
+// checkedMigrationRecords returns the applied migrations, making sure they all
+// are still registered unchanged.
+func (d *Manager) checkedMigrationRecords() (map[int]migrationRecord, error) {
+	records, err := d.migrationRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkMigrationRecords(d.migrations, records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// migrationStatuses returns the registered migrations with their application date, and the
+// applied migrations missing from the registry.
+func migrationStatuses(registered []Migration, records map[int]migrationRecord) []MigrationStatus {
+	statuses := []MigrationStatus{}
+	unregistered := map[int]migrationRecord{}
+	for version, record := range records {
+		unregistered[version] = record
+	}
+
+	for _, m := range registered {
+		status := MigrationStatus{Version: m.Version, Name: m.Name, Checksum: m.Checksum()}
+
+		if record, ok := unregistered[m.Version]; ok {
+			status.AppliedAt = record.AppliedAt
+			status.Modified = record.Checksum != status.Checksum
+			delete(unregistered, m.Version)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	for _, record := range unregistered {
+		statuses = append(statuses, MigrationStatus{
+			Version:   record.Version,
+			Name:      record.Name,
+			Checksum:  record.Checksum,
+			AppliedAt: record.AppliedAt,
+			Modified:  true,
+		})
+	}
+
+	sort.Sort(statusesByVersion(statuses))
+
+	return statuses
+}
+
+// checkMigrationRecords makes sure the applied migrations all are still registered unchanged.
+func checkMigrationRecords(registered []Migration, records map[int]migrationRecord) error {
+	for version, record := range records {
+		m := findMigration(registered, version)
+		if m == nil {
+			return merry.Here(errs.MigrationUnknown).WithMessagef("applied migration %d (%s) is not registered", version, record.Name)
+		}
+		if m.Checksum() != record.Checksum {
+			return merry.Here(errs.MigrationModified).WithMessagef("migration %d (%s) has been modified since it was applied", version, m.Name)
+		}
+	}
+
+	return nil
+}
+
+// lockMigrations prevents concurrent runners by inserting a lock document, the unique key
+// constraint making the acquisition atomic. Locks older than migrationsLockTTL are broken.
+func (d *Manager) lockMigrations() error {
+	host, _ := os.Hostname()
+
+	q := arangolite.NewQuery(`
+		FOR m IN @@migrations
+		FILTER m._key == @lock && DATE_TIMESTAMP(m.acquiredAt) < DATE_NOW() - @ttl
+		REMOVE m IN @@migrations
+	`).
+		Bind("@migrations", migrationsCollection).
+		Bind("lock", migrationsLockKey).
+		Bind("ttl", int64(migrationsLockTTL/time.Millisecond))
+
+	if _, err := d.db.Run(q); err != nil {
+		return err
+	}
+
+	q = arangolite.NewQuery(`
+		INSERT { _key: @lock, owner: @owner, acquiredAt: @now } IN @@migrations
+	`).
+		Bind("@migrations", migrationsCollection).
+		Bind("lock", migrationsLockKey).
+		Bind("owner", fmt.Sprintf("%s:%d", host, os.Getpid())).
+		Bind("now", time.Now().UTC())
+
+	if _, err := d.db.Run(q); err != nil {
+		if utils.IsUniqueViolation(err) {
+			return merry.Here(errs.MigrationLocked)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (d *Manager) unlockMigrations() error {
+	q := arangolite.NewQuery(`
+		REMOVE @lock IN @@migrations
+	`).
+		Bind("@migrations", migrationsCollection).
+		Bind("lock", migrationsLockKey)
+
+	_, err := d.db.Run(q)
+
+	return err
+}
+
+func findMigration(registered []Migration, version int) *Migration {
+	for i := range registered {
+		if registered[i].Version == version {
+			return &registered[i]
+		}
+	}
+
+	return nil
+}
+
+type byVersion []Migration
+
+func (m byVersion) Len() int           { return len(m) }
+func (m byVersion) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m byVersion) Less(i, j int) bool { return m[i].Version < m[j].Version }
+
+type statusesByVersion []MigrationStatus
+
+func (s statusesByVersion) Len() int           { return len(s) }
+func (s statusesByVersion) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s statusesByVersion) Less(i, j int) bool { return s[i].Version < s[j].Version }
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite"
+
+	"github.com/solher/snakepit-seed/errs"
+)
+
+// fakeArango is a database holding the given migration records and lock, recording the
+// other queries it runs but the creation of the migrations collection.
+type fakeArango struct {
+	records []migrationRecord
+	locked  bool
+	ran     []string
+}
+
+func (db *fakeArango) Run(q arangolite.Runnable) ([]byte, error) {
+	aql, ok := q.(*arangolite.Query)
+	if !ok {
+		if c, create := q.(*arangolite.CreateCollection); !create || c.Name != migrationsCollection {
+			db.ran = append(db.ran, queryContent(q))
+		}
+		return nil, nil
+	}
+
+	query := fmt.Sprintf("%#v", *aql)
+
+	switch {
+	case strings.Contains(query, "FILTER m._key != @lock"):
+		return json.Marshal(db.records)
+	case strings.Contains(query, "INSERT { _key: @lock"):
+		if db.locked {
+			return nil, errors.New("unique constraint violated - in index 0 of type primary over [\"_key\"]")
+		}
+		db.locked = true
+	case strings.Contains(query, "REMOVE @lock"):
+		db.locked = false
+	case strings.Contains(query, "DATE_TIMESTAMP(m.acquiredAt)"):
+	default:
+		db.ran = append(db.ran, query)
+	}
+
+	return nil, nil
+}
+
+func (db *fakeArango) Create(rootName, rootPassword string) error { return nil }
+func (db *fakeArango) Drop(rootName, rootPassword string) error   { return nil }
+func (db *fakeArango) Migrate() error                             { return nil }
+
+func testMigrations() []Migration {
+	registered := []Migration{}
+
+	registered = registerIn(registered, Migration{
+		Version: 2,
+		Name:    "second",
+		Up:      []arangolite.Runnable{&arangolite.CreateCollection{Name: "second"}},
+		Down:    []arangolite.Runnable{&arangolite.DropCollection{Name: "second"}},
+	})
+	registered = registerIn(registered, Migration{
+		Version: 1,
+		Name:    "first",
+		Up:      []arangolite.Runnable{&arangolite.CreateCollection{Name: "first"}},
+	})
+
+	return registered
+}
+
+func appliedRecord(m Migration) migrationRecord {
+	return migrationRecord{Key: fmt.Sprint(m.Version), Version: m.Version, Name: m.Name, Checksum: m.Checksum()}
+}
+
+func TestRegisterMigration(t *testing.T) {
+	registered := testMigrations()
+
+	if registered[0].Version != 1 || registered[1].Version != 2 {
+		t.Errorf("Expected the migrations to be sorted by version, got %+v.", registered)
+	}
+
+	expectPanic := func(name string, m Migration) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s: expected the registration to panic.", name)
+			}
+		}()
+		registerIn(testMigrations(), m)
+	}
+
+	expectPanic("duplicate version", Migration{Version: 1, Up: registered[0].Up})
+	expectPanic("no query", Migration{Version: 3})
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	base := testMigrations()[1]
+
+	changes := map[string]Migration{
+		"up":   {Version: 2, Name: "second", Up: []arangolite.Runnable{&arangolite.CreateCollection{Name: "other"}}, Down: base.Down},
+		"down": {Version: 2, Name: "second", Up: base.Up},
+		"query": {Version: 2, Name: "second", Up: []arangolite.Runnable{
+			arangolite.NewQuery(`FOR u IN users UPDATE u WITH { role: @role } IN users`).Bind("role", "user"),
+		}},
+	}
+
+	for name, m := range changes {
+		changed := registerIn(nil, m)[0]
+		if changed.Checksum() == base.Checksum() {
+			t.Errorf("%s: expected the checksum to change with the queries.", name)
+		}
+	}
+
+	bound := func(role string) Migration {
+		return registerIn(nil, Migration{Version: 2, Name: "second", Up: []arangolite.Runnable{
+			arangolite.NewQuery(`FOR u IN users UPDATE u WITH { role: @role } IN users`).Bind("role", role),
+		}})[0]
+	}
+	user, admin := bound("user"), bound("admin")
+	if user.Checksum() == admin.Checksum() {
+		t.Error("Expected the checksum to change with the bind variables.")
+	}
+}
+
+func TestMigrationsLock(t *testing.T) {
+	db := &fakeArango{locked: true}
+	d := &Manager{db: db, migrations: testMigrations()}
+
+	if _, err := d.MigrateTo(0, false); !merry.Is(err, errs.MigrationLocked) {
+		t.Fatalf("Expected the migrations to be locked, got %v.", err)
+	}
+	if _, err := d.Rollback(0, false); !merry.Is(err, errs.MigrationLocked) {
+		t.Fatalf("Expected the rollbacks to be locked, got %v.", err)
+	}
+	if len(db.ran) > 0 {
+		t.Errorf("Expected no migration to run while locked, ran %v.", db.ran)
+	}
+
+	db.locked = false
+
+	applied, err := d.MigrateTo(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Errorf("Expected the 2 migrations to be applied, got %+v.", applied)
+	}
+	if db.locked {
+		t.Error("Expected the lock to be released.")
+	}
+}
+
+func TestMigrationsStatus(t *testing.T) {
+	registered := testMigrations()
+	modified := appliedRecord(registered[1])
+	modified.Checksum = "modified"
+
+	db := &fakeArango{records: []migrationRecord{
+		appliedRecord(registered[0]),
+		modified,
+		{Key: "3", Version: 3, Name: "unknown", Checksum: "unknown"},
+	}}
+	d := &Manager{db: db, migrations: registered}
+
+	statuses, err := d.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modifiedVersions := []int{}
+	for _, status := range statuses {
+		if status.Modified {
+			modifiedVersions = append(modifiedVersions, status.Version)
+		}
+	}
+	if len(statuses) != 3 || fmt.Sprint(modifiedVersions) != "[2 3]" {
+		t.Errorf("Expected the migrations 2 and 3 to be reported as modified, got %+v.", statuses)
+	}
+
+	if _, err := d.MigrateTo(0, false); !merry.Is(err, errs.MigrationUnknown) && !merry.Is(err, errs.MigrationModified) {
+		t.Errorf("Expected the changed migrations to be refused, got %v.", err)
+	}
+
+	db.records = db.records[:2]
+	if _, err := d.MigrateTo(0, false); !merry.Is(err, errs.MigrationModified) {
+		t.Errorf("Expected the modified migration to be refused, got %v.", err)
+	}
+}
+
+func TestMigrationsRollback(t *testing.T) {
+	registered := testMigrations()
+	db := &fakeArango{records: []migrationRecord{appliedRecord(registered[0]), appliedRecord(registered[1])}}
+	d := &Manager{db: db, migrations: registered}
+
+	if _, err := d.Rollback(0, false); !merry.Is(err, errs.MigrationIrreversible) {
+		t.Fatalf("Expected the first migration to be irreversible, got %v.", err)
+	}
+	if len(db.ran) > 0 {
+		t.Errorf("Expected nothing to be reverted, ran %v.", db.ran)
+	}
+
+	reverted, err := d.Rollback(1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 2 || len(db.ran) > 0 {
+		t.Errorf("Expected the dry run to only list the migration 2, got %+v and ran %v.", reverted, db.ran)
+	}
+
+	if _, err := d.Rollback(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.ran) != 2 || db.ran[0] != queryContent(registered[1].Down[0]) || !strings.Contains(db.ran[1], "REMOVE @key") {
+		t.Errorf("Expected the migration 2 to be reverted and unrecorded, ran %v.", db.ran)
+	}
+}
@@ -1,6 +1,10 @@
 package database
 
 import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/ansel1/merry"
 	"github.com/solher/snakepit-seed/constants"
 	"github.com/solher/snakepit-seed/utils"
 	"github.com/spf13/viper"
@@ -17,24 +21,53 @@ func NewEmptyProdSeed() *ProdSeed {
 	return &ProdSeed{}
 }
 
-func NewProdSeed() *ProdSeed {
+// NewProdSeed returns the production seed, bootstrapping an admin with the given credentials.
+// The admin must change its password at first login when mustChangePassword is set.
+func NewProdSeed(adminEmail, adminPassword string, mustChangePassword bool) (*ProdSeed, error) {
 	s := NewEmptyProdSeed()
 
-	enc, _ := bcrypt.GenerateFromPassword([]byte("admin"), 11)
+	enc, err := bcrypt.GenerateFromPassword([]byte(adminPassword), 11)
+	if err != nil {
+		return nil, merry.Here(err)
+	}
 
 	s.Users = append(s.Users, []models.User{
 		{
-			Document:   models.NewDocument("", "", "admin"),
-			FirstName:  "admin",
-			LastName:   "admin",
-			Email:      "admin",
-			OwnerToken: utils.GenToken(32),
-			Password:   string(enc),
-			Role:       constants.RoleAdmin,
+			Document:           models.NewDocument("", "", "admin"),
+			FirstName:          "admin",
+			LastName:           "admin",
+			Email:              adminEmail,
+			EmailVerified:      true,
+			OwnerToken:         utils.GenToken(32),
+			Password:           string(enc),
+			MustChangePassword: mustChangePassword,
+			Role:               constants.RoleAdmin,
 		},
 	}...)
 
-	return s
+	return s, nil
+}
+
+// AdminCredentials returns the bootstrap admin credentials from the config. The password is read
+// from the password file when one is set. Without configured password, a random one-time password
+// is generated and generated is true.
+func AdminCredentials(v *viper.Viper) (email, password string, generated bool, err error) {
+	email = v.GetString(constants.AdminEmail)
+	password = v.GetString(constants.AdminPassword)
+
+	if file := v.GetString(constants.AdminPasswordFile); file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", "", false, merry.Here(err)
+		}
+		password = strings.TrimSpace(string(content))
+	}
+
+	if password == "" {
+		return email, utils.GenToken(20), true, nil
+	}
+
+	return email, password, false, nil
 }
 
 func (s *ProdSeed) PopulateConstants(v *viper.Viper) {
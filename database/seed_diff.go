@@ -0,0 +1,309 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite"
+
+	"github.com/solher/snakepit-seed/utils"
+)
+
+const seedsCollection = "_seeds"
+
+const (
+	SeedAdded   = "added"
+	SeedChanged = "changed"
+	SeedRemoved = "removed"
+)
+
+type (
+	// SeedChange is a difference between the local seed and the database for a document.
+	SeedChange struct {
+		Collection string
+		Key        string
+		Kind       string
+		// The top level fields which differ, for changed documents.
+		Fields []string
+		// The local version of the document, nil for removed documents.
+		Document map[string]interface{}
+	}
+
+	// seedCollection is a collection declared by a slice field of the seed. The documents of the
+	// fields tagged with check:"keyOnly" are only compared by key, so that they can be modified
+	// once seeded.
+	seedCollection struct {
+		Name      string
+		KeyOnly   bool
+		Documents []map[string]interface{}
+	}
+
+	seedRecord struct {
+		Key  string   `json:"_key"`
+		Keys []string `json:"keys"`
+	}
+)
+
+// DiffSeeds compares the local seed with the database, per collection and per key. The documents
+// previously seeded but no longer in the local seed are reported as removed.
+func (d *Manager) DiffSeeds() ([]SeedChange, error) {
+	if err := d.createSeedsCollection(); err != nil {
+		return nil, err
+	}
+
+	return diffSeeds(d.seed, d)
+}
+
+// seedsSource reads the seeded keys and the documents of the database.
+type seedsSource interface {
+	seededKeys(collection string) ([]string, error)
+	distantDocuments(collection string, keys []string) (map[string]map[string]interface{}, error)
+}
+
+func diffSeeds(seed interface{}, source seedsSource) ([]SeedChange, error) {
+	collections, err := seedCollections(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []SeedChange{}
+
+	for _, c := range collections {
+		local := map[string]map[string]interface{}{}
+		keys := []string{}
+
+		for _, doc := range c.Documents {
+			key, _ := doc["_key"].(string)
+			local[key] = doc
+			keys = append(keys, key)
+		}
+
+		seeded, err := source.seededKeys(c.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		distant, err := source.distantDocuments(c.Name, append(keys, seeded...))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			doc, ok := distant[key]
+			switch {
+			case !ok:
+				changes = append(changes, SeedChange{Collection: c.Name, Key: key, Kind: SeedAdded, Document: local[key]})
+			case !c.KeyOnly:
+				if fields := diffFields(local[key], doc); len(fields) > 0 {
+					changes = append(changes, SeedChange{Collection: c.Name, Key: key, Kind: SeedChanged, Fields: fields, Document: local[key]})
+				}
+			}
+		}
+
+		for _, key := range seeded {
+			if _, ok := local[key]; ok {
+				continue
+			}
+			if _, ok := distant[key]; ok {
+				changes = append(changes, SeedChange{Collection: c.Name, Key: key, Kind: SeedRemoved})
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// SyncSeeds applies the differences between the local seed and the database, and returns them.
+// Nothing is applied when dryRun is set.
+func (d *Manager) SyncSeeds(dryRun bool) ([]SeedChange, error) {
+	changes, err := d.DiffSeeds()
+	if err != nil || dryRun {
+		return changes, err
+	}
+
+	for _, change := range changes {
+		var q *arangolite.Query
+
+		switch change.Kind {
+		case SeedAdded:
+			q = arangolite.NewQuery(`INSERT @doc IN @@collection`).Bind("doc", change.Document)
+		case SeedChanged:
+			q = arangolite.NewQuery(`REPLACE @doc IN @@collection`).Bind("doc", change.Document)
+		case SeedRemoved:
+			q = arangolite.NewQuery(`REMOVE @key IN @@collection`).Bind("key", change.Key)
+		}
+
+		if _, err := d.db.Run(q.Bind("@collection", change.Collection)); err != nil {
+			return nil, err
+		}
+	}
+
+	collections, err := seedCollections(d.seed)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range collections {
+		record := &seedRecord{Key: c.Name, Keys: []string{}}
+		for _, doc := range c.Documents {
+			key, _ := doc["_key"].(string)
+			record.Keys = append(record.Keys, key)
+		}
+
+		q := arangolite.NewQuery(`
+			UPSERT { _key: @record._key }
+			INSERT @record
+			REPLACE @record
+			IN @@seeds
+		`).
+			Bind("@seeds", seedsCollection).
+			Bind("record", record)
+
+		if _, err := d.db.Run(q); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// FormatSeedChange describes a change in a diff like way.
+func FormatSeedChange(change *SeedChange) string {
+	switch change.Kind {
+	case SeedAdded:
+		return "+ " + change.Collection + "/" + change.Key
+	case SeedChanged:
+		return "~ " + change.Collection + "/" + change.Key + " (" + strings.Join(change.Fields, ", ") + ")"
+	default:
+		return "- " + change.Collection + "/" + change.Key
+	}
+}
+
+func (d *Manager) createSeedsCollection() error {
+	isSystem := true
+
+	_, err := d.db.Run(&arangolite.CreateCollection{Name: seedsCollection, IsSystem: &isSystem})
+	if err != nil && !utils.IsDuplicateName(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (d *Manager) seededKeys(collection string) ([]string, error) {
+	q := arangolite.NewQuery(`
+		FOR s IN @@seeds
+		FILTER s._key == @collection
+		RETURN s
+	`).
+		Bind("@seeds", seedsCollection).
+		Bind("collection", collection)
+
+	raw, err := d.db.Run(q)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []seedRecord{}
+
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	return records[0].Keys, nil
+}
+
+func (d *Manager) distantDocuments(collection string, keys []string) (map[string]map[string]interface{}, error) {
+	q := arangolite.NewQuery(`
+		FOR d IN @@collection
+		FILTER d._key IN @keys
+		RETURN d
+	`).
+		Bind("@collection", collection).
+		Bind("keys", keys)
+
+	raw, err := d.db.Run(q)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := []map[string]interface{}{}
+
+	if err := json.Unmarshal(raw, &docs); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	byKey := map[string]map[string]interface{}{}
+	for _, doc := range docs {
+		key, _ := doc["_key"].(string)
+		byKey[key] = doc
+	}
+
+	return byKey, nil
+}
+
+// seedCollections lists the collections of a seed, named after its slice fields.
+func seedCollections(seed interface{}) ([]seedCollection, error) {
+	v := reflect.Indirect(reflect.ValueOf(seed))
+	t := v.Type()
+
+	collections := []seedCollection{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type.Kind() != reflect.Slice {
+			continue
+		}
+
+		m, err := json.Marshal(v.Field(i).Interface())
+		if err != nil {
+			return nil, merry.Here(err)
+		}
+
+		docs := []map[string]interface{}{}
+
+		if err := json.Unmarshal(m, &docs); err != nil {
+			return nil, merry.Here(err)
+		}
+
+		collections = append(collections, seedCollection{
+			Name:      strings.ToLower(field.Name[:1]) + field.Name[1:],
+			KeyOnly:   field.Tag.Get("check") == "keyOnly",
+			Documents: docs,
+		})
+	}
+
+	return collections, nil
+}
+
+// diffFields returns the top level fields of the local document differing in the distant one.
+// The system fields, except the key, are ignored.
+func diffFields(local, distant map[string]interface{}) []string {
+	fields := []string{}
+
+	for field, value := range local {
+		if strings.HasPrefix(field, "_") {
+			continue
+		}
+		if !reflect.DeepEqual(value, distant[field]) {
+			fields = append(fields, field)
+		}
+	}
+
+	for field := range distant {
+		if _, ok := local[field]; !ok && !strings.HasPrefix(field, "_") {
+			fields = append(fields, field)
+		}
+	}
+
+	sort.Strings(fields)
+
+	return fields
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+type (
+	diffSeed struct {
+		Users    []map[string]interface{} `check:"keyOnly"`
+		Settings []map[string]interface{}
+	}
+
+	// fakeSeedsSource is a database holding the given documents and seeded keys, per collection.
+	fakeSeedsSource struct {
+		seeded    map[string][]string
+		documents map[string][]map[string]interface{}
+	}
+)
+
+func (s *fakeSeedsSource) seededKeys(collection string) ([]string, error) {
+	return s.seeded[collection], nil
+}
+
+func (s *fakeSeedsSource) distantDocuments(collection string, keys []string) (map[string]map[string]interface{}, error) {
+	wanted := map[string]bool{}
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	byKey := map[string]map[string]interface{}{}
+	for _, doc := range s.documents[collection] {
+		if key, _ := doc["_key"].(string); wanted[key] {
+			byKey[key] = doc
+		}
+	}
+
+	return byKey, nil
+}
+
+func TestDiffSeeds(t *testing.T) {
+	seed := &diffSeed{
+		Users: []map[string]interface{}{
+			{"_key": "admin", "email": "admin@localhost"},
+			{"_key": "new", "email": "new@localhost"},
+		},
+		Settings: []map[string]interface{}{
+			{"_key": "same", "value": "a"},
+			{"_key": "changed", "value": "b", "label": "l"},
+			{"_key": "missing", "value": "c"},
+		},
+	}
+
+	source := &fakeSeedsSource{
+		seeded: map[string][]string{
+			"users":    {"admin", "former"},
+			"settings": {"same", "changed", "dropped", "deleted"},
+		},
+		documents: map[string][]map[string]interface{}{
+			"users": {
+				// Only compared by key, so that the seeded users can then be modified.
+				{"_key": "admin", "_rev": "1", "email": "changed@localhost"},
+				{"_key": "former", "email": "former@localhost"},
+			},
+			"settings": {
+				{"_key": "same", "_rev": "1", "value": "a"},
+				{"_key": "changed", "_rev": "1", "value": "x", "extra": true},
+				{"_key": "dropped", "value": "d"},
+				// Not seeded, so never reported.
+				{"_key": "other", "value": "e"},
+			},
+		},
+	}
+
+	changes, err := diffSeeds(seed, source)
+	if err != nil {
+		t.Fatalf("Could not diff the seeds: %v", err)
+	}
+
+	type change struct {
+		collection, key, kind string
+		fields                []string
+	}
+
+	expected := []change{
+		{"users", "new", SeedAdded, nil},
+		{"users", "former", SeedRemoved, nil},
+		{"settings", "changed", SeedChanged, []string{"extra", "label", "value"}},
+		{"settings", "missing", SeedAdded, nil},
+		{"settings", "dropped", SeedRemoved, nil},
+	}
+
+	got := []change{}
+	for _, c := range changes {
+		got = append(got, change{c.Collection, c.Key, c.Kind, c.Fields})
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the changes %v, got %v.", expected, got)
+	}
+
+	for _, c := range changes {
+		if c.Kind == SeedAdded && c.Document == nil {
+			t.Errorf("Expected the added document %s/%s to be returned.", c.Collection, c.Key)
+		}
+		if c.Kind == SeedRemoved && c.Document != nil {
+			t.Errorf("Expected no document for the removed %s/%s.", c.Collection, c.Key)
+		}
+	}
+}
+
+func TestDiffSeedsInSync(t *testing.T) {
+	seed := &diffSeed{
+		Settings: []map[string]interface{}{{"_key": "same", "value": "a"}},
+	}
+
+	source := &fakeSeedsSource{
+		seeded:    map[string][]string{"settings": {"same"}},
+		documents: map[string][]map[string]interface{}{"settings": {{"_key": "same", "_id": "settings/same", "value": "a"}}},
+	}
+
+	changes, err := diffSeeds(seed, source)
+	if err != nil {
+		t.Fatalf("Could not diff the seeds: %v", err)
+	}
+
+	if len(changes) != 0 {
+		t.Errorf("Expected no change, got %v.", changes)
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+func init() {
+	registerSQL(SQLMigration{
+		Version:     1,
+		Name:        "initial_schema",
+		Description: "Creates the tables and the indexes of the users, tokens and session revocations.",
+		Up: []string{
+			`CREATE TABLE "users" (
+				"key" TEXT PRIMARY KEY,
+				"rev" TEXT NOT NULL,
+				"first_name" TEXT,
+				"last_name" TEXT,
+				"email" TEXT,
+				"email_verified" BOOLEAN,
+				"email_verified_at" TIMESTAMP,
+				"owner_token" TEXT,
+				"password" TEXT,
+				"must_change_password" BOOLEAN,
+				"role" TEXT,
+				"two_factor_enabled" BOOLEAN,
+				"two_factor_secret" TEXT,
+				"two_factor_pending_secret" TEXT,
+				"two_factor_last_counter" BIGINT,
+				"recovery_codes" TEXT
+			)`,
+			`CREATE UNIQUE INDEX "users_email" ON "users" ("email")`,
+			`CREATE TABLE "reset_tokens" (
+				"hash" TEXT PRIMARY KEY,
+				"user_key" TEXT NOT NULL,
+				"email" TEXT,
+				"expires_at" TIMESTAMP,
+				"used" BOOLEAN NOT NULL
+			)`,
+			`CREATE INDEX "reset_tokens_user_key" ON "reset_tokens" ("user_key")`,
+			`CREATE TABLE "verification_tokens" (
+				"hash" TEXT PRIMARY KEY,
+				"user_key" TEXT NOT NULL,
+				"email" TEXT,
+				"expires_at" TIMESTAMP,
+				"used" BOOLEAN NOT NULL
+			)`,
+			`CREATE INDEX "verification_tokens_user_key" ON "verification_tokens" ("user_key")`,
+			`CREATE TABLE "two_factor_challenges" (
+				"hash" TEXT PRIMARY KEY,
+				"user_key" TEXT NOT NULL,
+				"email" TEXT,
+				"expires_at" TIMESTAMP,
+				"used" BOOLEAN NOT NULL
+			)`,
+			`CREATE INDEX "two_factor_challenges_user_key" ON "two_factor_challenges" ("user_key")`,
+			`CREATE TABLE "session_revocations" (
+				"key" TEXT PRIMARY KEY,
+				"owner_tokens" TEXT NOT NULL,
+				"attempts" INTEGER NOT NULL,
+				"next_attempt" TIMESTAMP,
+				"last_error" TEXT
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE "session_revocations"`,
+			`DROP TABLE "two_factor_challenges"`,
+			`DROP TABLE "verification_tokens"`,
+			`DROP TABLE "reset_tokens"`,
+			`DROP TABLE "users"`,
+		},
+	})
+}
@@ -0,0 +1,31 @@
+package database
+
+func init() {
+	// The audit trail is append-only: the migration cannot be reverted, the table only being
+	// dropped along with the whole schema.
+	registerSQL(SQLMigration{
+		Version:     2,
+		Name:        "audit",
+		Description: "Creates the audit table and its indexes.",
+		Up: []string{
+			`CREATE TABLE "audit" (
+				"key" TEXT PRIMARY KEY,
+				"action" TEXT NOT NULL,
+				"actor" TEXT,
+				"target" TEXT,
+				"before" TEXT,
+				"after" TEXT,
+				"request_id" TEXT,
+				"ip" TEXT,
+				"user_agent" TEXT,
+				"created_at" TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX "audit_target" ON "audit" ("target")`,
+			`CREATE INDEX "audit_actor" ON "audit" ("actor")`,
+			`CREATE INDEX "audit_created_at" ON "audit" ("created_at")`,
+		},
+		Drop: []string{
+			`DROP TABLE "audit"`,
+		},
+	})
+}
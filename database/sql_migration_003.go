@@ -0,0 +1,19 @@
+package database
+
+func init() {
+	registerSQL(SQLMigration{
+		Version:     3,
+		Name:        "users_soft_delete",
+		Description: "Adds the deletion time and author of the users.",
+		Up: []string{
+			`ALTER TABLE "users" ADD COLUMN "deleted_at" TIMESTAMP`,
+			`ALTER TABLE "users" ADD COLUMN "deleted_by" TEXT`,
+			`CREATE INDEX "users_deleted_at" ON "users" ("deleted_at")`,
+		},
+		Down: []string{
+			`DROP INDEX "users_deleted_at"`,
+			`ALTER TABLE "users" DROP COLUMN "deleted_by"`,
+			`ALTER TABLE "users" DROP COLUMN "deleted_at"`,
+		},
+	})
+}
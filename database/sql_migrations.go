@@ -0,0 +1,354 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/stores"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+const sqlMigrationsTable = "schema_migrations"
+
+// errDryRun rolls back the transactions of the dry runs.
+var errDryRun = errors.New("dry run")
+
+// SQLMigration is a numbered change of the SQL schema. Its statements must run on both
+// PostgreSQL and SQLite. Down may be nil when the migration cannot be reverted, in which
+// case Drop removes what Up created when the whole schema is dropped.
+type SQLMigration struct {
+	Version     int
+	Name        string
+	Description string
+	Up          []string
+	Down        []string
+	Drop        []string
+}
+
+var sqlMigrations = []SQLMigration{}
+
+// registerSQL adds a migration to the SQL registry. It is meant to be called from the init
+// functions of the files declaring the migrations.
+func registerSQL(m SQLMigration) {
+	for _, registered := range sqlMigrations {
+		if registered.Version == m.Version {
+			panic(fmt.Sprintf("SQL migration %d is registered twice", m.Version))
+		}
+	}
+
+	sqlMigrations = append(sqlMigrations, m)
+
+	sort.Sort(sqlByVersion(sqlMigrations))
+}
+
+// info returns the migration as listed by the commands, its statements being its content.
+func (m *SQLMigration) info() Migration {
+	return Migration{
+		Version:     m.Version,
+		Name:        m.Name,
+		Description: m.Description,
+		Content:     strings.Join(m.Up, ";\n") + "\n-- down\n" + strings.Join(m.Down, ";\n") + "\n-- drop\n" + strings.Join(m.Drop, ";\n"),
+	}
+}
+
+// SQLManager manages the schema and the seeds of a PostgreSQL or SQLite database.
+type SQLManager struct {
+	db   *stores.SQL
+	seed *ProdSeed
+}
+
+func NewSQLManager(db *stores.SQL, seed *ProdSeed) *SQLManager {
+	return &SQLManager{db: db, seed: seed}
+}
+
+// Create creates the schema by applying all the migrations. The database itself is the one
+// of the DSN and must exist, the root credentials are not used.
+func (d *SQLManager) Create(rootName, rootPassword string) error {
+	_, err := d.MigrateTo(0, false)
+	return err
+}
+
+// Drop reverts all the applied migrations, the irreversible ones included, and removes
+// the tables of the migrations and the seeds.
+func (d *SQLManager) Drop(rootName, rootPassword string) error {
+	return d.transaction(false, func(tx *sql.Tx) error {
+		if err := d.createMigrationsTable(tx); err != nil {
+			return err
+		}
+
+		records, err := d.migrationRecords(tx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(sqlMigrations) - 1; i >= 0; i-- {
+			m := sqlMigrations[i]
+			if _, ok := records[m.Version]; !ok {
+				continue
+			}
+
+			statements := m.Down
+			if statements == nil {
+				statements = m.Drop
+			}
+
+			if err := d.exec(tx, statements); err != nil {
+				return merry.Prependf(err, "migration %d (%s) drop failed", m.Version, m.Name)
+			}
+		}
+
+		for _, table := range []string{sqlMigrationsTable, sqlSeedsTable} {
+			if _, err := tx.Exec(`DROP TABLE IF EXISTS "` + table + `"`); err != nil {
+				return merry.Here(err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Status returns the registered migrations with their application date, and the migrations
+// applied in the database but missing from the registry.
+func (d *SQLManager) Status() ([]MigrationStatus, error) {
+	if err := d.createMigrationsTable(d.db.DB); err != nil {
+		return nil, err
+	}
+
+	records, err := d.migrationRecords(d.db.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationStatuses(d.registered(), records), nil
+}
+
+// MigrateTo applies the pending migrations up to the given version, or all of them when to is 0.
+// The migrations to apply are returned. Nothing is written when dryRun is set.
+// The migrations run in a single transaction: a concurrent runner fails on the unique version
+// of the applied migrations, without leaving a partial schema.
+func (d *SQLManager) MigrateTo(to int, dryRun bool) ([]Migration, error) {
+	pending := []Migration{}
+
+	err := d.transaction(dryRun, func(tx *sql.Tx) error {
+		if err := d.createMigrationsTable(tx); err != nil {
+			return err
+		}
+
+		records, err := d.checkedMigrationRecords(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range sqlMigrations {
+			if _, ok := records[m.Version]; ok || (to > 0 && m.Version > to) {
+				continue
+			}
+
+			pending = append(pending, m.info())
+
+			if dryRun {
+				continue
+			}
+
+			if err := d.exec(tx, m.Up); err != nil {
+				return merry.Prependf(err, "migration %d (%s) failed", m.Version, m.Name)
+			}
+
+			info := m.info()
+
+			_, err := tx.Exec(
+				d.db.Rebind(`INSERT INTO "`+sqlMigrationsTable+`" ("version", "name", "checksum", "applied_at") VALUES (?, ?, ?, ?)`),
+				m.Version, m.Name, info.Checksum(), time.Now().UTC(),
+			)
+			if err != nil {
+				if utils.IsSQLUniqueViolation(err) {
+					return merry.Here(errs.MigrationLocked)
+				}
+				return merry.Here(err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+// Rollback reverts the applied migrations with a version greater than to, the most recent first.
+// The migrations to revert are returned. Nothing is written when dryRun is set.
+func (d *SQLManager) Rollback(to int, dryRun bool) ([]Migration, error) {
+	reverted := []Migration{}
+
+	err := d.transaction(dryRun, func(tx *sql.Tx) error {
+		if err := d.createMigrationsTable(tx); err != nil {
+			return err
+		}
+
+		records, err := d.checkedMigrationRecords(tx)
+		if err != nil {
+			return err
+		}
+
+		reverting := []SQLMigration{}
+
+		for i := len(sqlMigrations) - 1; i >= 0; i-- {
+			m := sqlMigrations[i]
+			if _, ok := records[m.Version]; !ok || m.Version <= to {
+				continue
+			}
+			if m.Down == nil {
+				return merry.Here(errs.MigrationIrreversible).WithMessagef("migration %d (%s) cannot be reverted", m.Version, m.Name)
+			}
+			reverting = append(reverting, m)
+			reverted = append(reverted, m.info())
+		}
+
+		if dryRun {
+			return nil
+		}
+
+		for _, m := range reverting {
+			if err := d.exec(tx, m.Down); err != nil {
+				return merry.Prependf(err, "migration %d (%s) rollback failed", m.Version, m.Name)
+			}
+
+			query := d.db.Rebind(`DELETE FROM "` + sqlMigrationsTable + `" WHERE "version" = ?`)
+
+			if _, err := tx.Exec(query, m.Version); err != nil {
+				return merry.Here(err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reverted, nil
+}
+
+// transaction runs fn in a transaction, always rolled back in a dry run. Both PostgreSQL and SQLite
+// have transactional DDL, so the dry runs can create the migrations table without keeping it.
+func (d *SQLManager) transaction(dryRun bool, fn func(tx *sql.Tx) error) error {
+	err := d.db.Transaction(func(tx *sql.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+	if err == errDryRun {
+		return nil
+	}
+
+	return err
+}
+
+func (d *SQLManager) createMigrationsTable(db sqlQuerier) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS "` + sqlMigrationsTable + `" (
+		"version" INTEGER PRIMARY KEY,
+		"name" TEXT NOT NULL,
+		"checksum" TEXT NOT NULL,
+		"applied_at" TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
+
+func (d *SQLManager) migrationRecords(db sqlQuerier) (map[int]migrationRecord, error) {
+	rows, err := db.Query(`SELECT "version", "name", "checksum", "applied_at" FROM "` + sqlMigrationsTable + `"`)
+	if err != nil {
+		return nil, merry.Here(err)
+	}
+	defer rows.Close()
+
+	records := map[int]migrationRecord{}
+
+	for rows.Next() {
+		var (
+			record    migrationRecord
+			appliedAt time.Time
+		)
+
+		if err := rows.Scan(&record.Version, &record.Name, &record.Checksum, &appliedAt); err != nil {
+			return nil, merry.Here(err)
+		}
+
+		appliedAt = appliedAt.UTC()
+		record.AppliedAt = &appliedAt
+		record.Key = fmt.Sprint(record.Version)
+
+		records[record.Version] = record
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	return records, nil
+}
+
+// checkedMigrationRecords returns the applied migrations, making sure they all
+// are still registered unchanged.
+func (d *SQLManager) checkedMigrationRecords(db sqlQuerier) (map[int]migrationRecord, error) {
+	records, err := d.migrationRecords(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkMigrationRecords(d.registered(), records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (d *SQLManager) registered() []Migration {
+	registered := []Migration{}
+
+	for _, m := range sqlMigrations {
+		registered = append(registered, m.info())
+	}
+
+	return registered
+}
+
+func (d *SQLManager) exec(tx *sql.Tx, statements []string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return merry.Here(err)
+		}
+	}
+
+	return nil
+}
+
+// sqlQuerier is implemented by both *sql.DB and *sql.Tx.
+type sqlQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type sqlByVersion []SQLMigration
+
+func (m sqlByVersion) Len() int           { return len(m) }
+func (m sqlByVersion) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m sqlByVersion) Less(i, j int) bool { return m[i].Version < m[j].Version }
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ansel1/merry"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/stores"
+)
+
+func newSQLManager(t *testing.T) *SQLManager {
+	db, err := stores.NewSQL(stores.SQLDriverSQLite, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSQLManager(db, nil)
+}
+
+// appliedVersions returns the applied versions among the statuses.
+func appliedVersions(t *testing.T, d *SQLManager) []int {
+	statuses, err := d.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions := []int{}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			versions = append(versions, status.Version)
+		}
+	}
+
+	return versions
+}
+
+// hasColumn reports whether the column exists. The names are not quoted, as SQLite takes
+// the quoted names of missing columns for strings.
+func hasColumn(d *SQLManager, table, column string) bool {
+	_, err := d.db.DB.Exec(`SELECT ` + column + ` FROM ` + table)
+	return err == nil
+}
+
+func TestSQLMigrations(t *testing.T) {
+	d := newSQLManager(t)
+	defer d.db.Close()
+
+	pending, err := d.MigrateTo(0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != len(sqlMigrations) || len(appliedVersions(t, d)) != 0 {
+		t.Fatalf("Expected the dry run to list all the migrations without applying them, got %+v.", pending)
+	}
+
+	if _, err := d.MigrateTo(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if versions := appliedVersions(t, d); len(versions) != 1 || versions[0] != 1 {
+		t.Fatalf("Expected the migration 1 to be applied, got %v.", versions)
+	}
+
+	if _, err := d.MigrateTo(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if versions := appliedVersions(t, d); len(versions) != len(sqlMigrations) {
+		t.Fatalf("Expected all the migrations to be applied, got %v.", versions)
+	}
+
+	// The audit migration cannot be reverted: nothing is reverted.
+	if _, err := d.Rollback(0, false); !merry.Is(err, errs.MigrationIrreversible) {
+		t.Fatalf("Expected the audit migration to be irreversible, got %v.", err)
+	}
+	if !hasColumn(d, "users", "deleted_at") || !hasColumn(d, "audit", "key") {
+		t.Fatal("Expected the failed rollback not to revert anything.")
+	}
+
+	reverted, err := d.Rollback(2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 3 || hasColumn(d, "users", "deleted_at") {
+		t.Errorf("Expected the migration 3 to be reverted, got %+v.", reverted)
+	}
+
+	if err := d.Drop("", ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"users", "audit", sqlMigrationsTable} {
+		if hasColumn(d, table, "key") || hasColumn(d, table, "version") {
+			t.Errorf("Expected the table %s to be dropped.", table)
+		}
+	}
+}
+
+func TestSQLMigrationsModified(t *testing.T) {
+	d := newSQLManager(t)
+	defer d.db.Close()
+
+	if _, err := d.MigrateTo(1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.db.DB.Exec(`UPDATE "` + sqlMigrationsTable + `" SET "checksum" = 'modified'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.MigrateTo(0, false); !merry.Is(err, errs.MigrationModified) {
+		t.Errorf("Expected the modified migration to be refused, got %v.", err)
+	}
+
+	if _, err := d.db.DB.Exec(`UPDATE "` + sqlMigrationsTable + `" SET "version" = 99`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Rollback(0, false); !merry.Is(err, errs.MigrationUnknown) {
+		t.Errorf("Expected the unknown migration to be refused, got %v.", err)
+	}
+}
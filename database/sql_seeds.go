@@ -0,0 +1,169 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+const sqlSeedsTable = "schema_seeds"
+
+// DiffSeeds compares the local seed with the database, like Manager.DiffSeeds does.
+// Only the users can be seeded in a SQL database.
+func (d *SQLManager) DiffSeeds() ([]SeedChange, error) {
+	if err := d.createSeedsTable(); err != nil {
+		return nil, err
+	}
+
+	return diffSeeds(d.seed, d)
+}
+
+// SyncSeeds applies the differences between the local seed and the database, and returns them.
+// Nothing is applied when dryRun is set.
+func (d *SQLManager) SyncSeeds(dryRun bool) ([]SeedChange, error) {
+	changes, err := d.DiffSeeds()
+	if err != nil || dryRun {
+		return changes, err
+	}
+
+	for _, change := range changes {
+		filter := &filters.Filter{Where: []map[string]interface{}{{"_key": change.Key}}}
+
+		// The store replacement preserving the protected fields, a changed user is removed then inserted again.
+		if change.Kind != SeedAdded {
+			if _, err := d.db.Users.Delete(filter); err != nil {
+				return nil, err
+			}
+		}
+
+		if change.Kind == SeedRemoved {
+			continue
+		}
+
+		user := models.User{}
+		if err := decodeDocument(change.Document, &user); err != nil {
+			return nil, err
+		}
+
+		if _, err := d.db.Users.Insert([]models.User{user}); err != nil {
+			return nil, err
+		}
+	}
+
+	collections, err := seedCollections(d.seed)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range collections {
+		keys := []string{}
+		for _, doc := range c.Documents {
+			key, _ := doc["_key"].(string)
+			keys = append(keys, key)
+		}
+
+		raw, err := json.Marshal(keys)
+		if err != nil {
+			return nil, merry.Here(err)
+		}
+
+		err = d.db.Transaction(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(d.db.Rebind(`DELETE FROM "`+sqlSeedsTable+`" WHERE "collection" = ?`), c.Name); err != nil {
+				return merry.Here(err)
+			}
+
+			query := d.db.Rebind(`INSERT INTO "` + sqlSeedsTable + `" ("collection", "keys") VALUES (?, ?)`)
+
+			if _, err := tx.Exec(query, c.Name, string(raw)); err != nil {
+				return merry.Here(err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+func (d *SQLManager) createSeedsTable() error {
+	_, err := d.db.DB.Exec(`CREATE TABLE IF NOT EXISTS "` + sqlSeedsTable + `" (
+		"collection" TEXT PRIMARY KEY,
+		"keys" TEXT NOT NULL
+	)`)
+	if err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
+
+func (d *SQLManager) seededKeys(collection string) ([]string, error) {
+	var raw string
+
+	row := d.db.DB.QueryRow(d.db.Rebind(`SELECT "keys" FROM "`+sqlSeedsTable+`" WHERE "collection" = ?`), collection)
+
+	switch err := row.Scan(&raw); {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, merry.Here(err)
+	}
+
+	keys := []string{}
+
+	if err := json.Unmarshal([]byte(raw), &keys); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	return keys, nil
+}
+
+func (d *SQLManager) distantDocuments(collection string, keys []string) (map[string]map[string]interface{}, error) {
+	if collection != "users" {
+		return nil, merry.Errorf("the %s collection cannot be seeded in a SQL database", collection)
+	}
+
+	values := []interface{}{}
+	for _, key := range keys {
+		values = append(values, key)
+	}
+
+	users, err := d.db.Users.Find(&filters.Filter{Where: []map[string]interface{}{{"_key": map[string]interface{}{"in": values}}}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := []map[string]interface{}{}
+	if err := decodeDocument(users, &docs); err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]map[string]interface{}{}
+	for _, doc := range docs {
+		key, _ := doc["_key"].(string)
+		byKey[key] = doc
+	}
+
+	return byKey, nil
+}
+
+// decodeDocument converts between models and their JSON representation.
+func decodeDocument(from, to interface{}) error {
+	raw, err := json.Marshal(from)
+	if err != nil {
+		return merry.Here(err)
+	}
+
+	if err := json.Unmarshal(raw, to); err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
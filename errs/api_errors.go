@@ -8,6 +8,10 @@ var (
 		Description: "Authorization Required.",
 		ErrorCode:   "AUTHORIZATION_REQUIRED",
 	}
+	APIInvalidSignature = snakepit.APIError{
+		Description: "The authentication headers signature is missing or invalid.",
+		ErrorCode:   "INVALID_SIGNATURE",
+	}
 	APIForbidden = snakepit.APIError{
 		Description: "The specified resource was not found or you don't have sufficient permissions.",
 		ErrorCode:   "FORBIDDEN",
@@ -28,4 +32,48 @@ var (
 		Description: "The given filter is invalid.",
 		ErrorCode:   "INVALID_FILTER",
 	}
+	APIInvalidCursor = snakepit.APIError{
+		Description: "The given pagination cursor is invalid.",
+		ErrorCode:   "INVALID_CURSOR",
+	}
+	APIEmailTaken = snakepit.APIError{
+		Description: "The given email is already taken.",
+		ErrorCode:   "EMAIL_TAKEN",
+	}
+	APIInvalidToken = snakepit.APIError{
+		Description: "The given token is invalid, expired or already used.",
+		ErrorCode:   "INVALID_TOKEN",
+	}
+	APIEmailNotVerified = snakepit.APIError{
+		Description: "The user email must be verified before signing in.",
+		ErrorCode:   "EMAIL_NOT_VERIFIED",
+	}
+	APIEmailAlreadyVerified = snakepit.APIError{
+		Description: "The user email is already verified.",
+		ErrorCode:   "EMAIL_ALREADY_VERIFIED",
+	}
+	APITwoFactorAlreadyEnabled = snakepit.APIError{
+		Description: "The two-factor authentication is already enabled.",
+		ErrorCode:   "TWO_FACTOR_ALREADY_ENABLED",
+	}
+	APITwoFactorNotEnabled = snakepit.APIError{
+		Description: "The two-factor authentication is not enabled.",
+		ErrorCode:   "TWO_FACTOR_NOT_ENABLED",
+	}
+	APIInvalidCode = snakepit.APIError{
+		Description: "The given code is invalid or already used.",
+		ErrorCode:   "INVALID_CODE",
+	}
+	APIAccountLocked = snakepit.APIError{
+		Description: "Too many failed sign in attempts. Retry later.",
+		ErrorCode:   "ACCOUNT_LOCKED",
+	}
+	APIPreconditionFailed = snakepit.APIError{
+		Description: "The resource has been modified since the given revision.",
+		ErrorCode:   "PRECONDITION_FAILED",
+	}
+	APIPasswordChangeRequired = snakepit.APIError{
+		Description: "The password must be changed before continuing.",
+		ErrorCode:   "PASSWORD_CHANGE_REQUIRED",
+	}
 )
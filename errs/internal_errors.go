@@ -5,5 +5,26 @@ import "github.com/ansel1/merry"
 var (
 	NotFound      = merry.New("the specified resource was not found or insufficient permissions")
 	InvalidFilter = merry.New("the given query filter is invalid")
+	InvalidCursor = merry.New("the given pagination cursor is invalid")
 	SeedsNotSync  = merry.New("local and distant seeds does not match")
+	EmailTaken    = merry.New("the given email is already taken")
+	InvalidToken  = merry.New("the given token is invalid, expired or already used")
+
+	EmailNotVerified     = merry.New("the user email is not verified")
+	EmailAlreadyVerified = merry.New("the user email is already verified")
+
+	TwoFactorAlreadyEnabled = merry.New("the two-factor authentication is already enabled")
+	TwoFactorNotEnabled     = merry.New("the two-factor authentication is not enabled")
+	InvalidCode             = merry.New("the given code is invalid or already used")
+
+	AccountLocked = merry.New("the account is temporarily locked after too many failed sign in attempts")
+
+	PreconditionFailed = merry.New("the resource has been modified since the given revision")
+
+	PasswordChangeRequired = merry.New("the user must change its password")
+
+	MigrationLocked       = merry.New("the migrations are locked by another runner")
+	MigrationUnknown      = merry.New("an applied migration is not registered")
+	MigrationModified     = merry.New("an applied migration has been modified")
+	MigrationIrreversible = merry.New("the migration cannot be reverted")
 )
@@ -1,12 +1,27 @@
 package errs
 
 const (
-	FieldEmail    = "EMAIL"
-	FieldPassword = "PASSWORD"
-	FieldRole     = "ROLE"
+	FieldEmail     = "EMAIL"
+	FieldPassword  = "PASSWORD"
+	FieldRole      = "ROLE"
+	FieldToken     = "TOKEN"
+	FieldCode      = "CODE"
+	FieldChallenge = "CHALLENGE"
+	FieldBody      = "BODY"
+	FieldQuery     = "QUERY"
 )
 
 const (
 	ValidBlank   = "BLANK"
 	ValidInvalid = "INVALID"
+	ValidTaken   = "TAKEN"
+
+	ValidTooShort      = "TOO_SHORT"
+	ValidTooLong       = "TOO_LONG"
+	ValidMissingUpper  = "MISSING_UPPERCASE"
+	ValidMissingLower  = "MISSING_LOWERCASE"
+	ValidMissingDigit  = "MISSING_DIGIT"
+	ValidMissingSymbol = "MISSING_SYMBOL"
+	ValidCommon        = "TOO_COMMON"
+	ValidContainsEmail = "CONTAINS_EMAIL"
 )
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"gopkg.in/h2non/gentleman.v1"
+
+	"github.com/pressly/chi"
+	"github.com/solher/arangolite/filters"
+	"github.com/solher/snakepit"
+	"github.com/solher/snakepit-seed/controllers"
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/interactors"
+	"github.com/solher/snakepit-seed/middlewares"
+	"github.com/solher/snakepit-seed/repositories"
+	"github.com/solher/snakepit-seed/stores"
+	"github.com/solher/snakepit-seed/validators"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+type (
+	AuditCtrl interface {
+		Find(ctx context.Context, w http.ResponseWriter, r *http.Request)
+	}
+
+	Audit struct {
+		snakepit.Handler
+		DB     DatabaseRunner
+		Memory *stores.Memory
+		SQL    *stores.SQL
+		Client *gentleman.Client
+	}
+)
+
+func NewAudit(
+	c *viper.Viper,
+	j *snakepit.JSON,
+	db DatabaseRunner,
+	m *stores.Memory,
+	s *stores.SQL,
+	cli *gentleman.Client,
+) func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	h := &Audit{
+		Handler: *snakepit.NewHandler(c, j),
+		DB:      db,
+		Memory:  m,
+		SQL:     s,
+		Client:  cli,
+	}
+	return h.builder
+}
+
+func (h *Audit) routes(
+	j *snakepit.JSON,
+	mustChange bool,
+	c AuditCtrl,
+) chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.NewAdminOnly(j))
+	r.Use(newPasswordRotated(j, mustChange))
+
+	r.Get("/", c.Find)
+
+	return r
+}
+
+func (h *Audit) builder(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	filter, err := filters.FromRequest(r)
+	if err != nil {
+		h.JSON.RenderError(ctx, w, http.StatusBadRequest, errs.APIFilterDecoding, err)
+		return
+	}
+
+	logger, _ := snakepit.GetLogger(ctx)
+
+	var store interactors.AuditStore
+
+	switch {
+	case h.Memory != nil:
+		store = h.Memory.Audit
+	case h.SQL != nil:
+		store = h.SQL.Audit
+	default:
+		repo := repositories.NewRepository(
+			h.Constants,
+			logger,
+			h.JSON,
+			h.DB,
+			h.Client,
+		)
+		store = repositories.NewAudit(repo)
+	}
+
+	inter := interactors.NewAudit(h.Constants, logger, store, nil)
+
+	valid := validators.NewAudit(logger)
+
+	filter, err = valid.Filter(filter)
+	if err != nil {
+		apiErr := errs.APIInvalidFilter
+		apiErr.Description = err.Error()
+		h.JSON.RenderError(ctx, w, 422, apiErr, err)
+		return
+	}
+
+	context := &controllers.AuditContext{
+		Filter: filter,
+	}
+
+	ctrl := controllers.NewAudit(
+		h.Constants,
+		logger,
+		h.JSON,
+		context,
+		inter,
+	)
+
+	currentUser, _ := middlewares.GetCurrentUser(ctx)
+	mustChange := mustChangePassword(currentUser)
+
+	subrouter := h.routes(h.JSON, mustChange, ctrl)
+
+	h.LogTime(logger, start)
+
+	subrouter.ServeHTTPC(ctx, w, r)
+}
@@ -0,0 +1,178 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/apptest"
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/models"
+)
+
+func auditFilter(target string, action models.AuditAction) string {
+	m, _ := json.Marshal(map[string]interface{}{
+		"where": []map[string]interface{}{{"target": target, "action": string(action)}},
+	})
+	return "?filter=" + url.QueryEscape(string(m))
+}
+
+func TestAuditRoutes(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	callers := map[string]struct {
+		caller   *apptest.Caller
+		expected int
+	}{
+		"admin":     {f.admin, http.StatusOK},
+		"user":      {f.user, http.StatusForbidden},
+		"anonymous": {f.app.Anonymous(), http.StatusUnauthorized},
+	}
+
+	for name, c := range callers {
+		if res := c.caller.Do("GET", "/audit", nil, nil); res.StatusCode != c.expected {
+			t.Errorf("Expected status %d as %s, got %d.", c.expected, name, res.StatusCode)
+		}
+	}
+
+	m, _ := json.Marshal(map[string]interface{}{"where": []map[string]interface{}{{"before": "x"}}})
+	if res := f.admin.Do("GET", "/audit?filter="+url.QueryEscape(string(m)), nil, nil); res.StatusCode != 422 {
+		t.Errorf("Expected the diffs not to be filterable, got %d.", res.StatusCode)
+	}
+}
+
+func TestAuditEntries(t *testing.T) {
+	apptest.RunBackends(t, testAuditEntries)
+}
+
+func testAuditEntries(t *testing.T, config func() *viper.Viper) {
+	f := newFixture(t, config())
+	defer f.app.Close()
+
+	key := f.target.User.Key
+
+	if res := f.admin.Do("PATCH", "/users/"+key, map[string]interface{}{"firstName": "Patched"}, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+	if res := f.admin.Do("POST", "/users/"+key+"/password", &models.Password{Password: newPassword}, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+	if res := f.admin.Do("DELETE", "/users/"+key, nil, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	find := func(action models.AuditAction) models.AuditEntry {
+		entries := []models.AuditEntry{}
+		if res := f.admin.Do("GET", "/audit"+auditFilter(key, action), nil, &entries); res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("Expected one %s entry, got %d.", action, len(entries))
+		}
+		return entries[0]
+	}
+
+	for _, action := range []models.AuditAction{constants.AuditUserCreate, constants.AuditUserSignin} {
+		if entry := find(action); entry.Actor != "" {
+			t.Errorf("Expected the %s entry to be anonymous, got the %q actor.", action, entry.Actor)
+		}
+	}
+
+	patch := find(constants.AuditUserPatch)
+	if patch.Actor != f.admin.User.Key {
+		t.Errorf("Expected the admin to be the actor, got %q.", patch.Actor)
+	}
+	if patch.After["firstName"] != "Patched" || len(patch.After) != 1 || len(patch.Before) != 0 {
+		t.Errorf("Expected only the first name to be changed, got %v before and %v after.", patch.Before, patch.After)
+	}
+	if patch.RequestID == "" || patch.IP == "" || patch.UserAgent == "" || patch.CreatedAt == nil {
+		t.Errorf("Expected the request to be described, got %+v.", patch)
+	}
+
+	password := find(constants.AuditUserPassword)
+	if password.Before["password"] != "REDACTED" || password.After["password"] != "REDACTED" {
+		t.Errorf("Expected the password change to be redacted, got %v before and %v after.", password.Before, password.After)
+	}
+
+	deleted := find(constants.AuditUserDelete)
+	if len(deleted.Before) != 0 || deleted.After["deletedAt"] == nil || deleted.After["deletedBy"] != f.admin.User.Key {
+		t.Errorf("Expected the soft deletion to be recorded, got %v before and %v after.", deleted.Before, deleted.After)
+	}
+}
+
+func TestAuditFailedSignins(t *testing.T) {
+	apptest.RunBackends(t, testAuditFailedSignins)
+}
+
+func testAuditFailedSignins(t *testing.T, config func() *viper.Viper) {
+	f := newFixture(t, config())
+	defer f.app.Close()
+
+	entries := func(target string, action models.AuditAction) []models.AuditEntry {
+		found := []models.AuditEntry{}
+		if res := f.admin.Do("GET", "/audit"+auditFilter(target, action), nil, &found); res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+		}
+		return found
+	}
+
+	key := f.target.User.Key
+	threshold := f.app.Config.GetInt(constants.LockoutAccountThreshold)
+
+	for i := 0; i < threshold; i++ {
+		if status := signin(t, f, f.target.User.Email, "wrong", ""); status != http.StatusForbidden {
+			t.Fatalf("Expected status %d, got %d.", http.StatusForbidden, status)
+		}
+	}
+
+	failed := entries(key, constants.AuditUserSigninFailed)
+	if len(failed) != threshold {
+		t.Fatalf("Expected %d failed sign ins, got %d.", threshold, len(failed))
+	}
+	if failed[0].Actor != "" || failed[0].IP == "" || failed[0].UserAgent == "" || len(failed[0].Before) != 0 || len(failed[0].After) != 0 {
+		t.Errorf("Expected an anonymous entry describing the request, got %+v.", failed[0])
+	}
+
+	if status := signin(t, f, f.target.User.Email, apptest.Password, ""); status != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d.", http.StatusTooManyRequests, status)
+	}
+	if locked := entries(key, constants.AuditUserSigninLocked); len(locked) != 1 {
+		t.Errorf("Expected the locked sign in to be recorded, got %d entries.", len(locked))
+	}
+
+	m, _ := json.Marshal(map[string]interface{}{
+		"where": []map[string]interface{}{{"action": string(constants.AuditUserSigninFailed)}},
+	})
+	all := []models.AuditEntry{}
+	signin(t, f, "unknown@localhost", "wrong", "")
+	f.admin.Do("GET", "/audit?filter="+url.QueryEscape(string(m)), nil, &all)
+	anonymous := 0
+	for _, entry := range all {
+		if entry.Target == "" {
+			anonymous++
+		}
+	}
+	if len(all) != threshold+1 || anonymous != 1 {
+		t.Errorf("Expected the unknown account to be recorded without target, got %+v.", all)
+	}
+
+	enableTwoFactor(t, f.user)
+	cred := &models.Credentials{Email: f.user.User.Email, Password: apptest.Password}
+
+	challenge := &models.TwoFactorChallenge{}
+	if res := f.app.Anonymous().Do("POST", "/users/signin", cred, challenge); res.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d.", http.StatusAccepted, res.StatusCode)
+	}
+
+	code := &models.TwoFactorSignin{Challenge: challenge.Challenge, Code: "000000"}
+	if res := f.app.Anonymous().Do("POST", "/users/signin/2fa", code, nil); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected status %d, got %d.", http.StatusForbidden, res.StatusCode)
+	}
+	if wrong := entries(f.user.User.Key, constants.AuditUserTwoFactorFailed); len(wrong) != 1 {
+		t.Errorf("Expected the wrong code to be recorded, got %d entries.", len(wrong))
+	}
+}
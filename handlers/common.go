@@ -1,7 +1,37 @@
 package handlers
 
-import "github.com/solher/arangolite"
+import (
+	"net/http"
+
+	"github.com/ansel1/merry"
+	"github.com/pressly/chi"
+	"github.com/solher/arangolite"
+	"github.com/solher/snakepit"
+	"golang.org/x/net/context"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+)
 
 type DatabaseRunner interface {
 	Run(q arangolite.Runnable) ([]byte, error)
 }
+
+// mustChangePassword tells if the current user has to rotate its password. The flag is carried
+// by the session payload, the sessions being revoked when an admin requires a rotation.
+func mustChangePassword(currentUser *models.User) bool {
+	return currentUser != nil && currentUser.MustChangePassword
+}
+
+// newPasswordRotated refuses the requests of the users required to change their password.
+func newPasswordRotated(j *snakepit.JSON, mustChange bool) func(next chi.Handler) chi.Handler {
+	return func(next chi.Handler) chi.Handler {
+		return chi.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			if mustChange {
+				j.RenderError(ctx, w, http.StatusForbidden, errs.APIPasswordChangeRequired, merry.Here(errs.PasswordChangeRequired))
+				return
+			}
+			next.ServeHTTPC(ctx, w, r)
+		})
+	}
+}
@@ -17,6 +17,8 @@ import (
 	"github.com/solher/snakepit-seed/interactors"
 	"github.com/solher/snakepit-seed/middlewares"
 	"github.com/solher/snakepit-seed/repositories"
+	"github.com/solher/snakepit-seed/stores"
+	"github.com/solher/snakepit-seed/utils"
 	"github.com/solher/snakepit-seed/validators"
 	"github.com/spf13/viper"
 	"golang.org/x/net/context"
@@ -26,24 +28,46 @@ type (
 	UsersCtrl interface {
 		Create(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		Find(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		Search(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		Update(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		Delete(ctx context.Context, w http.ResponseWriter, r *http.Request)
 
 		FindByKey(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		UpdateByKey(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		PatchByKey(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		DeleteByKey(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		Restore(ctx context.Context, w http.ResponseWriter, r *http.Request)
 
 		Signup(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		Signin(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		CurrentSession(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		Signout(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		UpdatePassword(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		Unlock(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		ForgotPassword(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		ResetPassword(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		Verify(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		ResendVerification(ctx context.Context, w http.ResponseWriter, r *http.Request)
+
+		SigninTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		EnrollTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		ConfirmTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		DisableTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		RegenerateRecoveryCodes(ctx context.Context, w http.ResponseWriter, r *http.Request)
+
+		FindSessions(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		DeleteSession(ctx context.Context, w http.ResponseWriter, r *http.Request)
+		DeleteSessions(ctx context.Context, w http.ResponseWriter, r *http.Request)
 	}
 
 	Users struct {
 		snakepit.Handler
-		DB     DatabaseRunner
-		Client *gentleman.Client
+		DB       DatabaseRunner
+		Memory   *stores.Memory
+		SQL      *stores.SQL
+		Client   *gentleman.Client
+		Notifier interactors.Notifier
+		Failures interactors.FailuresCounter
 	}
 )
 
@@ -51,12 +75,20 @@ func NewUsers(
 	c *viper.Viper,
 	j *snakepit.JSON,
 	db DatabaseRunner,
+	m *stores.Memory,
+	s *stores.SQL,
 	cli *gentleman.Client,
+	n interactors.Notifier,
+	fc interactors.FailuresCounter,
 ) func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	h := &Users{
-		Handler: *snakepit.NewHandler(c, j),
-		DB:      db,
-		Client:  cli,
+		Handler:  *snakepit.NewHandler(c, j),
+		DB:       db,
+		Memory:   m,
+		SQL:      s,
+		Client:   cli,
+		Notifier: n,
+		Failures: fc,
 	}
 	return h.builder
 }
@@ -70,12 +102,14 @@ func (h *Users) routes(
 
 	r.Route("/", func(r chi.Router) {
 		r.Use(middlewares.NewAdminOnly(j))
+		r.Use(newPasswordRotated(j, ctrlCtx.MustChangePassword))
 
 		// CRUD operations
 		r.Post("/", c.Create)
 		r.Get("/", c.Find)
 		r.Put("/", c.Update)
 		r.Delete("/", c.Delete)
+		r.Get("/search", c.Search)
 
 		// CRUD by key operations
 		r.Route("/:key", func(r chi.Router) {
@@ -88,8 +122,12 @@ func (h *Users) routes(
 
 			r.Get("/", c.FindByKey)
 			r.Put("/", c.UpdateByKey)
+			r.Patch("/", c.PatchByKey)
 			r.Delete("/", c.DeleteByKey)
 			r.Post("/password", c.UpdatePassword)
+			r.Post("/unlock", c.Unlock)
+			r.Post("/restore", c.Restore)
+			r.Route("/sessions", h.sessionsRoutes(ctrlCtx, c))
 		})
 	})
 
@@ -103,25 +141,68 @@ func (h *Users) routes(
 			})
 		})
 
-		r.Get("/", c.FindByKey)
-		r.Put("/", c.UpdateByKey)
-		r.Delete("/", c.DeleteByKey)
-		r.Get("/session", c.CurrentSession)
-		r.Post("/signout", c.Signout)
 		r.Post("/password", c.UpdatePassword)
+		r.Post("/signout", c.Signout)
+
+		// Blocked until the password is rotated when required
+		r.Group(func(r chi.Router) {
+			r.Use(newPasswordRotated(j, ctrlCtx.MustChangePassword))
+
+			r.Get("/", c.FindByKey)
+			r.Put("/", c.UpdateByKey)
+			r.Patch("/", c.PatchByKey)
+			r.Delete("/", c.DeleteByKey)
+			r.Get("/session", c.CurrentSession)
+			r.Post("/verification", c.ResendVerification)
+
+			r.Route("/2fa", func(r chi.Router) {
+				r.Post("/", c.EnrollTwoFactor)
+				r.Post("/confirm", c.ConfirmTwoFactor)
+				r.Post("/disable", c.DisableTwoFactor)
+				r.Post("/recovery", c.RegenerateRecoveryCodes)
+			})
+
+			r.Route("/sessions", h.sessionsRoutes(ctrlCtx, c))
+		})
 	})
 
 	r.Post("/signup", c.Signup)
 	r.Post("/signin", c.Signin)
+	r.Post("/signin/2fa", c.SigninTwoFactor)
+	r.Post("/password/forgot", c.ForgotPassword)
+	r.Post("/password/reset", c.ResetPassword)
+	r.Post("/verify", c.Verify)
 
 	return r
 }
 
+func (h *Users) sessionsRoutes(
+	ctrlCtx *controllers.UsersContext,
+	c UsersCtrl,
+) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", c.FindSessions)
+		r.Delete("/", c.DeleteSessions)
+
+		r.Route("/:session", func(r chi.Router) {
+			r.Use(func(next chi.Handler) chi.Handler {
+				return chi.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+					ctrlCtx.SessionID = chi.URLParam(ctx, "session")
+					next.ServeHTTPC(ctx, w, r)
+				})
+			})
+
+			r.Delete("/", c.DeleteSession)
+		})
+	}
+}
+
 func (h *Users) builder(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
 	accessToken, _ := middlewares.GetAccessToken(ctx)
 	currentUser, _ := middlewares.GetCurrentUser(ctx)
+	clientIP, _ := middlewares.GetClientIP(ctx)
 	currentSession, err := middlewares.GetCurrentSession(ctx)
 	var role models.Role
 	if err == nil {
@@ -139,6 +220,9 @@ func (h *Users) builder(ctx context.Context, w http.ResponseWriter, r *http.Requ
 		CurrentUser:    currentUser,
 		CurrentSession: currentSession,
 		Filter:         filter,
+		Cursor:         r.URL.Query().Get("cursor"),
+		Fields:         utils.ParseFields(r.URL.Query().Get("fields")),
+		ClientIP:       clientIP,
 	}
 
 	logger, _ := snakepit.GetLogger(ctx)
@@ -151,27 +235,98 @@ func (h *Users) builder(ctx context.Context, w http.ResponseWriter, r *http.Requ
 		h.Client,
 	)
 
-	sessionsInter := interactors.NewSessions(
-		h.Constants,
-		logger,
-		repo,
+	var (
+		usersStore       interactors.UsersStore
+		tokensStore      interactors.TokensStore
+		revocationsStore interactors.SessionRevocationsStore
+		sessionsInter    interactors.SessionsReaderWriter
+		searcher         interactors.UsersSearcher
+		auditStore       interactors.AuditStore
 	)
+
+	switch {
+	case h.Memory != nil:
+		usersStore = h.Memory.Users
+		tokensStore = h.Memory.Tokens
+		revocationsStore = h.Memory.Revocations
+		searcher = h.Memory.Users
+		auditStore = h.Memory.Audit
+	case h.SQL != nil:
+		usersStore = h.SQL.Users
+		tokensStore = h.SQL.Tokens
+		revocationsStore = h.SQL.Revocations
+		searcher = h.SQL.Users
+		auditStore = h.SQL.Audit
+	default:
+		usersStore = repositories.NewUsers(repo)
+		tokensStore = repositories.NewTokens(repo)
+		revocationsStore = repositories.NewSessionRevocations(repo)
+		searcher = interactors.NewUsersSearch(h.Constants, logger, repo)
+		auditStore = repositories.NewAudit(repo)
+	}
+
+	switch {
+	case h.Constants.GetString(constants.SessionsBackend) != constants.SessionsBackendLocal:
+		sessionsInter = interactors.NewSessions(h.Constants, logger, repo)
+	case h.Memory != nil:
+		sessionsInter = h.Memory.Sessions
+	default:
+		sessionsInter = interactors.NewLocalSessions(h.Constants, logger, repo)
+	}
+
+	revocations := interactors.NewSessionRevocations(h.Constants, logger, revocationsStore, sessionsInter)
+
+	requestID, _ := snakepit.GetRequestID(ctx)
+
+	audit := interactors.NewAudit(h.Constants, logger, auditStore, &interactors.AuditContext{
+		Actor:     currentUser,
+		RequestID: requestID,
+		IP:        clientIP,
+		UserAgent: r.UserAgent(),
+	})
+
 	inter := interactors.NewUsers(
 		h.Constants,
 		logger,
-		repo,
+		usersStore,
+		tokensStore,
 		sessionsInter,
+		h.Notifier,
+		h.Failures,
+		revocations,
+		searcher,
+		audit,
 	)
 
+	context.MustChangePassword = mustChangePassword(currentUser)
+
 	sessionsValid := validators.NewSessions(logger)
+	policy := validators.NewPasswordPolicy(h.Constants)
 	var valid controllers.UsersValidator
 	switch role {
 	case constants.RoleAdmin:
-		valid = validators.NewUsersAdmin(logger)
+		valid = validators.NewUsersAdmin(logger, usersStore, policy)
 	case constants.RoleUser:
-		valid = validators.NewUsersUser(logger)
+		valid = validators.NewUsersUser(logger, usersStore, policy)
 	default:
-		valid = validators.NewUsersUser(logger)
+		valid = validators.NewUsersUser(logger, usersStore, policy)
+	}
+
+	filter, err = valid.Filter(filter)
+	if err != nil {
+		apiErr := errs.APIInvalidFilter
+		apiErr.Description = err.Error()
+		h.JSON.RenderError(ctx, w, 422, apiErr, err)
+		return
+	}
+	context.Filter = filter
+
+	context.Fields, err = valid.Fields(context.Fields)
+	if err != nil {
+		apiErr := errs.APIInvalidFilter
+		apiErr.Description = err.Error()
+		h.JSON.RenderError(ctx, w, 422, apiErr, err)
+		return
 	}
 
 	ctrl := controllers.NewUsers(
@@ -0,0 +1,1599 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/solher/snakepit"
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/apptest"
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/stores"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+const newPassword = "another-test-password"
+
+type fixture struct {
+	app    *apptest.App
+	admin  *apptest.Caller
+	user   *apptest.Caller
+	target *apptest.Caller
+}
+
+// newFixture starts an app with the given config, the default one being used when nil.
+func newFixture(t *testing.T, v *viper.Viper) *fixture {
+	a := apptest.New(t, v)
+
+	return &fixture{
+		app:    a,
+		admin:  a.Admin(),
+		user:   a.NewUser(),
+		target: a.NewUser(),
+	}
+}
+
+// caller returns the caller of the given role, the anonymous one being returned for an empty role.
+func (f *fixture) caller(role models.Role) *apptest.Caller {
+	switch role {
+	case constants.RoleAdmin:
+		return f.admin
+	case constants.RoleUser:
+		return f.user
+	default:
+		return f.app.Anonymous()
+	}
+}
+
+// path replaces the :key parameter by the key of the target, and the :session parameter by the ID
+// of the target session on the admin routes, or of the caller session on the self routes.
+func (f *fixture) path(pattern string, c *apptest.Caller) string {
+	session := "unknown"
+	switch {
+	case strings.HasPrefix(pattern, "/users/:key"):
+		session = utils.HashToken(f.target.Session.Token)
+	case c.Session != nil:
+		session = utils.HashToken(c.Session.Token)
+	}
+
+	path := strings.Replace(pattern, ":key", f.target.User.Key, 1)
+	return strings.Replace(path, ":session", session, 1)
+}
+
+func emailFilter(email string) string {
+	m, _ := json.Marshal(map[string]interface{}{
+		"where": []map[string]interface{}{{"email": map[string]interface{}{"eq": email}}},
+	})
+	return "?filter=" + url.QueryEscape(string(m))
+}
+
+type route struct {
+	method string
+	path   string
+	body   func(f *fixture, c *apptest.Caller) interface{}
+	// The expected statuses for the admin, the user and the anonymous callers.
+	admin, user, anonymous int
+	// The check of the response body when the expected status is a success.
+	expect expect
+}
+
+// expect returns what is wrong with the response body, empty when nothing is.
+type expect func(f *fixture, c *apptest.Caller, data []byte) string
+
+// target and self return the key of the user the admin and the self routes act on.
+func target(f *fixture, c *apptest.Caller) string { return f.target.User.Key }
+func self(f *fixture, c *apptest.Caller) string   { return c.User.Key }
+
+// userOf expects the user with the given key, any key for a nil one, and field values.
+// A field value can also be computed like the key.
+func userOf(key func(f *fixture, c *apptest.Caller) string, fields map[string]interface{}) expect {
+	return func(f *fixture, c *apptest.Caller, data []byte) string {
+		user := map[string]interface{}{}
+		if err := json.Unmarshal(data, &user); err != nil {
+			return fmt.Sprintf("expected a user, got %s", data)
+		}
+		return checkUser(f, c, user, key, fields)
+	}
+}
+
+// usersOf expects a list made of the user with the given key and field values.
+func usersOf(key func(f *fixture, c *apptest.Caller) string, fields map[string]interface{}) expect {
+	return func(f *fixture, c *apptest.Caller, data []byte) string {
+		users := []map[string]interface{}{}
+		if err := json.Unmarshal(data, &users); err != nil || len(users) != 1 {
+			return fmt.Sprintf("expected a single user, got %s", data)
+		}
+		return checkUser(f, c, users[0], key, fields)
+	}
+}
+
+// listing expects a list of users including the one with the given key.
+func listing(key func(f *fixture, c *apptest.Caller) string) expect {
+	return func(f *fixture, c *apptest.Caller, data []byte) string {
+		users := []map[string]interface{}{}
+		if err := json.Unmarshal(data, &users); err != nil {
+			return fmt.Sprintf("expected users, got %s", data)
+		}
+		for _, user := range users {
+			if _, ok := user["password"]; ok {
+				return "expected the passwords to be hidden"
+			}
+		}
+		for _, user := range users {
+			if user["_key"] == key(f, c) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("expected the user %s to be listed, got %s", key(f, c), data)
+	}
+}
+
+func checkUser(
+	f *fixture,
+	c *apptest.Caller,
+	user map[string]interface{},
+	key func(f *fixture, c *apptest.Caller) string,
+	fields map[string]interface{},
+) string {
+	switch {
+	case user["_key"] == nil || user["_key"] == "":
+		return fmt.Sprintf("expected a user key, got %v", user)
+	case key != nil && user["_key"] != key(f, c):
+		return fmt.Sprintf("expected the user %s, got %v", key(f, c), user["_key"])
+	case user["password"] != nil:
+		return "expected the password to be hidden"
+	}
+
+	for field, value := range fields {
+		if computed, ok := value.(func(f *fixture, c *apptest.Caller) string); ok {
+			value = computed(f, c)
+		}
+		if user[field] != value {
+			return fmt.Sprintf("expected the %s field to be %v, got %v", field, value, user[field])
+		}
+	}
+
+	return ""
+}
+
+// sessionOf expects a session with an ID, and a token when it was just created.
+func sessionOf(token bool) expect {
+	return func(f *fixture, c *apptest.Caller, data []byte) string {
+		session := &models.Session{}
+		switch {
+		case json.Unmarshal(data, session) != nil:
+			return fmt.Sprintf("expected a session, got %s", data)
+		case token && session.Token == "":
+			return "expected the session token"
+		case !token && session.ID == "":
+			return fmt.Sprintf("expected a session ID, got %s", data)
+		}
+		return ""
+	}
+}
+
+// sessionsOf expects at least the given number of sessions, listed without their tokens.
+func sessionsOf(min int) expect {
+	return func(f *fixture, c *apptest.Caller, data []byte) string {
+		sessions := []models.Session{}
+		if err := json.Unmarshal(data, &sessions); err != nil || len(sessions) < min {
+			return fmt.Sprintf("expected at least %d sessions, got %s", min, data)
+		}
+		for _, session := range sessions {
+			if session.ID == "" || session.Token != "" {
+				return fmt.Sprintf("expected the sessions to be identified by ID only, got %s", data)
+			}
+		}
+		return ""
+	}
+}
+
+func twoFactorSetup(f *fixture, c *apptest.Caller, data []byte) string {
+	setup := &models.TwoFactorSetup{}
+	if err := json.Unmarshal(data, setup); err != nil || setup.Secret == "" || setup.URI == "" {
+		return fmt.Sprintf("expected a two-factor setup, got %s", data)
+	}
+	return ""
+}
+
+func noContent(f *fixture, c *apptest.Caller, data []byte) string {
+	if len(data) != 0 {
+		return fmt.Sprintf("expected no content, got %s", data)
+	}
+	return ""
+}
+
+func noBody(f *fixture, c *apptest.Caller) interface{} {
+	return nil
+}
+
+func body(b interface{}) func(f *fixture, c *apptest.Caller) interface{} {
+	return func(f *fixture, c *apptest.Caller) interface{} {
+		return b
+	}
+}
+
+// routes lists every route of the users handler. The admin routes act on the target user,
+// the self routes on the caller.
+var routes = []route{
+	// Admin routes
+	{"POST", "/users", body(&models.User{Email: "created@localhost", Password: apptest.Password, Role: constants.RoleUser}), 201, 403, 401,
+		userOf(nil, map[string]interface{}{"email": "created@localhost", "role": string(constants.RoleUser)})},
+	{"GET", "/users", noBody, 200, 403, 401, listing(target)},
+	{"PUT", "/users?filter", body(&models.User{FirstName: "Updated"}), 200, 403, 401,
+		usersOf(target, map[string]interface{}{"firstName": "Updated"})},
+	{"DELETE", "/users?filter", noBody, 200, 403, 401, usersOf(target, map[string]interface{}{"deletedBy": self})},
+	{"GET", "/users/search?q=user", noBody, 200, 403, 401, listing(target)},
+	{"GET", "/users/:key", noBody, 200, 403, 401, userOf(target, nil)},
+	{"PUT", "/users/:key", func(f *fixture, c *apptest.Caller) interface{} {
+		return &models.User{Email: f.target.User.Email, FirstName: "Replaced"}
+	}, 200, 403, 401, userOf(target, map[string]interface{}{"firstName": "Replaced"})},
+	{"PATCH", "/users/:key", body(map[string]interface{}{"firstName": "Patched"}), 200, 403, 401,
+		userOf(target, map[string]interface{}{"firstName": "Patched"})},
+	{"DELETE", "/users/:key", noBody, 200, 403, 401, userOf(target, map[string]interface{}{"deletedBy": self})},
+	{"POST", "/users/:key/password", body(&models.Password{Password: newPassword}), 200, 403, 401, userOf(target, nil)},
+	{"POST", "/users/:key/unlock", noBody, 200, 403, 401, userOf(target, nil)},
+	// The target is not deleted.
+	{"POST", "/users/:key/restore", noBody, 403, 403, 401, nil},
+	{"GET", "/users/:key/sessions", noBody, 200, 403, 401, sessionsOf(1)},
+	{"DELETE", "/users/:key/sessions", noBody, 200, 403, 401, sessionsOf(1)},
+	{"DELETE", "/users/:key/sessions/:session", noBody, 200, 403, 401, sessionOf(false)},
+
+	// Self routes
+	{"POST", "/users/me/password", body(&models.Password{Password: newPassword}), 200, 200, 401, userOf(self, nil)},
+	{"GET", "/users/me", noBody, 200, 200, 401, userOf(self, nil)},
+	{"PUT", "/users/me", func(f *fixture, c *apptest.Caller) interface{} {
+		if c.User == nil {
+			return &models.User{}
+		}
+		return &models.User{Email: c.User.Email, FirstName: "Replaced"}
+	}, 200, 200, 401, userOf(self, map[string]interface{}{"firstName": "Replaced"})},
+	{"PATCH", "/users/me", body(map[string]interface{}{"firstName": "Patched"}), 200, 200, 401,
+		userOf(self, map[string]interface{}{"firstName": "Patched"})},
+	{"DELETE", "/users/me", noBody, 200, 200, 401, userOf(self, map[string]interface{}{"deletedBy": self})},
+	{"GET", "/users/me/session", noBody, 200, 200, 401, sessionOf(false)},
+	{"POST", "/users/me/signout", noBody, 200, 200, 401, sessionOf(false)},
+	// The email of the bootstrap admin is verified by the seed.
+	{"POST", "/users/me/verification", noBody, 409, 200, 401, userOf(self, nil)},
+	{"POST", "/users/me/2fa", noBody, 201, 201, 401, twoFactorSetup},
+	{"POST", "/users/me/2fa/confirm", body(&models.TwoFactorCode{Code: "000000"}), 409, 409, 401, nil},
+	{"POST", "/users/me/2fa/disable", body(&models.TwoFactorCode{Code: "000000"}), 409, 409, 401, nil},
+	{"POST", "/users/me/2fa/recovery", body(&models.TwoFactorCode{Code: "000000"}), 409, 409, 401, nil},
+	{"GET", "/users/me/sessions", noBody, 200, 200, 401, sessionsOf(1)},
+	// The current session is kept.
+	{"DELETE", "/users/me/sessions", noBody, 200, 200, 401, sessionsOf(0)},
+	{"DELETE", "/users/me/sessions/:session", noBody, 200, 200, 401, sessionOf(false)},
+
+	// Public routes
+	{"POST", "/users/signup", body(&models.User{Email: "signup@localhost", Password: apptest.Password}), 201, 201, 201,
+		userOf(nil, map[string]interface{}{"email": "signup@localhost", "role": string(constants.RoleUser)})},
+	{"POST", "/users/signin", func(f *fixture, c *apptest.Caller) interface{} {
+		return &models.Credentials{Email: f.target.User.Email, Password: apptest.Password}
+	}, 201, 201, 201, sessionOf(true)},
+	{"POST", "/users/signin/2fa", body(&models.TwoFactorSignin{Challenge: "unknown", Code: "000000"}), 403, 403, 403, nil},
+	{"POST", "/users/password/forgot", func(f *fixture, c *apptest.Caller) interface{} {
+		return &models.PasswordForgot{Email: f.target.User.Email}
+	}, 204, 204, 204, noContent},
+	{"POST", "/users/password/reset", body(&models.PasswordReset{Token: "unknown", Password: newPassword}), 422, 422, 422, nil},
+	{"POST", "/users/verify", body(&models.Verification{Token: "unknown"}), 422, 422, 422, nil},
+}
+
+func TestUsersRoutes(t *testing.T) {
+	apptest.RunBackends(t, testRoutes)
+}
+
+func testRoutes(t *testing.T, config func() *viper.Viper) {
+	callers := []struct {
+		name string
+		role models.Role
+	}{
+		{"admin", constants.RoleAdmin},
+		{"user", constants.RoleUser},
+		{"anonymous", ""},
+	}
+
+	for _, rt := range routes {
+		for i, caller := range callers {
+			rt, caller, expected := rt, caller, []int{rt.admin, rt.user, rt.anonymous}[i]
+
+			t.Run(rt.method+" "+rt.path+" as "+caller.name, func(t *testing.T) {
+				f := newFixture(t, config())
+				defer f.app.Close()
+
+				c := f.caller(caller.role)
+
+				path := f.path(rt.path, c)
+				if strings.HasSuffix(path, "?filter") {
+					path = strings.TrimSuffix(path, "?filter") + emailFilter(f.target.User.Email)
+				}
+
+				data := json.RawMessage{}
+				res := c.Do(rt.method, path, rt.body(f, c), &data)
+				if res.StatusCode != expected {
+					t.Fatalf("Expected status %d, got %d.", expected, res.StatusCode)
+				}
+
+				if expected < 300 && rt.expect != nil {
+					if problem := rt.expect(f, c, data); problem != "" {
+						t.Errorf("Unexpected response body: %s.", problem)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestUsersDeveloperRole(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	developer := f.user.WithRole(constants.RoleDeveloper)
+
+	if res := developer.Do("GET", "/users", nil, nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the admin routes to be forbidden, got %d.", res.StatusCode)
+	}
+
+	if res := developer.Do("GET", "/users/me", nil, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the self routes to be allowed, got %d.", res.StatusCode)
+	}
+}
+
+func TestUsersForgedRoleNeedsValidSignature(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	header := apptest.Headers("wrong-secret", f.user.User, constants.RoleAdmin, f.user.Session)
+
+	req, _ := http.NewRequest("GET", f.app.URL+"/users", nil)
+	req.Header = header
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d.", http.StatusUnauthorized, res.StatusCode)
+	}
+
+	header.Del("Auth-Server-Signature")
+
+	req, _ = http.NewRequest("GET", f.app.URL+"/users/me", nil)
+	req.Header = header
+
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected unsigned headers to be refused, got %d.", res.StatusCode)
+	}
+}
+
+func TestUsersReplayedHeadersAreRefused(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	secret := f.app.Config.GetString(constants.AuthHeadersSecret)
+
+	for name, at := range map[string]time.Time{
+		"old":    time.Now().Add(-2 * time.Minute),
+		"future": time.Now().Add(2 * time.Minute),
+	} {
+		req, _ := http.NewRequest("GET", f.app.URL+"/users/me", nil)
+		req.Header = apptest.HeadersAt(secret, f.user.User, constants.RoleUser, f.user.Session, at)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected the %s headers to be refused, got %d.", name, res.StatusCode)
+		}
+	}
+}
+
+// signin signs in with the given credentials, the request being forwarded for the given IP.
+func signin(t *testing.T, f *fixture, email, password, forwardedFor string) int {
+	m, _ := json.Marshal(&models.Credentials{Email: email, Password: password})
+
+	req, _ := http.NewRequest("POST", f.app.URL+"/users/signin", strings.NewReader(string(m)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestUsersLockoutIgnoresUntrustedForwarding(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	for i := 0; i < f.app.Config.GetInt(constants.LockoutIPThreshold); i++ {
+		signin(t, f, fmt.Sprintf("unknown-%d@localhost", i), "wrong", fmt.Sprintf("10.0.0.%d", i))
+	}
+
+	if status := signin(t, f, f.user.User.Email, apptest.Password, "10.0.1.1"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected the forged forwarding header to be ignored, got %d.", status)
+	}
+}
+
+func TestUsersLockoutTrustedProxy(t *testing.T) {
+	v := apptest.NewConfig()
+	v.Set(constants.TrustedProxies, []string{"127.0.0.1", "10.0.0.0/8"})
+
+	f := newFixture(t, v)
+	defer f.app.Close()
+
+	// The forged leftmost hops change, but the last untrusted hop is the same client.
+	for i := 0; i < f.app.Config.GetInt(constants.LockoutIPThreshold); i++ {
+		signin(t, f, fmt.Sprintf("unknown-%d@localhost", i), "wrong", fmt.Sprintf("1.1.1.%d, 2.2.2.2, 10.0.0.1", i))
+	}
+
+	if status := signin(t, f, f.user.User.Email, apptest.Password, "2.2.2.2"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected the client to be locked out, got %d.", status)
+	}
+
+	if status := signin(t, f, f.user.User.Email, apptest.Password, "3.3.3.3"); status != http.StatusCreated {
+		t.Errorf("Expected another client behind the proxy to sign in, got %d.", status)
+	}
+}
+
+func TestUsersLockoutNormalizesEmail(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	email := f.user.User.Email
+	variants := []string{strings.ToUpper(email), " " + email, email + " "}
+
+	for i := 0; i < f.app.Config.GetInt(constants.LockoutAccountThreshold); i++ {
+		signin(t, f, variants[i%len(variants)], "wrong", "")
+	}
+
+	if status := signin(t, f, email, apptest.Password, ""); status != http.StatusTooManyRequests {
+		t.Errorf("Expected the account to be locked out, got %d.", status)
+	}
+}
+
+func TestUsersLockoutResponse(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	for i := 0; i < f.app.Config.GetInt(constants.LockoutAccountThreshold); i++ {
+		signin(t, f, f.user.User.Email, "wrong", "")
+	}
+
+	apiErr := &snakepit.APIError{}
+	cred := &models.Credentials{Email: f.user.User.Email, Password: apptest.Password}
+	res := f.app.Anonymous().Do("POST", "/users/signin", cred, apiErr)
+
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d.", http.StatusTooManyRequests, res.StatusCode)
+	}
+	if apiErr.ErrorCode != errs.APIAccountLocked.ErrorCode {
+		t.Errorf("Expected the %s error, got %+v.", errs.APIAccountLocked.ErrorCode, apiErr)
+	}
+
+	max := int(f.app.Config.GetDuration(constants.LockoutDuration).Seconds())
+	if wait, err := strconv.Atoi(res.Header.Get("Retry-After")); err != nil || wait < 1 || wait > max {
+		t.Errorf("Expected a Retry-After between 1 and %d seconds, got %q.", max, res.Header.Get("Retry-After"))
+	}
+}
+
+func TestUsersSignout(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	if res := f.user.Do("POST", "/users/me/signout", nil, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if _, ok := f.app.AuthServer.Session(f.user.Session.Token); ok {
+		t.Error("Expected the session to be deleted from the auth server.")
+	}
+}
+
+func TestUsersSignedAccessTokenIsNotOverridden(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	path := "/users/me/signout?accessToken=" + url.QueryEscape(f.target.Session.Token)
+	if res := f.user.Do("POST", path, nil, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if _, ok := f.app.AuthServer.Session(f.target.Session.Token); !ok {
+		t.Error("Expected the session given in the query to be kept.")
+	}
+	if _, ok := f.app.AuthServer.Session(f.user.Session.Token); ok {
+		t.Error("Expected the signed session to be deleted.")
+	}
+}
+
+func TestUsersSessions(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	other := f.app.Signin(f.user.User.Email, apptest.Password)
+
+	sessions := []models.Session{}
+	if res := f.user.Do("GET", "/users/me/sessions", nil, &sessions); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if len(sessions) != 2 {
+		t.Fatalf("Expected the 2 sessions of the user to be listed by the auth server, got %d.", len(sessions))
+	}
+
+	for _, session := range sessions {
+		if session.Token != "" || session.ID == "" {
+			t.Errorf("Expected the sessions to be identified by their ID only, got %+v.", session)
+		}
+		if session.Current != (session.ID == utils.HashToken(f.user.Session.Token)) {
+			t.Errorf("Expected only the session of the request to be current, got %+v.", session)
+		}
+	}
+
+	if res := f.user.Do("DELETE", "/users/me/sessions/"+other.Session.Token, nil, nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the raw token to be refused as session ID, got %d.", res.StatusCode)
+	}
+
+	if res := f.user.Do("DELETE", "/users/me/sessions/"+utils.HashToken(other.Session.Token), nil, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if _, ok := f.app.AuthServer.Session(other.Session.Token); ok {
+		t.Error("Expected the session to be deleted from the auth server.")
+	}
+}
+
+func TestUsersLocalSessions(t *testing.T) {
+	v := apptest.NewConfig()
+	v.Set(constants.SessionsBackend, constants.SessionsBackendLocal)
+
+	f := newFixture(t, v)
+	defer f.app.Close()
+
+	other := f.app.Signin(f.user.User.Email, apptest.Password)
+
+	sessions := []models.Session{}
+	if res := f.user.Do("GET", "/users/me/sessions", nil, &sessions); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	ids := map[string]bool{}
+	for _, session := range sessions {
+		if session.Token != "" {
+			t.Errorf("Expected the session tokens not to be listed, got %+v.", session)
+		}
+		ids[session.ID] = true
+	}
+
+	if len(sessions) != 2 || !ids[utils.HashToken(f.user.Session.Token)] || !ids[utils.HashToken(other.Session.Token)] {
+		t.Fatalf("Expected the 2 sessions of the user to be identified by the hash of their token, got %+v.", sessions)
+	}
+
+	forged := *f.user
+	forged.Session = &models.Session{Token: utils.HashToken(f.user.Session.Token)}
+	if res := forged.Do("GET", "/users/me", nil, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected the hash of a token to be refused as bearer token, got %d.", res.StatusCode)
+	}
+
+	if res := f.user.Do("DELETE", "/users/me/sessions/"+utils.HashToken(other.Session.Token), nil, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if res := other.Do("GET", "/users/me", nil, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected the deleted session to be refused, got %d.", res.StatusCode)
+	}
+
+	if res := f.user.Do("POST", "/users/me/signout", nil, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if res := f.user.Do("GET", "/users/me", nil, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected the signed out session to be refused, got %d.", res.StatusCode)
+	}
+}
+
+func TestUsersDeleteRevokesSessions(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	if res := f.admin.Do("DELETE", "/users/"+f.target.User.Key, nil, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if sessions := f.app.AuthServer.Sessions(f.target.User.OwnerToken); len(sessions) != 0 {
+		t.Errorf("Expected the sessions of the deleted user to be revoked, %d left.", len(sessions))
+	}
+
+	if sessions := f.app.AuthServer.Sessions(f.user.User.OwnerToken); len(sessions) != 1 {
+		t.Errorf("Expected the sessions of the other users to be kept, %d left.", len(sessions))
+	}
+}
+
+func TestUsersDeleteWithUnavailableAuthServer(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	f.app.AuthServer.SetFailing(true)
+	res := f.admin.Do("DELETE", "/users/"+f.target.User.Key, nil, nil)
+	f.app.AuthServer.SetFailing(false)
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the revocation to be queued and the user deleted, got %d.", res.StatusCode)
+	}
+
+	if res := f.admin.Do("GET", "/users/"+f.target.User.Key, nil, nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the user to be deleted, got %d.", res.StatusCode)
+	}
+}
+
+// dropTable drops a table of the SQL database of the app, making its next writes fail.
+func dropTable(t *testing.T, a *apptest.App, table string) {
+	db, err := stores.NewSQL(a.Config.GetString(constants.DBSQLDriver), a.Config.GetString(constants.DBSQLDSN))
+	if err != nil {
+		t.Fatalf("Could not open the database: %v", err)
+	}
+	defer db.DB.Close()
+
+	if _, err := db.DB.Exec(`DROP TABLE "` + table + `"`); err != nil {
+		t.Fatalf("Could not drop the %s table: %v", table, err)
+	}
+}
+
+func TestUsersDeleteWithUnqueuableRevocation(t *testing.T) {
+	f := newFixture(t, apptest.NewSQLiteConfig())
+	defer f.app.Close()
+
+	dropTable(t, f.app, "session_revocations")
+
+	f.app.AuthServer.SetFailing(true)
+	res := f.admin.Do("DELETE", "/users/"+f.target.User.Key, nil, nil)
+	f.app.AuthServer.SetFailing(false)
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the committed deletion to succeed, got %d.", res.StatusCode)
+	}
+
+	if res := f.admin.Do("GET", "/users/"+f.target.User.Key, nil, nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the user to be deleted, got %d.", res.StatusCode)
+	}
+}
+
+func TestUsersPasswordResetWithUnqueuableRevocation(t *testing.T) {
+	f := newFixture(t, apptest.NewSQLiteConfig())
+	defer f.app.Close()
+
+	email := f.target.User.Email
+	f.app.Anonymous().Do("POST", "/users/password/forgot", &models.PasswordForgot{Email: email}, nil)
+
+	dropTable(t, f.app, "session_revocations")
+
+	f.app.AuthServer.SetFailing(true)
+	reset := &models.PasswordReset{Token: f.app.ResetToken(email), Password: newPassword}
+	res := f.app.Anonymous().Do("POST", "/users/password/reset", reset, nil)
+	f.app.AuthServer.SetFailing(false)
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the committed password change to succeed, got %d.", res.StatusCode)
+	}
+
+	f.app.Signin(email, newPassword)
+}
+
+func TestUsersWithUnrecordableAudit(t *testing.T) {
+	f := newFixture(t, apptest.NewSQLiteConfig())
+	defer f.app.Close()
+
+	dropTable(t, f.app, "audit")
+
+	patch := map[string]interface{}{"firstName": "Patched"}
+	updated := &models.User{}
+	if res := f.user.Do("PATCH", "/users/me", patch, updated); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the committed update to succeed, got %d.", res.StatusCode)
+	}
+	if updated.FirstName != "Patched" {
+		t.Errorf("Expected the update to be applied, got %q.", updated.FirstName)
+	}
+
+	f.app.Signin(f.user.User.Email, apptest.Password)
+}
+
+func TestUsersSoftDelete(t *testing.T) {
+	apptest.RunBackends(t, testUsersSoftDelete)
+}
+
+func testUsersSoftDelete(t *testing.T, config func() *viper.Viper) {
+	f := newFixture(t, config())
+	defer f.app.Close()
+
+	key := f.target.User.Key
+	cred := &models.Credentials{Email: f.target.User.Email, Password: apptest.Password}
+
+	if res := f.admin.Do("DELETE", "/users/"+key, nil, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if res := f.admin.Do("GET", "/users/"+key, nil, nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the deleted user to be hidden, got %d.", res.StatusCode)
+	}
+
+	if res := f.app.Anonymous().Do("POST", "/users/signin", cred, nil); res.StatusCode == http.StatusCreated {
+		t.Error("Expected the deleted user not to sign in.")
+	}
+
+	found := []models.User{}
+	f.admin.Do("GET", "/users/search?q="+url.QueryEscape(f.target.User.Email), nil, &found)
+	for _, user := range found {
+		if user.Key == key {
+			t.Error("Expected the deleted user not to be searchable.")
+		}
+	}
+
+	m, _ := json.Marshal(map[string]interface{}{
+		"where":   []map[string]interface{}{{"_key": key}},
+		"options": []string{constants.OptionIncludeDeleted},
+	})
+	included := "/users?filter=" + url.QueryEscape(string(m))
+
+	users := []models.User{}
+	if res := f.admin.Do("GET", included, nil, &users); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+	if len(users) != 1 || users[0].DeletedAt == nil || users[0].DeletedBy != f.admin.User.Key {
+		t.Fatalf("Expected the deleted user to be included, got %+v.", users)
+	}
+
+	if res := f.user.Do("GET", "/users/me"+strings.TrimPrefix(included, "/users"), nil, nil); res.StatusCode != 422 {
+		t.Errorf("Expected the option to be reserved to the admins, got %d.", res.StatusCode)
+	}
+
+	if res := f.admin.Do("POST", "/users/"+key+"/restore", nil, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if res := f.admin.Do("POST", "/users/"+key+"/restore", nil, nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected a restored user not to be restored again, got %d.", res.StatusCode)
+	}
+
+	user := &models.User{}
+	if res := f.admin.Do("GET", "/users/"+key, nil, user); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the restored user to be visible, got %d.", res.StatusCode)
+	}
+	if user.DeletedAt != nil || user.DeletedBy != "" {
+		t.Errorf("Expected the deletion to be cleared, got %+v.", user)
+	}
+
+	if res := f.app.Anonymous().Do("POST", "/users/signin", cred, nil); res.StatusCode != http.StatusCreated {
+		t.Errorf("Expected the restored user to sign in, got %d.", res.StatusCode)
+	}
+}
+
+func TestUsersDeletionCannotBeWritten(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	deleted := map[string]interface{}{
+		"email":     "hidden@localhost",
+		"password":  apptest.Password,
+		"deletedAt": time.Now().UTC(),
+		"deletedBy": "someone",
+	}
+
+	user := &models.User{}
+	if res := f.app.Anonymous().Do("POST", "/users/signup", deleted, user); res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d.", http.StatusCreated, res.StatusCode)
+	}
+
+	if res := f.admin.Do("GET", "/users/"+user.Key, nil, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the signed up user not to be deleted, got %d.", res.StatusCode)
+	}
+
+	deleted["email"] = f.user.User.Email
+	delete(deleted, "password")
+
+	if res := f.user.Do("PUT", "/users/me", deleted, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if res := f.admin.Do("GET", "/users/"+f.user.User.Key, nil, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the replaced user not to be deleted, got %d.", res.StatusCode)
+	}
+}
+
+func TestUsersPurge(t *testing.T) {
+	v := apptest.NewConfig()
+	v.Set(constants.UsersPurgeRetention, 0)
+	v.Set(constants.UsersPurgeInterval, 10*time.Millisecond)
+
+	f := newFixture(t, v)
+	defer f.app.Close()
+
+	key := f.target.User.Key
+
+	if res := f.admin.Do("DELETE", "/users/"+key, nil, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	m, _ := json.Marshal(map[string]interface{}{
+		"where":   []map[string]interface{}{{"_key": key}},
+		"options": []string{constants.OptionIncludeDeleted},
+	})
+	included := "/users?filter=" + url.QueryEscape(string(m))
+
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		users := []models.User{}
+		if f.admin.Do("GET", included, nil, &users); len(users) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the deleted user to be purged.")
+		}
+	}
+
+	entries := []models.AuditEntry{}
+	f.admin.Do("GET", "/audit"+auditFilter(key, constants.AuditUserPurge), nil, &entries)
+	if len(entries) != 1 {
+		t.Fatalf("Expected the purge to be recorded, got %d entries.", len(entries))
+	}
+
+	purged := entries[0]
+	if purged.Before["email"] != f.target.User.Email || len(purged.After) != 0 {
+		t.Errorf("Expected the purged user to be recorded, got %v before and %v after.", purged.Before, purged.After)
+	}
+	if purged.Before["ownerToken"] != "REDACTED" || purged.Before["password"] != "REDACTED" {
+		t.Errorf("Expected the secrets of the purged user to be redacted, got %v.", purged.Before)
+	}
+}
+
+func TestUsersPasswordReset(t *testing.T) {
+	apptest.RunBackends(t, testUsersPasswordReset)
+}
+
+func testUsersPasswordReset(t *testing.T, config func() *viper.Viper) {
+	f := newFixture(t, config())
+	defer f.app.Close()
+
+	anonymous := f.app.Anonymous()
+	email := f.target.User.Email
+
+	forgot := &models.PasswordForgot{Email: email}
+	if res := anonymous.Do("POST", "/users/password/forgot", forgot, nil); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d.", http.StatusNoContent, res.StatusCode)
+	}
+
+	token := f.app.ResetToken(email)
+	if token == "" {
+		t.Fatal("Expected a reset token to be sent.")
+	}
+
+	rejected := &models.PasswordReset{Token: token, Password: email}
+	if res := anonymous.Do("POST", "/users/password/reset", rejected, nil); res.StatusCode != 422 {
+		t.Fatalf("Expected the email of the token owner to be rejected as password, got %d.", res.StatusCode)
+	}
+
+	reset := &models.PasswordReset{Token: token, Password: newPassword}
+	if res := anonymous.Do("POST", "/users/password/reset", reset, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if res := anonymous.Do("POST", "/users/password/reset", reset, nil); res.StatusCode != 422 {
+		t.Errorf("Expected the token to be single use, got %d.", res.StatusCode)
+	}
+
+	f.app.Signin(email, newPassword)
+}
+
+func TestUsersPasswordRotationRequired(t *testing.T) {
+	v := apptest.NewConfig()
+	v.Set(constants.AdminPassword, "")
+
+	a := apptest.New(t, v)
+	defer a.Close()
+
+	password := a.BootstrapPassword()
+	if password == "" {
+		t.Fatal("Expected a one-time password to be generated for the bootstrap admin.")
+	}
+
+	admin := a.Signin(apptest.AdminEmail, password)
+
+	for _, path := range []string{"/users", "/users/me", "/audit"} {
+		if res := admin.Do("GET", path, nil, nil); res.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected %s to be refused until the password is changed, got %d.", path, res.StatusCode)
+		}
+	}
+
+	if res := a.Signin(apptest.AdminEmail, password).Do("POST", "/users/me/signout", nil, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the signout to be allowed, got %d.", res.StatusCode)
+	}
+
+	if res := admin.Do("POST", "/users/me/password", &models.Password{Password: newPassword}, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	admin = a.Signin(apptest.AdminEmail, newPassword)
+
+	for _, path := range []string{"/users", "/users/me", "/audit"} {
+		if res := admin.Do("GET", path, nil, nil); res.StatusCode != http.StatusOK {
+			t.Errorf("Expected %s to be allowed once the password is changed, got %d.", path, res.StatusCode)
+		}
+	}
+}
+
+func TestUsersPasswordRotationRequiredByAdmin(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	patch := map[string]interface{}{"mustChangePassword": true}
+	if res := f.admin.Do("PATCH", "/users/"+f.target.User.Key, patch, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	// The flag being carried by the session payloads, the sessions predating it are revoked.
+	if sessions := f.app.AuthServer.Sessions(f.target.User.OwnerToken); len(sessions) != 0 {
+		t.Errorf("Expected the sessions of the target to be revoked, %d left.", len(sessions))
+	}
+
+	target := f.app.Signin(f.target.User.Email, apptest.Password)
+	if res := target.Do("GET", "/users/me", nil, nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the target to be refused until the password is changed, got %d.", res.StatusCode)
+	}
+
+	if res := target.Do("POST", "/users/me/password", &models.Password{Password: newPassword}, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	target = f.app.Signin(f.target.User.Email, newPassword)
+	if res := target.Do("GET", "/users/me", nil, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the target to be allowed once the password is changed, got %d.", res.StatusCode)
+	}
+
+	if sessions := f.app.AuthServer.Sessions(f.user.User.OwnerToken); len(sessions) != 1 {
+		t.Errorf("Expected the sessions of the other users to be kept, %d left.", len(sessions))
+	}
+}
+
+func TestUsersEmailVerification(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	token := f.app.VerificationToken(f.user.User.Email)
+	if token == "" {
+		t.Fatal("Expected a verification token to be sent on sign up.")
+	}
+
+	verification := &models.Verification{Token: token}
+	if res := f.app.Anonymous().Do("POST", "/users/verify", verification, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	user := &models.User{}
+	f.user.Do("GET", "/users/me", nil, user)
+
+	if !user.EmailVerified {
+		t.Error("Expected the email to be verified.")
+	}
+
+	if res := f.user.Do("POST", "/users/me/verification", nil, nil); res.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d.", http.StatusConflict, res.StatusCode)
+	}
+}
+
+func TestUsersVerificationAfterEmailChange(t *testing.T) {
+	apptest.RunBackends(t, testUsersVerificationAfterEmailChange)
+}
+
+func testUsersVerificationAfterEmailChange(t *testing.T, config func() *viper.Viper) {
+	f := newFixture(t, config())
+	defer f.app.Close()
+
+	token := f.app.VerificationToken(f.user.User.Email)
+	if token == "" {
+		t.Fatal("Expected a verification token to be sent on sign up.")
+	}
+
+	if res := f.user.Do("PATCH", "/users/me", map[string]interface{}{"email": "victim@localhost"}, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	verification := &models.Verification{Token: token}
+	if res := f.app.Anonymous().Do("POST", "/users/verify", verification, nil); res.StatusCode != 422 {
+		t.Errorf("Expected the token of the previous email to be rejected, got %d.", res.StatusCode)
+	}
+
+	user := &models.User{}
+	f.user.Do("GET", "/users/me", nil, user)
+
+	if user.EmailVerified {
+		t.Error("Expected the new email not to be verified.")
+	}
+}
+
+func TestUsersEmailUniqueness(t *testing.T) {
+	apptest.RunBackends(t, testUsersEmailUniqueness)
+}
+
+func testUsersEmailUniqueness(t *testing.T, config func() *viper.Viper) {
+	f := newFixture(t, config())
+	defer f.app.Close()
+
+	taken := f.user.User.Email
+	key := f.target.User.Key
+
+	requests := []struct {
+		name   string
+		caller *apptest.Caller
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"signup", f.app.Anonymous(), "POST", "/users/signup", &models.User{Email: taken, Password: apptest.Password}, 422},
+		{"create", f.admin, "POST", "/users", &models.User{Email: taken, Password: apptest.Password, Role: constants.RoleUser}, 422},
+		{"bulk create", f.admin, "POST", "/users", []models.User{
+			{Email: "twice@localhost", Password: apptest.Password, Role: constants.RoleUser},
+			{Email: "twice@localhost", Password: apptest.Password, Role: constants.RoleUser},
+		}, 422},
+		{"replace", f.admin, "PUT", "/users/" + key, &models.User{Email: taken}, 422},
+		{"patch", f.admin, "PATCH", "/users/" + key, map[string]interface{}{"email": taken}, 422},
+		{"patch self", f.target, "PATCH", "/users/me", map[string]interface{}{"email": taken}, 422},
+		{"update", f.admin, "PUT", "/users" + emailFilter(f.target.User.Email), &models.User{Email: taken}, 422},
+		{"replace keeping the email", f.admin, "PUT", "/users/" + key, &models.User{Email: f.target.User.Email}, 200},
+		{"patch keeping the email", f.target, "PATCH", "/users/me", map[string]interface{}{"email": f.target.User.Email}, 200},
+	}
+
+	for _, r := range requests {
+		if res := r.caller.Do(r.method, r.path, r.body, nil); res.StatusCode != r.status {
+			t.Errorf("%s: expected status %d, got %d.", r.name, r.status, res.StatusCode)
+		}
+	}
+
+	users := []models.User{}
+	f.admin.Do("GET", "/users"+emailFilter("twice@localhost"), nil, &users)
+	if len(users) != 0 {
+		t.Errorf("Expected the duplicated bulk not to be created, got %+v.", users)
+	}
+
+	// The validators cannot catch an email given to several users by a filter: the unique
+	// index of the store reports it.
+	filter, _ := json.Marshal(map[string]interface{}{
+		"where": []map[string]interface{}{{"_key": map[string]interface{}{"in": []string{f.user.User.Key, key}}}},
+	})
+	apiErr := &snakepit.APIError{}
+	res := f.admin.Do("PUT", "/users?filter="+url.QueryEscape(string(filter)), &models.User{Email: "shared@localhost"}, apiErr)
+
+	if res.StatusCode != 422 {
+		t.Fatalf("Expected status %d, got %d.", 422, res.StatusCode)
+	}
+	if apiErr.ErrorCode != errs.APIEmailTaken.ErrorCode {
+		t.Errorf("Expected the %s error, got %+v.", errs.APIEmailTaken.ErrorCode, apiErr)
+	}
+}
+
+// totpCode returns the code of the given time step, relative to the current one.
+func totpCode(t *testing.T, secret string, step int64) string {
+	code, err := utils.TOTPCode(secret, utils.TOTPCounter(time.Now())+step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// enableTwoFactor enrolls the caller and confirms the enrollment with the code of the previous
+// time step, returning the TOTP secret and the recovery codes.
+func enableTwoFactor(t *testing.T, c *apptest.Caller) (string, []string) {
+	setup := &models.TwoFactorSetup{}
+	if res := c.Do("POST", "/users/me/2fa", nil, setup); res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d.", http.StatusCreated, res.StatusCode)
+	}
+
+	codes := &models.RecoveryCodes{}
+	confirm := &models.TwoFactorCode{Code: totpCode(t, setup.Secret, -1)}
+	if res := c.Do("POST", "/users/me/2fa/confirm", confirm, codes); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	if len(codes.Codes) == 0 {
+		t.Fatal("Expected recovery codes.")
+	}
+
+	return setup.Secret, codes.Codes
+}
+
+func TestUsersTwoFactor(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	// Codes are only accepted once per time step, so each one is taken from a different step.
+	secret, recoveryCodes := enableTwoFactor(t, f.user)
+
+	challenge := &models.TwoFactorChallenge{}
+	cred := &models.Credentials{Email: f.user.User.Email, Password: apptest.Password}
+	if res := f.app.Anonymous().Do("POST", "/users/signin", cred, challenge); res.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d.", http.StatusAccepted, res.StatusCode)
+	}
+
+	signin := &models.TwoFactorSignin{Challenge: challenge.Challenge, Code: totpCode(t, secret, 0)}
+	if res := f.app.Anonymous().Do("POST", "/users/signin/2fa", signin, nil); res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d.", http.StatusCreated, res.StatusCode)
+	}
+
+	recovery := &models.TwoFactorCode{Code: recoveryCodes[0]}
+	if res := f.user.Do("POST", "/users/me/2fa/disable", recovery, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestUsersTwoFactorLockout(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	secret, _ := enableTwoFactor(t, f.user)
+	cred := &models.Credentials{Email: f.user.User.Email, Password: apptest.Password}
+
+	// The right password does not reset the failures of the wrong codes.
+	for i := 0; i < f.app.Config.GetInt(constants.LockoutAccountThreshold); i++ {
+		challenge := &models.TwoFactorChallenge{}
+		if res := f.app.Anonymous().Do("POST", "/users/signin", cred, challenge); res.StatusCode != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d.", http.StatusAccepted, res.StatusCode)
+		}
+
+		signin := &models.TwoFactorSignin{Challenge: challenge.Challenge, Code: "000000"}
+		if res := f.app.Anonymous().Do("POST", "/users/signin/2fa", signin, nil); res.StatusCode != http.StatusForbidden {
+			t.Fatalf("Expected status %d, got %d.", http.StatusForbidden, res.StatusCode)
+		}
+	}
+
+	if res := f.app.Anonymous().Do("POST", "/users/signin", cred, nil); res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected the account to be locked out, got %d.", res.StatusCode)
+	}
+
+	f.admin.Do("POST", "/users/"+f.user.User.Key+"/unlock", nil, nil)
+
+	// A challenge issued before the lockout cannot be used once locked.
+	challenge := &models.TwoFactorChallenge{}
+	f.app.Anonymous().Do("POST", "/users/signin", cred, challenge)
+	for i := 0; i < f.app.Config.GetInt(constants.LockoutAccountThreshold); i++ {
+		signin(t, f, cred.Email, "wrong", "")
+	}
+
+	valid := &models.TwoFactorSignin{Challenge: challenge.Challenge, Code: totpCode(t, secret, 0)}
+	if res := f.app.Anonymous().Do("POST", "/users/signin/2fa", valid, nil); res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected the locked account not to complete the sign in, got %d.", res.StatusCode)
+	}
+}
+
+// pageLink returns the path of the given relation in the Link header of the response.
+func pageLink(res *http.Response, rel string) string {
+	for _, link := range strings.Split(res.Header.Get("Link"), ", ") {
+		parts := strings.SplitN(link, "; ", 2)
+		if len(parts) == 2 && parts[1] == `rel="`+rel+`"` {
+			return strings.Trim(parts[0], "<>")
+		}
+	}
+	return ""
+}
+
+func TestUsersPagination(t *testing.T) {
+	apptest.RunBackends(t, testUsersPagination)
+}
+
+func testUsersPagination(t *testing.T, config func() *viper.Viper) {
+	v := config()
+	v.Set(constants.PaginationDefaultLimit, 3)
+	v.Set(constants.PaginationMaxLimit, 4)
+
+	f := newFixture(t, v)
+	defer f.app.Close()
+
+	// The sort values are duplicated across the pages, the keys breaking the ties.
+	lastNames := []string{"Doe", "Doe", "Doe", "Roe", "Doe", "Roe", "Moe"}
+	created := []models.User{}
+	for i, lastName := range lastNames {
+		created = append(created, models.User{
+			Email:    fmt.Sprintf("page%d@page.io", i),
+			Password: apptest.Password,
+			LastName: lastName,
+			Role:     constants.RoleUser,
+		})
+	}
+	if res := f.admin.Do("POST", "/users", created, &created); res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d.", http.StatusCreated, res.StatusCode)
+	}
+
+	expected := append([]models.User{}, created...)
+	sort.SliceStable(expected, func(i, j int) bool {
+		if expected[i].LastName != expected[j].LastName {
+			return expected[i].LastName > expected[j].LastName
+		}
+		return expected[i].Key > expected[j].Key
+	})
+
+	m, _ := json.Marshal(map[string]interface{}{
+		"where": []map[string]interface{}{{"email": map[string]interface{}{"like": "%@page.io"}}},
+		"sort":  []string{"lastName DESC"},
+		"limit": 2,
+	})
+
+	walked := []models.User{}
+	pages := []string{}
+	for path := "/users?filter=" + url.QueryEscape(string(m)); path != ""; {
+		if len(pages) > len(lastNames) {
+			t.Fatalf("Expected the walk to end, got the pages %v.", pages)
+		}
+		pages = append(pages, path)
+
+		page := []models.User{}
+		res := f.admin.Do("GET", path, nil, &page)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+		}
+		if total := res.Header.Get("X-Total-Count"); total != strconv.Itoa(len(lastNames)) {
+			t.Errorf("Expected a total count of %d, got %s.", len(lastNames), total)
+		}
+
+		walked = append(walked, page...)
+		path = pageLink(res, "next")
+	}
+
+	if len(pages) != 4 || len(walked) != len(expected) {
+		t.Fatalf("Expected %d users in 4 pages, got %d in %d.", len(expected), len(walked), len(pages))
+	}
+	for i := range expected {
+		if walked[i].Key != expected[i].Key {
+			t.Errorf("Expected the user %s at position %d, got %s.", expected[i].Key, i, walked[i].Key)
+		}
+	}
+
+	// The previous page of the second one is the first one.
+	second := f.admin.Do("GET", pages[1], nil, nil)
+	first := []models.User{}
+	if res := f.admin.Do("GET", pageLink(second, "prev"), nil, &first); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+	if len(first) != 2 || first[0].Key != expected[0].Key || first[1].Key != expected[1].Key {
+		t.Errorf("Expected the first page to be returned, got %+v.", first)
+	}
+
+	// Without limit, the pages hold the default number of users, and never more than the maximum.
+	users := []models.User{}
+	if res := f.admin.Do("GET", "/users", nil, &users); len(users) != 3 || pageLink(res, "next") == "" {
+		t.Errorf("Expected a first page of 3 users, got %d.", len(users))
+	}
+	m, _ = json.Marshal(map[string]interface{}{"limit": 100})
+	if f.admin.Do("GET", "/users?filter="+url.QueryEscape(string(m)), nil, &users); len(users) != 4 {
+		t.Errorf("Expected a page of 4 users, got %d.", len(users))
+	}
+
+	m, _ = json.Marshal(map[string]interface{}{"sort": []string{"lastName DESC"}})
+	cursors := map[string]string{
+		"garbage":      "not a cursor!",
+		"other sort":   utils.EncodeCursor(&utils.Cursor{Sort: "firstName", Desc: true, Value: "Doe", Key: created[0].Key}),
+		"object value": utils.EncodeCursor(&utils.Cursor{Sort: "lastName", Desc: true, Value: map[string]interface{}{"a": 1}, Key: created[0].Key}),
+		"list value":   utils.EncodeCursor(&utils.Cursor{Sort: "lastName", Desc: true, Value: []interface{}{"Doe"}, Key: created[0].Key}),
+	}
+	for name, cursor := range cursors {
+		path := "/users?filter=" + url.QueryEscape(string(m)) + "&cursor=" + url.QueryEscape(cursor)
+		if res := f.admin.Do("GET", path, nil, nil); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d.", name, http.StatusBadRequest, res.StatusCode)
+		}
+	}
+}
+
+func TestUsersFieldsPolicy(t *testing.T) {
+	f := newFixture(t, nil)
+	defer f.app.Close()
+
+	users := []models.User{}
+	if res := f.admin.Do("GET", "/users?fields=email,lastName", nil, &users); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+	for _, user := range users {
+		if user.Key == "" || user.Email == "" || user.Role != "" {
+			t.Errorf("Expected only the selected fields, got %+v.", user)
+		}
+	}
+
+	private := []string{"password", "ownerToken", "twoFactorSecret", "twoFactorPendingSecret", "twoFactorLastCounter", "recoveryCodes"}
+	for _, field := range private {
+		if res := f.admin.Do("GET", "/users?fields=email,"+field, nil, nil); res.StatusCode != 422 {
+			t.Errorf("Expected the %s field to be refused on the list, got %d.", field, res.StatusCode)
+		}
+		if res := f.admin.Do("GET", "/users/"+f.target.User.Key+"?fields="+field, nil, nil); res.StatusCode != 422 {
+			t.Errorf("Expected the %s field to be refused by key, got %d.", field, res.StatusCode)
+		}
+		if res := f.user.Do("GET", "/users/me?fields="+field, nil, nil); res.StatusCode != 422 {
+			t.Errorf("Expected the %s field to be refused to the user, got %d.", field, res.StatusCode)
+		}
+	}
+
+	if res := f.user.Do("GET", "/users/me?fields=deletedBy", nil, nil); res.StatusCode != 422 {
+		t.Errorf("Expected the admin fields to be refused to the user, got %d.", res.StatusCode)
+	}
+
+	user := &models.User{}
+	if res := f.user.Do("GET", "/users/me?fields=email", nil, user); res.StatusCode != http.StatusOK || user.Email != f.user.User.Email {
+		t.Errorf("Expected the user to select its email, got %d and %+v.", res.StatusCode, user)
+	}
+}
+
+func TestUsersSensitiveFields(t *testing.T) {
+	apptest.RunBackends(t, testUsersSensitiveFields)
+}
+
+func testUsersSensitiveFields(t *testing.T, config func() *viper.Viper) {
+	f := newFixture(t, config())
+	defer f.app.Close()
+
+	enableTwoFactor(t, f.target)
+
+	private := []string{"password", "ownerToken", "twoFactorSecret", "twoFactorPendingSecret", "twoFactorLastCounter", "recoveryCodes"}
+
+	// leaked returns the private fields found in the decoded response body, whatever its status.
+	// The owner token is only returned to the admins, reading the whole documents.
+	leaked := func(body interface{}, ownerToken bool) []string {
+		docs, ok := body.([]interface{})
+		if !ok {
+			docs = []interface{}{body}
+		}
+
+		found := []string{}
+		for _, doc := range docs {
+			fields, _ := doc.(map[string]interface{})
+			for _, field := range private {
+				if _, ok := fields[field]; ok && !(ownerToken && field == "ownerToken") {
+					found = append(found, field)
+				}
+			}
+		}
+		return found
+	}
+
+	selections := []string{"", "email", "email,lastName", "_key", "*", "unknown", "twoFactorEnabled"}
+	for _, field := range private {
+		selections = append(selections, field, "email,"+field)
+	}
+
+	for _, fields := range selections {
+		query := "fields=" + url.QueryEscape(fields)
+
+		var body interface{}
+		f.admin.Do("GET", "/users"+emailFilter(f.target.User.Email)+"&"+query, nil, &body)
+		if found := leaked(body, fields == ""); len(found) != 0 {
+			t.Errorf("Expected the list selecting %q not to return %v.", fields, found)
+		}
+
+		body = nil
+		f.admin.Do("GET", "/users/"+f.target.User.Key+"?"+query, nil, &body)
+		if found := leaked(body, fields == ""); len(found) != 0 {
+			t.Errorf("Expected the user selected by key with %q not to return %v.", fields, found)
+		}
+
+		body = nil
+		f.user.Do("GET", "/users/me?"+query, nil, &body)
+		if found := leaked(body, false); len(found) != 0 {
+			t.Errorf("Expected the current user selecting %q not to return %v.", fields, found)
+		}
+	}
+
+	found := []interface{}{}
+	if res := f.admin.Do("GET", "/users/search?q="+url.QueryEscape(f.target.User.Email), nil, &found); res.StatusCode != http.StatusOK || len(found) == 0 {
+		t.Fatalf("Expected the target to be found, got %d and %v.", res.StatusCode, found)
+	}
+	if fields := leaked(found, true); len(fields) != 0 {
+		t.Errorf("Expected the search not to return %v.", fields)
+	}
+}
+
+func TestUsersSearchRanking(t *testing.T) {
+	apptest.RunBackends(t, testUsersSearchRanking)
+}
+
+func testUsersSearchRanking(t *testing.T, config func() *viper.Viper) {
+	f := newFixture(t, config())
+	defer f.app.Close()
+
+	// Inserted from the lowest to the highest rank, a whole last name scoring more than a prefix,
+	// itself scoring more than a word inside the email. The blacksmith matches no word prefix.
+	created := []models.User{
+		{Email: "ann.blacksmith@rank.io", LastName: "Blacksmith"},
+		{Email: "jo.smith@rank.io", LastName: "Doe"},
+		{Email: "b@rank.io", LastName: "Smithers"},
+		{Email: "a@rank.io", LastName: "Smith"},
+	}
+	for i := range created {
+		created[i].Password = apptest.Password
+		created[i].Role = constants.RoleUser
+	}
+	if res := f.admin.Do("POST", "/users", created, &created); res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d.", http.StatusCreated, res.StatusCode)
+	}
+
+	expected := []string{created[3].Key, created[2].Key, created[1].Key}
+
+	found := []models.User{}
+	res := f.admin.Do("GET", "/users/search?q=smith", nil, &found)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+	if total := res.Header.Get("X-Total-Count"); total != strconv.Itoa(len(expected)) {
+		t.Errorf("Expected %d matches, got %s.", len(expected), total)
+	}
+
+	keys := []string{}
+	for _, user := range found {
+		keys = append(keys, user.Key)
+	}
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected the users ranked as %v, got %v.", expected, keys)
+	}
+
+	walked := []string{}
+	for path := "/users/search?q=smith&limit=1"; path != ""; {
+		if len(walked) > len(expected) {
+			t.Fatalf("Expected the walk to end, walked %v.", walked)
+		}
+
+		page := []models.User{}
+		res := f.admin.Do("GET", path, nil, &page)
+		if res.StatusCode != http.StatusOK || len(page) != 1 {
+			t.Fatalf("Expected a page of one user, got %d and %+v.", res.StatusCode, page)
+		}
+		walked = append(walked, page[0].Key)
+
+		path = pageLink(res, "next")
+	}
+	if strings.Join(walked, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected the pages to keep the ranking %v, got %v.", expected, walked)
+	}
+}
+
+func TestUsersIfMatch(t *testing.T) {
+	apptest.RunBackends(t, testUsersIfMatch)
+}
+
+func testUsersIfMatch(t *testing.T, config func() *viper.Viper) {
+	f := newFixture(t, config())
+	defer f.app.Close()
+
+	path := "/users/" + f.target.User.Key
+
+	res := f.admin.Do("GET", path, nil, nil)
+	etag := res.Header.Get("ETag")
+	if res.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("Expected the user to be read with its ETag, got %d and %q.", res.StatusCode, etag)
+	}
+
+	replace := &models.User{Email: f.target.User.Email, FirstName: "Replaced"}
+	patch := map[string]interface{}{"firstName": "Patched"}
+
+	// The stale and weak tags are refused by every method, leaving the user untouched.
+	for _, tag := range []string{`"stale"`, "W/" + etag} {
+		admin := f.admin.WithHeader("If-Match", tag)
+
+		for _, r := range []struct {
+			method string
+			body   interface{}
+		}{{"PUT", replace}, {"PATCH", patch}, {"DELETE", nil}} {
+			if res := admin.Do(r.method, path, r.body, nil); res.StatusCode != http.StatusPreconditionFailed {
+				t.Errorf("%s with %s: expected status %d, got %d.", r.method, tag, http.StatusPreconditionFailed, res.StatusCode)
+			}
+		}
+	}
+
+	if res := f.target.WithHeader("If-Match", `"stale"`).Do("PATCH", "/users/me", patch, nil); res.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected a stale self update to be refused, got %d.", res.StatusCode)
+	}
+
+	if res := f.admin.Do("GET", path, nil, nil); res.Header.Get("ETag") != etag {
+		t.Fatalf("Expected the refused changes not to modify the user, got the ETag %q.", res.Header.Get("ETag"))
+	}
+
+	res = f.admin.WithHeader("If-Match", etag).Do("PUT", path, replace, nil)
+	replaced := res.Header.Get("ETag")
+	if res.StatusCode != http.StatusOK || replaced == etag {
+		t.Fatalf("Expected the matching replace to succeed with a new ETag, got %d and %q.", res.StatusCode, replaced)
+	}
+
+	if res := f.admin.WithHeader("If-Match", etag).Do("PATCH", path, patch, nil); res.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected the replaced revision to be stale, got %d.", res.StatusCode)
+	}
+
+	res = f.admin.WithHeader("If-Match", `"other", `+replaced).Do("PATCH", path, patch, nil)
+	patched := res.Header.Get("ETag")
+	if res.StatusCode != http.StatusOK || patched == replaced {
+		t.Fatalf("Expected a matching tag of the list to be accepted, got %d and %q.", res.StatusCode, patched)
+	}
+
+	if res := f.admin.WithHeader("If-Match", "*").Do("PATCH", path, patch, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected any revision to match *, got %d.", res.StatusCode)
+	}
+
+	res = f.admin.Do("GET", path, nil, nil)
+	if res := f.admin.WithHeader("If-Match", res.Header.Get("ETag")).Do("DELETE", path, nil, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the matching deletion to succeed, got %d.", res.StatusCode)
+	}
+}
+
+func TestUsersMergePatchAndReplace(t *testing.T) {
+	apptest.RunBackends(t, testUsersMergePatchAndReplace)
+}
+
+func testUsersMergePatchAndReplace(t *testing.T, config func() *viper.Viper) {
+	f := newFixture(t, config())
+	defer f.app.Close()
+
+	path := "/users/" + f.target.User.Key
+	named := map[string]interface{}{"firstName": "First", "lastName": "Last"}
+
+	if res := f.admin.Do("PATCH", path, named, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+
+	// A null clears the field, the omitted ones being kept.
+	user := &models.User{}
+	if res := f.admin.Do("PATCH", path, map[string]interface{}{"lastName": nil}, user); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+	if user.LastName != "" || user.FirstName != "First" || user.Email != f.target.User.Email {
+		t.Errorf("Expected only the last name to be cleared, got %+v.", user)
+	}
+
+	if res := f.admin.Do("PATCH", path, map[string]interface{}{"firstName": 3}, nil); res.StatusCode != 422 {
+		t.Errorf("Expected a mistyped field to be refused, got %d.", res.StatusCode)
+	}
+
+	// The users cannot patch the fields reserved to the admins.
+	f.target.Do("PATCH", "/users/me", map[string]interface{}{"firstName": "Self", "role": constants.RoleAdmin}, nil)
+	user = &models.User{}
+	f.admin.Do("GET", path, nil, user)
+	if user.FirstName != "Self" || user.Role != constants.RoleUser {
+		t.Errorf("Expected the first name to be patched but not the role, got %+v.", user)
+	}
+
+	// A replacement removes the omitted fields, the protected ones being preserved.
+	f.admin.Do("PATCH", path, named, nil)
+	user = &models.User{}
+	replacement := &models.User{Email: f.target.User.Email, FirstName: "Only"}
+	if res := f.admin.Do("PUT", path, replacement, user); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d.", http.StatusOK, res.StatusCode)
+	}
+	if user.FirstName != "Only" || user.LastName != "" || user.Role != constants.RoleUser {
+		t.Errorf("Expected the user to be replaced but its role, got %+v.", user)
+	}
+
+	f.target.Do("PUT", "/users/me", &models.User{Email: f.target.User.Email, Role: constants.RoleAdmin}, nil)
+	user = &models.User{}
+	f.admin.Do("GET", path, nil, user)
+	if user.FirstName != "" || user.Role != constants.RoleUser {
+		t.Errorf("Expected the user to replace itself but its role, got %+v.", user)
+	}
+
+	cred := &models.Credentials{Email: f.target.User.Email, Password: apptest.Password}
+	if res := f.app.Anonymous().Do("POST", "/users/signin", cred, nil); res.StatusCode != http.StatusCreated {
+		t.Errorf("Expected the password to be preserved, got %d.", res.StatusCode)
+	}
+}
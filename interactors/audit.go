@@ -0,0 +1,181 @@
+package interactors
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite/filters"
+	"github.com/solher/snakepit"
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+// auditRedacted replaces the value of the secret fields in the audit entries.
+const auditRedacted = "REDACTED"
+
+// auditRedactedFields are the user fields whose values never appear in the audit entries.
+// Their changes are still recorded.
+var auditRedactedFields = map[string]bool{
+	"password":               true,
+	"ownerToken":             true,
+	"twoFactorSecret":        true,
+	"twoFactorPendingSecret": true,
+	"recoveryCodes":          true,
+}
+
+type (
+	// AuditStore persists the audit entries. It is append-only: the entries can neither
+	// be updated nor removed.
+	AuditStore interface {
+		Insert(entry *models.AuditEntry) error
+		Find(f *filters.Filter) ([]models.AuditEntry, error)
+	}
+
+	// AuditContext describes the request performing the audited actions.
+	AuditContext struct {
+		Actor     *models.User
+		RequestID string
+		IP        string
+		UserAgent string
+	}
+
+	// Audit records who changed the users, or authenticated, and from where.
+	Audit struct {
+		snakepit.Interactor
+		Store   AuditStore
+		Context *AuditContext
+	}
+)
+
+func NewAudit(
+	c *viper.Viper,
+	l *logrus.Entry,
+	s AuditStore,
+	ctx *AuditContext,
+) *Audit {
+	if ctx == nil {
+		ctx = &AuditContext{}
+	}
+
+	return &Audit{
+		Interactor: *snakepit.NewInteractor(c, l),
+		Store:      s,
+		Context:    ctx,
+	}
+}
+
+// Record appends an entry for the action applied to the target user. Before and after are
+// the target states around the action, nil when it does not exist, and only their changed
+// fields are recorded.
+func (i *Audit) Record(action models.AuditAction, target string, before, after *models.User) error {
+	from, to, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	entry := &models.AuditEntry{
+		Action:    action,
+		Target:    target,
+		Before:    from,
+		After:     to,
+		RequestID: i.Context.RequestID,
+		IP:        i.Context.IP,
+		UserAgent: i.Context.UserAgent,
+		CreatedAt: &now,
+	}
+
+	if i.Context.Actor != nil {
+		entry.Actor = i.Context.Actor.Key
+	}
+
+	if err := i.Store.Insert(entry); err != nil {
+		return merry.Prependf(err, "could not record the %s audit entry", action)
+	}
+
+	return nil
+}
+
+// Find returns the entries matched by filter, the most recent first unless sorted otherwise.
+// The page size is bounded like the users one.
+func (i *Audit) Find(f *filters.Filter) ([]models.AuditEntry, error) {
+	page := &filters.Filter{}
+	if f != nil {
+		*page = *f
+	}
+
+	page.Limit = pageLimit(i.Constants, page.Limit)
+
+	if len(page.Sort) == 0 {
+		page.Sort = []string{"createdAt DESC"}
+	}
+
+	return i.Store.Find(page)
+}
+
+// auditDiff returns the fields that differ between the two states of a user, with their
+// values before and after. The system attributes are ignored and the secrets are redacted.
+func auditDiff(before, after *models.User) (map[string]interface{}, map[string]interface{}, error) {
+	from, err := auditFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	to, err := auditFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changedFrom := map[string]interface{}{}
+	changedTo := map[string]interface{}{}
+
+	for name, value := range from {
+		if !reflect.DeepEqual(value, to[name]) {
+			changedFrom[name] = auditValue(name, value)
+		}
+	}
+
+	for name, value := range to {
+		if !reflect.DeepEqual(value, from[name]) {
+			changedTo[name] = auditValue(name, value)
+		}
+	}
+
+	return changedFrom, changedTo, nil
+}
+
+func auditFields(user *models.User) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+
+	if user == nil {
+		return fields, nil
+	}
+
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return nil, merry.Here(err)
+	}
+
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	delete(fields, "_id")
+	delete(fields, "_rev")
+	delete(fields, "_key")
+
+	return fields, nil
+}
+
+func auditValue(name string, value interface{}) interface{} {
+	if auditRedactedFields[name] {
+		return auditRedacted
+	}
+
+	return value
+}
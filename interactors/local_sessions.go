@@ -0,0 +1,176 @@
+package interactors
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite"
+	"github.com/solher/snakepit"
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+type (
+	// LocalSessions stores the sessions in the ArangoDB sessions collection,
+	// allowing the API to run without the external auth server. Like the other tokens,
+	// only the hash of the session tokens is stored, in their indexed token attribute.
+	LocalSessions struct {
+		snakepit.Interactor
+		Repo QueryRunner
+	}
+)
+
+func NewLocalSessions(
+	c *viper.Viper,
+	l *logrus.Entry,
+	r QueryRunner,
+) *LocalSessions {
+	return &LocalSessions{
+		Interactor: *snakepit.NewInteractor(c, l),
+		Repo:       r,
+	}
+}
+
+func (i *LocalSessions) Create(session *models.Session) (*models.Session, error) {
+	now := time.Now().UTC()
+	validTo := now.Add(i.Constants.GetDuration(constants.SessionsTTL))
+	token := utils.GenToken(64)
+
+	stored := *session
+	stored.ID = ""
+	stored.Token = utils.HashToken(token)
+	stored.Created = &now
+	stored.ValidTo = &validTo
+
+	q := arangolite.NewQuery(`
+		FOR s IN sessions
+		FILTER s.ownerToken == @ownerToken && DATE_TIMESTAMP(s.validTo) <= DATE_NOW()
+		REMOVE s IN sessions
+	`).Bind("ownerToken", stored.OwnerToken)
+
+	if err := i.Repo.Run(q, nil); err != nil {
+		return nil, err
+	}
+
+	q = arangolite.NewQuery(`
+		INSERT @session IN sessions
+		RETURN NEW
+	`).Bind("session", stored)
+
+	sessions := []models.Session{}
+
+	if err := i.Repo.Run(q, &sessions); err != nil {
+		return nil, err
+	}
+
+	return localSession(sessions[0], token), nil
+}
+
+func (i *LocalSessions) FindByToken(token string) (*models.Session, error) {
+	q := arangolite.NewQuery(`
+		FOR s IN sessions
+		FILTER s.token == @hash && DATE_TIMESTAMP(s.validTo) > DATE_NOW()
+		LIMIT 1
+		RETURN s
+	`).Bind("hash", utils.HashToken(token))
+
+	sessions := []models.Session{}
+
+	if err := i.Repo.Run(q, &sessions); err != nil {
+		return nil, err
+	}
+
+	if len(sessions) == 0 {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	return localSession(sessions[0], token), nil
+}
+
+func (i *LocalSessions) Delete(token string) (*models.Session, error) {
+	q := arangolite.NewQuery(`
+		FOR s IN sessions
+		FILTER s.token == @hash
+		REMOVE s IN sessions
+		RETURN OLD
+	`).Bind("hash", utils.HashToken(token))
+
+	sessions := []models.Session{}
+
+	if err := i.Repo.Run(q, &sessions); err != nil {
+		return nil, err
+	}
+
+	if len(sessions) == 0 {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	return localSession(sessions[0], token), nil
+}
+
+// FindByOwnerToken returns the active sessions of the owner. Their tokens being only stored
+// hashed, they are identified by their ID.
+func (i *LocalSessions) FindByOwnerToken(ownerToken string) ([]models.Session, error) {
+	q := arangolite.NewQuery(`
+		FOR s IN sessions
+		FILTER s.ownerToken == @ownerToken && DATE_TIMESTAMP(s.validTo) > DATE_NOW()
+		SORT s.created DESC
+		RETURN s
+	`).Bind("ownerToken", ownerToken)
+
+	sessions := []models.Session{}
+
+	if err := i.Repo.Run(q, &sessions); err != nil {
+		return nil, err
+	}
+
+	for j := range sessions {
+		sessions[j] = *localSession(sessions[j], "")
+	}
+
+	return sessions, nil
+}
+
+func (i *LocalSessions) DeleteByIDs(ownerToken string, ids []string) ([]models.Session, error) {
+	q := arangolite.NewQuery(`
+		FOR s IN sessions
+		FILTER s.ownerToken == @ownerToken && s.token IN @ids
+		REMOVE s IN sessions
+		RETURN OLD
+	`).Bind("ownerToken", ownerToken).Bind("ids", ids)
+
+	sessions := []models.Session{}
+
+	if err := i.Repo.Run(q, &sessions); err != nil {
+		return nil, err
+	}
+
+	for j := range sessions {
+		sessions[j] = *localSession(sessions[j], "")
+	}
+
+	return sessions, nil
+}
+
+func (i *LocalSessions) DeleteCascade(ownerTokens []string) error {
+	q := arangolite.NewQuery(`
+		FOR s IN sessions
+		FILTER s.ownerToken IN @ownerTokens
+		REMOVE s IN sessions
+	`).Bind("ownerTokens", ownerTokens)
+
+	return i.Repo.Run(q, nil)
+}
+
+// localSession maps a stored session, whose token attribute holds the hash of the token,
+// to the session identified by this hash along the given token, if known.
+func localSession(stored models.Session, token string) *models.Session {
+	stored.ID = stored.Token
+	stored.Token = token
+	return &stored
+}
@@ -0,0 +1,114 @@
+package interactors
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+)
+
+// accountFailuresKey normalizes the email so that its variants share the same counter.
+func accountFailuresKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipFailuresKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLockout returns an AccountLocked error carrying the remaining lockout duration
+// as "retryAfter" value if either the account or the IP is locked.
+func (i *Users) checkLockout(email, ip string) error {
+	accountWait, err := i.lockedFor(accountFailuresKey(email), i.Constants.GetInt(constants.LockoutAccountThreshold))
+	if err != nil {
+		return err
+	}
+
+	ipWait, err := i.lockedFor(ipFailuresKey(ip), i.Constants.GetInt(constants.LockoutIPThreshold))
+	if err != nil {
+		return err
+	}
+
+	wait := accountWait
+	if ipWait > wait {
+		wait = ipWait
+	}
+
+	if wait > 0 {
+		return merry.Here(errs.AccountLocked).WithValue("retryAfter", wait)
+	}
+
+	return nil
+}
+
+// lockedFor returns how long the key stays locked. Once the threshold is reached, each new failure
+// doubles the lockout duration, up to the configured maximum. A zero maximum means no cap.
+func (i *Users) lockedFor(key string, threshold int) (time.Duration, error) {
+	count, last, err := i.Failures.Get(key)
+	if err != nil {
+		return 0, merry.Here(err)
+	}
+
+	if threshold <= 0 || count < threshold {
+		return 0, nil
+	}
+
+	lockout := i.Constants.GetDuration(constants.LockoutDuration)
+	max := i.Constants.GetDuration(constants.LockoutMaxDuration)
+	if max <= 0 {
+		max = time.Duration(math.MaxInt64)
+	}
+
+	for n := count - threshold; n > 0 && lockout < max; n-- {
+		// Doubling past the half of the maximum would overflow when there is no cap.
+		if lockout > max/2 {
+			lockout = max
+			break
+		}
+		lockout *= 2
+	}
+
+	if lockout > max {
+		lockout = max
+	}
+
+	wait := last.Add(lockout).Sub(time.Now())
+	if wait < 0 {
+		return 0, nil
+	}
+
+	return wait, nil
+}
+
+func (i *Users) recordFailure(email, ip string) error {
+	if _, err := i.Failures.Incr(accountFailuresKey(email)); err != nil {
+		return merry.Here(err)
+	}
+
+	if _, err := i.Failures.Incr(ipFailuresKey(ip)); err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
+
+// Unlock clears the failed sign in attempts of the user account.
+func (i *Users) Unlock(key string) (*models.User, error) {
+	user, err := i.FindByKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.Failures.Reset(accountFailuresKey(user.Email)); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	i.record(constants.AuditUserUnlock, user.Key, nil, nil)
+
+	return user, nil
+}
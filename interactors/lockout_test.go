@@ -0,0 +1,69 @@
+package interactors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/solher/snakepit"
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/constants"
+)
+
+// fakeFailures holds the given failures count, the last one happening now.
+type fakeFailures struct {
+	count int
+	last  time.Time
+}
+
+func (f *fakeFailures) Get(key string) (int, time.Time, error) {
+	return f.count, f.last, nil
+}
+
+func (f *fakeFailures) Incr(key string) (int, error) {
+	f.count++
+	f.last = time.Now()
+	return f.count, nil
+}
+
+func (f *fakeFailures) Reset(key string) error {
+	f.count = 0
+	return nil
+}
+
+func TestLockedFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxDuration time.Duration
+		count       int
+		lockout     time.Duration
+	}{
+		{"below the threshold", time.Hour, 4, 0},
+		{"first lockout", time.Hour, 5, time.Minute},
+		{"doubled lockout", time.Hour, 7, 4 * time.Minute},
+		{"capped lockout", 2 * time.Minute, 7, 2 * time.Minute},
+		{"uncapped lockout", 0, 12, 128 * time.Minute},
+		{"uncapped lockout without overflow", 0, 1000, time.Duration(1<<63 - 1)},
+	}
+
+	for _, test := range tests {
+		v := viper.New()
+		v.Set(constants.LockoutDuration, time.Minute)
+		v.Set(constants.LockoutMaxDuration, test.maxDuration)
+
+		i := &Users{
+			Interactor: *snakepit.NewInteractor(v, nil),
+			Failures:   &fakeFailures{count: test.count, last: time.Now()},
+		}
+
+		wait, err := i.lockedFor("account:user@localhost", 5)
+		if err != nil {
+			t.Fatalf("%s: could not compute the lockout: %v", test.name, err)
+		}
+
+		// A few milliseconds elapse between the failure and the check.
+		if wait > test.lockout || wait < test.lockout-time.Second {
+			t.Errorf("%s: expected a lockout of %v, got %v.", test.name, test.lockout, wait)
+		}
+	}
+}
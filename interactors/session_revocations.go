@@ -0,0 +1,137 @@
+package interactors
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/solher/snakepit"
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/models"
+)
+
+const revocationsBatchSize = 100
+
+type (
+	SessionsCascader interface {
+		DeleteCascade(ownerTokens []string) error
+	}
+
+	SessionRevocationsStore interface {
+		Insert(revocation *models.SessionRevocation) error
+		FindPending(limit int) ([]models.SessionRevocation, error)
+		Reschedule(key string, attempts int, next time.Time, lastError string) error
+		Delete(key string) error
+	}
+
+	// SessionRevocations revokes the sessions of removed users. Revocations the sessions
+	// backend fails to process are stored and retried later with an exponential backoff,
+	// so the sessions never outlive their users.
+	SessionRevocations struct {
+		snakepit.Interactor
+		Store         SessionRevocationsStore
+		SessionsInter SessionsCascader
+	}
+)
+
+func NewSessionRevocations(
+	c *viper.Viper,
+	l *logrus.Entry,
+	s SessionRevocationsStore,
+	si SessionsCascader,
+) *SessionRevocations {
+	return &SessionRevocations{
+		Interactor:    *snakepit.NewInteractor(c, l),
+		Store:         s,
+		SessionsInter: si,
+	}
+}
+
+// Revoke deletes the sessions of the given users. If the sessions backend fails,
+// the revocation is queued for retry and no error is returned.
+func (i *SessionRevocations) Revoke(users []models.User) error {
+	ownerTokens := []string{}
+	for _, user := range users {
+		if user.OwnerToken != "" {
+			ownerTokens = append(ownerTokens, user.OwnerToken)
+		}
+	}
+
+	if len(ownerTokens) == 0 {
+		return nil
+	}
+
+	err := i.SessionsInter.DeleteCascade(ownerTokens)
+	if err == nil {
+		return nil
+	}
+
+	i.Logger.WithField("error", err).Warn("Could not revoke the sessions. Queuing the revocation for retry.")
+
+	now := time.Now().UTC()
+	next := now.Add(i.backoff(1))
+
+	revocation := &models.SessionRevocation{
+		OwnerTokens: ownerTokens,
+		Attempts:    1,
+		NextAttempt: &next,
+		LastError:   err.Error(),
+	}
+
+	return i.Store.Insert(revocation)
+}
+
+// RetryPending retries the queued revocations whose backoff has elapsed. A revocation
+// which cannot be deleted or rescheduled is logged, the rest of the batch being retried.
+func (i *SessionRevocations) RetryPending() error {
+	revocations, err := i.Store.FindPending(revocationsBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, revocation := range revocations {
+		if err := i.retry(&revocation); err != nil {
+			i.Logger.WithFields(logrus.Fields{
+				"error":      err,
+				"revocation": revocation.Key,
+			}).Error("Could not update the session revocation.")
+		}
+	}
+
+	return nil
+}
+
+func (i *SessionRevocations) retry(revocation *models.SessionRevocation) error {
+	err := i.SessionsInter.DeleteCascade(revocation.OwnerTokens)
+	if err == nil {
+		return i.Store.Delete(revocation.Key)
+	}
+
+	attempts := revocation.Attempts + 1
+	next := time.Now().UTC().Add(i.backoff(attempts))
+
+	i.Logger.WithFields(logrus.Fields{
+		"error":    err,
+		"attempts": attempts,
+		"next":     next,
+	}).Warn("Could not revoke the sessions.")
+
+	return i.Store.Reschedule(revocation.Key, attempts, next, err.Error())
+}
+
+// backoff doubles the retry interval at each attempt, up to the configured maximum.
+func (i *SessionRevocations) backoff(attempts int) time.Duration {
+	wait := i.Constants.GetDuration(constants.SessionsRevocationInterval)
+	max := i.Constants.GetDuration(constants.SessionsRevocationMaxBackoff)
+
+	for n := 1; n < attempts && wait < max; n++ {
+		wait *= 2
+	}
+
+	if max > 0 && wait > max {
+		wait = max
+	}
+
+	return wait
+}
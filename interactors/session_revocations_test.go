@@ -0,0 +1,70 @@
+package interactors
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+// fakeRevocations holds the given pending revocations, failing to delete the broken ones.
+type fakeRevocations struct {
+	pending []models.SessionRevocation
+	broken  map[string]bool
+	deleted []string
+}
+
+func (s *fakeRevocations) Insert(revocation *models.SessionRevocation) error {
+	return nil
+}
+
+func (s *fakeRevocations) FindPending(limit int) ([]models.SessionRevocation, error) {
+	return s.pending, nil
+}
+
+func (s *fakeRevocations) Reschedule(key string, attempts int, next time.Time, lastError string) error {
+	return nil
+}
+
+func (s *fakeRevocations) Delete(key string) error {
+	if s.broken[key] {
+		return errors.New("store unavailable")
+	}
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+type fakeCascader struct{}
+
+func (c fakeCascader) DeleteCascade(ownerTokens []string) error {
+	return nil
+}
+
+func TestRetryPendingContinuesAfterStoreError(t *testing.T) {
+	store := &fakeRevocations{
+		pending: []models.SessionRevocation{
+			{Document: models.Document{Key: "1"}},
+			{Document: models.Document{Key: "2"}},
+			{Document: models.Document{Key: "3"}},
+		},
+		broken: map[string]bool{"2": true},
+	}
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+
+	i := NewSessionRevocations(viper.New(), logrus.NewEntry(l), store, fakeCascader{})
+
+	if err := i.RetryPending(); err != nil {
+		t.Fatalf("Expected the store error to be logged, got %v.", err)
+	}
+
+	if len(store.deleted) != 2 || store.deleted[0] != "1" || store.deleted[1] != "3" {
+		t.Errorf("Expected the rest of the batch to be retried, deleted %v.", store.deleted)
+	}
+}
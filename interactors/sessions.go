@@ -2,17 +2,26 @@ package interactors
 
 import (
 	"encoding/json"
-	"sync"
+	"net/url"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/ansel1/merry"
 	"github.com/solher/snakepit"
 	"github.com/spf13/viper"
 
 	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/errs"
 	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
 )
 
 type (
+	// Sessions manages the sessions through the auth server API. The auth server must implement:
+	//  POST   /sessions                  creates a session and returns it with its token.
+	//  DELETE /sessions/{token}          deletes a session, 404 when it does not exist.
+	//  GET    /sessions?ownerTokens=[..] lists the sessions of the JSON encoded owner tokens.
+	//  DELETE /sessions?ownerTokens=[..] deletes the sessions of the JSON encoded owner tokens.
+	// The apptest fake auth server implements the same contract.
 	Sessions struct {
 		snakepit.Interactor
 		Repo HTTPSender
@@ -60,23 +69,74 @@ func (i *Sessions) Delete(token string) (*models.Session, error) {
 	return session, nil
 }
 
-func (i *Sessions) DeleteCascade(wg *sync.WaitGroup, users []models.User) {
-	ownerTokens := []string{}
-	for _, user := range users {
-		ownerTokens = append(ownerTokens, user.OwnerToken)
+// FindByOwnerToken returns the sessions of the owner, along their ID.
+func (i *Sessions) FindByOwnerToken(ownerToken string) ([]models.Session, error) {
+	m, _ := json.Marshal([]string{ownerToken})
+
+	sessions := []models.Session{}
+
+	if err := i.Repo.Send(
+		"",
+		"GET",
+		i.Constants.GetString(constants.AuthServerURL)+"/sessions?ownerTokens="+url.QueryEscape(string(m)),
+		nil,
+		&sessions,
+	); err != nil {
+		return nil, err
+	}
+
+	for j := range sessions {
+		sessions[j].ID = utils.HashToken(sessions[j].Token)
 	}
 
+	return sessions, nil
+}
+
+// DeleteByIDs deletes the sessions of the owner with the given IDs. The auth server only
+// deleting the sessions by token, they are first listed.
+func (i *Sessions) DeleteByIDs(ownerToken string, ids []string) ([]models.Session, error) {
+	owned, err := i.FindByOwnerToken(ownerToken)
+	if err != nil {
+		return nil, err
+	}
+
+	deleting := map[string]bool{}
+	for _, id := range ids {
+		deleting[id] = true
+	}
+
+	sessions := []models.Session{}
+
+	for _, session := range owned {
+		if !deleting[session.ID] {
+			continue
+		}
+
+		deleted, err := i.Delete(session.Token)
+		if err != nil {
+			if merry.Is(err, errs.NotFound) {
+				continue
+			}
+			return nil, err
+		}
+		sessions = append(sessions, *deleted)
+	}
+
+	return sessions, nil
+}
+
+func (i *Sessions) DeleteCascade(ownerTokens []string) error {
 	m, _ := json.Marshal(ownerTokens)
 
 	if err := i.Repo.Send(
 		"",
 		"DELETE",
-		i.Constants.GetString(constants.AuthServerURL)+"/sessions?ownerTokens="+string(m),
+		i.Constants.GetString(constants.AuthServerURL)+"/sessions?ownerTokens="+url.QueryEscape(string(m)),
 		nil,
 		nil,
-	); err != nil {
-		panic(err)
+	); err != nil && !merry.Is(err, errs.NotFound) {
+		return err
 	}
 
-	wg.Done()
+	return nil
 }
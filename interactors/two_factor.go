@@ -0,0 +1,252 @@
+package interactors
+
+import (
+	"time"
+
+	"github.com/ansel1/merry"
+
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+const recoveryCodesCount = 10
+
+// EnrollTwoFactor generates a new TOTP secret for the user. The secret stays pending
+// until a valid code is sent to ConfirmTwoFactor.
+func (i *Users) EnrollTwoFactor(key string) (*models.TwoFactorSetup, error) {
+	user, err := i.FindByKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, merry.Here(errs.TwoFactorAlreadyEnabled)
+	}
+
+	secret, err := utils.GenTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := i.patch(constants.AuditUserTwoFactorEnroll, user, key, nil, map[string]interface{}{"twoFactorPendingSecret": secret}); err != nil {
+		return nil, err
+	}
+
+	setup := &models.TwoFactorSetup{
+		Secret: secret,
+		URI:    utils.TOTPURI(i.Constants.GetString(constants.TwoFactorIssuer), user.Email, secret),
+	}
+
+	return setup, nil
+}
+
+// ConfirmTwoFactor enables the two-factor authentication if the code matches the pending
+// secret and returns a fresh set of recovery codes.
+func (i *Users) ConfirmTwoFactor(key, code string) (*models.RecoveryCodes, error) {
+	user, err := i.FindByKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, merry.Here(errs.TwoFactorAlreadyEnabled)
+	}
+
+	if len(user.TwoFactorPendingSecret) == 0 {
+		return nil, merry.Here(errs.TwoFactorNotEnabled)
+	}
+
+	counter, ok := utils.ValidateTOTP(
+		user.TwoFactorPendingSecret,
+		code,
+		time.Now(),
+		int64(i.Constants.GetInt(constants.TwoFactorSkew)),
+	)
+	if !ok {
+		return nil, merry.Here(errs.InvalidCode)
+	}
+
+	codes, hashes := genRecoveryCodes()
+
+	patch := map[string]interface{}{
+		"twoFactorEnabled":       true,
+		"twoFactorSecret":        user.TwoFactorPendingSecret,
+		"twoFactorPendingSecret": nil,
+		"twoFactorLastCounter":   counter,
+		"recoveryCodes":          hashes,
+	}
+
+	// The revision check ensures the pending secret has not changed since it was read.
+	if _, err := i.patch(constants.AuditUserTwoFactorConfirm, user, key, []string{user.Rev}, patch); err != nil {
+		if merry.Is(err, errs.NotFound) {
+			return nil, merry.Here(errs.InvalidCode)
+		}
+		return nil, err
+	}
+
+	return &models.RecoveryCodes{Codes: codes}, nil
+}
+
+// DisableTwoFactor disables the two-factor authentication after checking a TOTP or recovery code.
+func (i *Users) DisableTwoFactor(key, code string) (*models.User, error) {
+	user, err := i.FindByKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled {
+		return nil, merry.Here(errs.TwoFactorNotEnabled)
+	}
+
+	if err := i.checkSecondFactor(user, code); err != nil {
+		return nil, err
+	}
+
+	patch := map[string]interface{}{
+		"twoFactorEnabled":       nil,
+		"twoFactorSecret":        nil,
+		"twoFactorPendingSecret": nil,
+		"twoFactorLastCounter":   nil,
+		"recoveryCodes":          nil,
+	}
+
+	return i.patch(constants.AuditUserTwoFactorDisable, user, key, nil, patch)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user after checking a TOTP or recovery code.
+func (i *Users) RegenerateRecoveryCodes(key, code string) (*models.RecoveryCodes, error) {
+	user, err := i.FindByKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled {
+		return nil, merry.Here(errs.TwoFactorNotEnabled)
+	}
+
+	if err := i.checkSecondFactor(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes := genRecoveryCodes()
+
+	if _, err := i.patch(constants.AuditUserRecoveryCodes, user, key, nil, map[string]interface{}{"recoveryCodes": hashes}); err != nil {
+		return nil, err
+	}
+
+	return &models.RecoveryCodes{Codes: codes}, nil
+}
+
+// SigninTwoFactor exchanges a challenge issued by Signin and a TOTP or recovery code for a session.
+// The challenge is consumed before the code is checked, so a wrong code requires signing in again.
+// Wrong codes are counted and audited like wrong passwords and lead to the same lockouts.
+func (i *Users) SigninTwoFactor(challenge, code, agent, ip string) (*models.Session, error) {
+	t, err := i.consumeToken("twoFactorChallenges", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := i.FindByKey(t.UserKey, nil)
+	if err != nil {
+		if merry.Is(err, errs.NotFound) {
+			return nil, merry.Here(errs.InvalidToken)
+		}
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled {
+		return nil, merry.Here(errs.InvalidToken)
+	}
+
+	if err := i.checkLockout(user.Email, ip); err != nil {
+		if merry.Is(err, errs.AccountLocked) {
+			i.record(constants.AuditUserSigninLocked, user.Key, nil, nil)
+		}
+		return nil, err
+	}
+
+	if err := i.checkSecondFactor(user, code); err != nil {
+		if merry.Is(err, errs.InvalidCode) {
+			i.record(constants.AuditUserTwoFactorFailed, user.Key, nil, nil)
+			if err := i.recordFailure(user.Email, ip); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	if err := i.Failures.Reset(accountFailuresKey(user.Email)); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	return i.createSession(user, agent)
+}
+
+func (i *Users) issueChallenge(user *models.User) (*models.TwoFactorChallenge, error) {
+	ttl := i.Constants.GetDuration(constants.TwoFactorChallengeTTL)
+
+	challenge, err := i.issueToken("twoFactorChallenges", user, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().UTC().Add(ttl)
+
+	return &models.TwoFactorChallenge{Challenge: challenge, ExpiresAt: &expiresAt}, nil
+}
+
+// checkSecondFactor accepts either a TOTP code, which must belong to a more recent time step
+// than the last accepted one, or a recovery code, which is then removed. The user is only
+// updated if its revision did not change, so a code cannot be accepted twice concurrently.
+func (i *Users) checkSecondFactor(user *models.User, code string) error {
+	counter, ok := utils.ValidateTOTP(
+		user.TwoFactorSecret,
+		code,
+		time.Now(),
+		int64(i.Constants.GetInt(constants.TwoFactorSkew)),
+	)
+
+	var patch map[string]interface{}
+
+	switch {
+	case ok && counter > user.TwoFactorLastCounter:
+		patch = map[string]interface{}{"twoFactorLastCounter": counter}
+	case ok:
+		return merry.Here(errs.InvalidCode)
+	default:
+		hash := utils.HashToken(code)
+		codes := []string{}
+		for _, c := range user.RecoveryCodes {
+			if c != hash {
+				codes = append(codes, c)
+			}
+		}
+		if len(codes) == len(user.RecoveryCodes) {
+			return merry.Here(errs.InvalidCode)
+		}
+		patch = map[string]interface{}{"recoveryCodes": codes}
+	}
+
+	if _, err := i.Store.Patch(user.Key, []string{user.Rev}, patch); err != nil {
+		if merry.Is(err, errs.NotFound) {
+			return merry.Here(errs.InvalidCode)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func genRecoveryCodes() ([]string, []string) {
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+
+	for i := range codes {
+		codes[i] = utils.GenToken(10)
+		hashes[i] = utils.HashToken(codes[i])
+	}
+
+	return codes, hashes
+}
@@ -0,0 +1,75 @@
+package interactors
+
+import (
+	"github.com/ansel1/merry"
+
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+// FindSessions returns the active sessions of the user.
+func (i *Users) FindSessions(key string) ([]models.Session, error) {
+	user, err := i.FindByKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.SessionsInter.FindByOwnerToken(user.OwnerToken)
+}
+
+// DeleteSession revokes a session of the user, designated by its identifier: the hash of its
+// token. The raw token is not accepted, so that it never appears in the URLs.
+func (i *Users) DeleteSession(key, id string) (*models.Session, error) {
+	user, err := i.FindByKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := i.SessionsInter.DeleteByIDs(user.OwnerToken, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deleted) == 0 {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	i.record(constants.AuditUserSessionsDelete, key, nil, nil)
+
+	return &deleted[0], nil
+}
+
+// DeleteSessions revokes all the sessions of the user but the one of the given token, if any.
+func (i *Users) DeleteSessions(key, exceptToken string) ([]models.Session, error) {
+	user, err := i.FindByKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := i.SessionsInter.FindByOwnerToken(user.OwnerToken)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, session := range sessions {
+		if exceptToken == "" || session.ID != utils.HashToken(exceptToken) {
+			ids = append(ids, session.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return []models.Session{}, nil
+	}
+
+	deleted, err := i.SessionsInter.DeleteByIDs(user.OwnerToken, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	i.record(constants.AuditUserSessionsDelete, key, nil, nil)
+
+	return deleted, nil
+}
@@ -2,7 +2,10 @@ package interactors
 
 import (
 	"encoding/json"
-	"sync"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/solher/snakepit-seed/constants"
 	"github.com/solher/snakepit-seed/utils"
@@ -13,37 +16,106 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/ansel1/merry"
-	"github.com/solher/arangolite"
 	"github.com/solher/arangolite/filters"
 	"github.com/solher/snakepit"
 	"github.com/solher/snakepit-seed/models"
 	"github.com/spf13/viper"
 )
 
+var (
+	dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), 11)
+
+	sortFieldRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
 type (
 	SessionsReaderWriter interface {
 		Create(session *models.Session) (*models.Session, error)
 		Delete(token string) (*models.Session, error)
-		DeleteCascade(wg *sync.WaitGroup, users []models.User)
+		FindByOwnerToken(ownerToken string) ([]models.Session, error)
+		DeleteByIDs(ownerToken string, ids []string) ([]models.Session, error)
+		DeleteCascade(ownerTokens []string) error
+	}
+
+	SessionsRevoker interface {
+		Revoke(users []models.User) error
+	}
+
+	// UsersStore persists the users. The updates changing an email reset its verification
+	// and a taken email is reported by EmailTaken.
+	UsersStore interface {
+		Find(f *filters.Filter, fields []string) ([]models.User, error)
+		Count(f *filters.Filter) (int, error)
+		FindByEmail(email string) (*models.User, error)
+		Insert(users []models.User) ([]models.User, error)
+		Update(f *filters.Filter, revs []string, user *models.User) ([]models.User, error)
+		Replace(key string, revs []string, user *models.User) (*models.User, error)
+		Patch(key string, revs []string, patch map[string]interface{}) (*models.User, error)
+		Delete(f *filters.Filter) ([]models.User, error)
+	}
+
+	// TokensStore persists the hashed single-use tokens, one collection per usage.
+	TokensStore interface {
+		Replace(collection string, token *models.Token) error
+		Find(collection, hash string) (*models.Token, error)
+		Consume(collection, hash string) (*models.Token, error)
+		Delete(collection, userKey string) error
+	}
+
+	UsersSearcher interface {
+		Search(words []string, offset, limit int) ([]models.User, int, error)
+	}
+
+	Notifier interface {
+		SendResetToken(user *models.User, token string) error
+		SendVerificationToken(user *models.User, token string) error
+	}
+
+	FailuresCounter interface {
+		Get(key string) (int, time.Time, error)
+		Incr(key string) (int, error)
+		Reset(key string) error
+	}
+
+	UsersAuditor interface {
+		Record(action models.AuditAction, target string, before, after *models.User) error
 	}
 
 	Users struct {
 		snakepit.Interactor
-		Repo          QueryRunner
+		Store         UsersStore
+		Tokens        TokensStore
 		SessionsInter SessionsReaderWriter
+		Notifier      Notifier
+		Failures      FailuresCounter
+		Revocations   SessionsRevoker
+		Searcher      UsersSearcher
+		Audit         UsersAuditor
 	}
 )
 
 func NewUsers(
 	c *viper.Viper,
 	l *logrus.Entry,
-	r QueryRunner,
+	s UsersStore,
+	t TokensStore,
 	si SessionsReaderWriter,
+	n Notifier,
+	fc FailuresCounter,
+	sr SessionsRevoker,
+	us UsersSearcher,
+	a UsersAuditor,
 ) *Users {
 	return &Users{
 		Interactor:    *snakepit.NewInteractor(c, l),
-		Repo:          r,
+		Store:         s,
+		Tokens:        t,
 		SessionsInter: si,
+		Notifier:      n,
+		Failures:      fc,
+		Revocations:   sr,
+		Searcher:      us,
+		Audit:         a,
 	}
 }
 
@@ -55,37 +127,264 @@ func (i *Users) Signup(user *models.User) (*models.User, error) {
 		return nil, err
 	}
 
-	return &users[0], nil
+	user = &users[0]
+
+	if err := i.sendVerification(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
 }
 
 func (i *Users) Find(f *filters.Filter) ([]models.User, error) {
-	filter, err := utils.FilterToAQL("u", f)
+	return i.Store.Find(scope(f), nil)
+}
+
+// FindPage returns a page of the users matched by filter, starting after (or before) the given cursor.
+// Pages are sorted on the first sort clause of the filter, then on the key,
+// which keeps the pagination stable and avoids scanning the skipped documents. The page size is
+// the filter limit, bounded by the configured maximum.
+// When fields is not nil, only the given fields are returned, plus the key, the revision and the sort field.
+func (i *Users) FindPage(f *filters.Filter, cursor string, fields []string) ([]models.User, *models.Page, error) {
+	f = scope(f)
+
+	limit := pageLimit(i.Constants, f.Limit)
+
+	order := &utils.Cursor{Sort: "_key"}
+	if len(f.Sort) > 0 {
+		clause := strings.Fields(f.Sort[0])
+		if len(clause) == 0 || len(clause) > 2 || !sortFieldRegexp.MatchString(clause[0]) {
+			return nil, nil, merry.Here(errs.InvalidFilter)
+		}
+		order.Sort = clause[0]
+		order.Desc = len(clause) == 2 && strings.ToUpper(clause[1]) == "DESC"
+	}
+
+	var from *utils.Cursor
+	if cursor != "" {
+		var err error
+		if from, err = utils.DecodeCursor(cursor); err != nil {
+			return nil, nil, err
+		}
+		// The cursor cannot change the ordering, which is checked by the filter policies.
+		if from.Sort != order.Sort || from.Desc != order.Desc {
+			return nil, nil, merry.Here(errs.InvalidCursor)
+		}
+		switch from.Value.(type) {
+		case nil, bool, float64, string:
+		default:
+			return nil, nil, merry.Here(errs.InvalidCursor)
+		}
+	}
+
+	backward := from != nil && from.Before
+	op, dir := "gt", "ASC"
+	if order.Desc != backward {
+		op, dir = "lt", "DESC"
+	}
+
+	page := &filters.Filter{
+		Where:  append([]map[string]interface{}{}, f.Where...),
+		Sort:   []string{order.Sort + " " + dir, "_key " + dir},
+		Offset: f.Offset,
+		Limit:  limit + 1,
+	}
+
+	if from != nil {
+		page.Where = append(page.Where, map[string]interface{}{
+			"or": []interface{}{
+				map[string]interface{}{order.Sort: map[string]interface{}{op: from.Value}},
+				map[string]interface{}{"and": []interface{}{
+					map[string]interface{}{order.Sort: map[string]interface{}{"eq": from.Value}},
+					map[string]interface{}{"_key": map[string]interface{}{op: from.Key}},
+				}},
+			},
+		})
+		page.Offset = 0
+	}
+
+	if fields != nil {
+		fields = append(append([]string{}, fields...), order.Sort)
+	}
+
+	total, err := i.Store.Count(f)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	q := arangolite.NewQuery(`
-		FOR u IN users
-		%s
-		RETURN u
-	`, filter)
+	users, err := i.Store.Find(page, fields)
+	if err != nil {
+		// The filter alone is checked by the count, so the cursor value is the culprit.
+		if from != nil && merry.Is(err, errs.InvalidFilter) {
+			return nil, nil, merry.Here(errs.InvalidCursor).WithMessagef("the cursor value does not fit the sort field: %s", merry.Message(err))
+		}
+		return nil, nil, err
+	}
 
-	users := []models.User{}
+	more := len(users) > limit
+	if more {
+		users = users[:limit]
+	}
 
-	if err := i.Repo.Run(q, &users); err != nil {
-		return nil, err
+	if backward {
+		for l, r := 0, len(users)-1; l < r; l, r = l+1, r-1 {
+			users[l], users[r] = users[r], users[l]
+		}
 	}
 
-	return users, nil
+	links := &models.Page{Total: total}
+
+	if len(users) == 0 {
+		return users, links, nil
+	}
+
+	if backward || more {
+		links.Next = pageCursor(order, &users[len(users)-1], false)
+	}
+	if (backward && more) || (!backward && (from != nil || page.Offset > 0)) {
+		links.Prev = pageCursor(order, &users[0], true)
+	}
+
+	return users, links, nil
+}
+
+// Search returns a page of the users matching the given query, ranked by relevance.
+// As the ranking prevents keyset pagination, the page cursors are plain offsets.
+func (i *Users) Search(query string, offset, limit int) ([]models.User, *models.Page, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	limit = pageLimit(i.Constants, limit)
+
+	users, total, err := i.Searcher.Search(utils.SearchWords(query), offset, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page := &models.Page{Total: total}
+
+	if offset+limit < total {
+		page.Next = strconv.Itoa(offset + limit)
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		page.Prev = strconv.Itoa(prev)
+	}
+
+	return users, page, nil
 }
 
-func (i *Users) Signin(cred *models.Credentials, agent string) (*models.Session, error) {
+// scope returns a copy of the filter that excludes the soft deleted users, unless the
+// includeDeleted option is set. The option is consumed so that it never reaches the stores.
+func scope(f *filters.Filter) *filters.Filter {
+	scoped := &filters.Filter{}
+	if f != nil {
+		*scoped = *f
+	}
+
+	options := scoped.Options
+	includeDeleted := false
+	scoped.Options = nil
+
+	for _, option := range options {
+		if option == constants.OptionIncludeDeleted {
+			includeDeleted = true
+			continue
+		}
+		scoped.Options = append(scoped.Options, option)
+	}
+
+	if !includeDeleted {
+		scoped.Where = append(append([]map[string]interface{}{}, scoped.Where...), map[string]interface{}{"deletedAt": nil})
+	}
+
+	return scoped
+}
+
+// pageLimit bounds the requested page size by the configured maximum.
+func pageLimit(c *viper.Viper, limit int) int {
+	if limit <= 0 {
+		limit = c.GetInt(constants.PaginationDefaultLimit)
+	}
+	if max := c.GetInt(constants.PaginationMaxLimit); max > 0 && limit > max {
+		limit = max
+	}
+
+	return limit
+}
+
+func pageCursor(order *utils.Cursor, user *models.User, before bool) string {
+	doc := map[string]interface{}{}
+	m, _ := json.Marshal(user)
+	json.Unmarshal(m, &doc)
+
+	return utils.EncodeCursor(&utils.Cursor{
+		Sort:   order.Sort,
+		Desc:   order.Desc,
+		Value:  doc[order.Sort],
+		Key:    user.Key,
+		Before: before,
+	})
+}
+
+// Signin checks the given credentials and creates a new session. When the user has enabled
+// the two-factor authentication, no session is created and a challenge is returned instead.
+// Failed attempts are counted per account and per IP, lead to temporary lockouts and are audited.
+func (i *Users) Signin(cred *models.Credentials, agent, ip string) (*models.Session, *models.TwoFactorChallenge, error) {
+	if err := i.checkLockout(cred.Email, ip); err != nil {
+		if merry.Is(err, errs.AccountLocked) {
+			i.record(constants.AuditUserSigninLocked, i.accountKey(cred.Email), nil, nil)
+		}
+		return nil, nil, err
+	}
+
 	user, err := i.FindByCred(cred)
 	if err != nil {
-		return nil, err
+		if merry.Is(err, errs.NotFound) {
+			i.record(constants.AuditUserSigninFailed, i.accountKey(cred.Email), nil, nil)
+			if err := i.recordFailure(cred.Email, ip); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, err
 	}
 
+	if i.Constants.GetBool(constants.RequireVerifiedEmail) && !user.EmailVerified {
+		return nil, nil, merry.Here(errs.EmailNotVerified)
+	}
+
+	// The failures are only reset once the second factor is checked, so that each wrong
+	// code counts toward the lockout.
+	if user.TwoFactorEnabled {
+		challenge, err := i.issueChallenge(user)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return nil, challenge, nil
+	}
+
+	if err := i.Failures.Reset(accountFailuresKey(cred.Email)); err != nil {
+		return nil, nil, merry.Here(err)
+	}
+
+	session, err := i.createSession(user, agent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return session, nil, nil
+}
+
+func (i *Users) createSession(user *models.User, agent string) (*models.Session, error) {
 	user.Password = ""
+	user.TwoFactorSecret = ""
+	user.TwoFactorPendingSecret = ""
+	user.TwoFactorLastCounter = 0
+	user.RecoveryCodes = nil
 
 	payload := &models.AuthServerPayload{
 		User: user,
@@ -101,11 +400,13 @@ func (i *Users) Signin(cred *models.Credentials, agent string) (*models.Session,
 		Payload:    string(m),
 	}
 
-	session, err = i.SessionsInter.Create(session)
+	session, err := i.SessionsInter.Create(session)
 	if err != nil {
 		return nil, err
 	}
 
+	i.record(constants.AuditUserSignin, user.Key, nil, nil)
+
 	return session, nil
 }
 
@@ -115,27 +416,44 @@ func (i *Users) Signout(accessToken string) (*models.Session, error) {
 		return nil, err
 	}
 
+	i.record(constants.AuditUserSignout, sessionUserKey(session), nil, nil)
+
 	return session, nil
 }
 
-func (i *Users) FindByCred(cred *models.Credentials) (*models.User, error) {
-	q := arangolite.NewQuery(`
-		FOR u IN users
-        FILTER u.email == @email
-		RETURN u
-	`).Bind("email", cred.Email)
+// accountKey returns the key of the user with the given email, empty when there is none,
+// so that the failed sign ins of unknown accounts are still audited.
+func (i *Users) accountKey(email string) string {
+	user, err := i.Store.FindByEmail(email)
+	if err != nil {
+		return ""
+	}
 
-	users := []models.User{}
+	return user.Key
+}
 
-	if err := i.Repo.Run(q, &users); err != nil {
-		return nil, err
+// sessionUserKey returns the key of the user in the session payload, if any.
+func sessionUserKey(session *models.Session) string {
+	payload := &models.AuthServerPayload{}
+	if err := json.Unmarshal([]byte(session.Payload), payload); err != nil || payload.User == nil {
+		return ""
 	}
 
-	if len(users) == 0 {
-		return nil, merry.Here(errs.NotFound)
-	}
+	return payload.User.Key
+}
 
-	user := &users[0]
+func (i *Users) FindByCred(cred *models.Credentials) (*models.User, error) {
+	user, err := i.Store.FindByEmail(cred.Email)
+	if err == nil && user.DeletedAt != nil {
+		err = merry.Here(errs.NotFound)
+	}
+	if err != nil {
+		if merry.Is(err, errs.NotFound) {
+			// Keeps the response time similar to the one of a wrong password.
+			bcrypt.CompareHashAndPassword(dummyHash, []byte(cred.Password))
+		}
+		return nil, err
+	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(cred.Password)); err != nil {
 		return nil, merry.Here(errs.NotFound)
@@ -145,13 +463,15 @@ func (i *Users) FindByCred(cred *models.Credentials) (*models.User, error) {
 }
 
 func (i *Users) FindByKey(key string, f *filters.Filter) (*models.User, error) {
-	if f == nil {
-		f = &filters.Filter{}
-	}
+	return i.FindByKeyFields(key, f, nil)
+}
 
+// FindByKeyFields finds a user by key, only returning the given fields like find.
+func (i *Users) FindByKeyFields(key string, f *filters.Filter, fields []string) (*models.User, error) {
+	f = scope(f)
 	f.Where = append(f.Where, map[string]interface{}{"_key": key})
 
-	users, err := i.Find(f)
+	users, err := i.Store.Find(f, fields)
 	if err != nil {
 		return nil, err
 	}
@@ -173,102 +493,298 @@ func (i *Users) Create(users []models.User) ([]models.User, error) {
 		users[i].OwnerToken = utils.GenToken(32)
 	}
 
-	q := arangolite.NewQuery(`
-		FOR u IN @users
-		INSERT u IN users
-		RETURN NEW
-	`).Bind("users", users)
+	users, err := i.Store.Insert(users)
+	if err != nil {
+		return nil, err
+	}
 
-	users = []models.User{}
+	for _, user := range users {
+		i.record(constants.AuditUserCreate, user.Key, nil, &user)
+	}
+
+	return users, nil
+}
+
+// Delete soft deletes the users matched by filter on behalf of the given user, and revokes their
+// sessions. The deleted users are hidden but keep their email until they are purged.
+// A failed revocation is logged without failing the deletion.
+func (i *Users) Delete(f *filters.Filter, by string) ([]models.User, error) {
+	return i.delete(f, nil, by)
+}
 
-	if err := i.Repo.Run(q, &users); err != nil {
+// DeleteByKey soft deletes the user if its current revision is one of revs. A nil revs
+// skips the check. PreconditionFailed is returned when the user exists with another revision.
+func (i *Users) DeleteByKey(key string, revs []string, by string) (*models.User, error) {
+	f := &filters.Filter{}
+	f.Where = append(f.Where, map[string]interface{}{"_key": key})
+
+	users, err := i.delete(f, revs, by)
+	if err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	if len(users) == 0 {
+		return nil, i.missingOrStale(key, revs)
+	}
+
+	return &users[0], nil
 }
 
-func (i *Users) Delete(f *filters.Filter) ([]models.User, error) {
-	filter, err := utils.FilterToAQL("u", f)
+// delete soft deletes the users whose revision is one of revs, unless revs is nil,
+// and revokes their sessions.
+func (i *Users) delete(f *filters.Filter, revs []string, by string) ([]models.User, error) {
+	now := time.Now().UTC()
+
+	users, err := i.update(constants.AuditUserDelete, f, revs, &models.User{DeletedAt: &now, DeletedBy: by})
 	if err != nil {
 		return nil, err
 	}
 
-	q := arangolite.NewQuery(`
-		FOR u IN users
-		%s
-		REMOVE u IN users
-		RETURN OLD
-	`, filter)
+	// The deletion being committed, a revocation that could neither be processed nor queued
+	// is only logged. The sessions then expire with their TTL.
+	if err := i.Revocations.Revoke(users); err != nil {
+		keys := []string{}
+		for _, user := range users {
+			keys = append(keys, user.Key)
+		}
+
+		i.Logger.WithFields(logrus.Fields{
+			"error": err,
+			"users": keys,
+		}).Error("Could not revoke the sessions of the deleted users.")
+	}
 
-	users := []models.User{}
+	return users, nil
+}
 
-	if err := i.Repo.Run(q, &users); err != nil {
+// Restore restores a soft deleted user. NotFound is returned when no deleted user has the key.
+func (i *Users) Restore(key string) (*models.User, error) {
+	f := &filters.Filter{
+		Where: []map[string]interface{}{
+			{"_key": key},
+			{"deletedAt": map[string]interface{}{"neq": nil}},
+		},
+	}
+
+	users, err := i.Store.Find(f, nil)
+	if err != nil {
 		return nil, err
 	}
 
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
+	if len(users) == 0 {
+		return nil, merry.Here(errs.NotFound)
+	}
 
-	go i.SessionsInter.DeleteCascade(wg, users)
+	// The revision check ensures the user has not been restored concurrently.
+	user, err := i.patch(constants.AuditUserRestore, &users[0], key, []string{users[0].Rev}, map[string]interface{}{
+		"deletedAt": nil,
+		"deletedBy": nil,
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	wg.Wait()
+	return user, nil
+}
 
-	return users, nil
+func (i *Users) Update(user *models.User, f *filters.Filter) ([]models.User, error) {
+	return i.update(constants.AuditUserUpdate, f, nil, user)
 }
 
-func (i *Users) DeleteByKey(key string) (*models.User, error) {
+// UpdateByKey updates the user if its current revision is one of revs. A nil revs
+// skips the check. PreconditionFailed is returned when the user exists with another revision.
+func (i *Users) UpdateByKey(key string, revs []string, user *models.User) (*models.User, error) {
 	f := &filters.Filter{}
 	f.Where = append(f.Where, map[string]interface{}{"_key": key})
 
-	users, err := i.Delete(f)
+	users, err := i.update(constants.AuditUserUpdate, f, revs, user)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(users) == 0 {
-		return nil, merry.Here(errs.NotFound)
+		return nil, i.missingOrStale(key, revs)
 	}
 
 	return &users[0], nil
 }
 
-func (i *Users) Update(user *models.User, f *filters.Filter) ([]models.User, error) {
-	filter, err := utils.FilterToAQL("u", f)
+// update updates the users that are not deleted with the store and records their changes
+// under the given action.
+func (i *Users) update(action models.AuditAction, f *filters.Filter, revs []string, user *models.User) ([]models.User, error) {
+	f = scope(f)
+
+	matched, err := i.Store.Find(f, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	q := arangolite.NewQuery(`
-		FOR u IN users
-		%s
-		UPDATE u with @user IN users
-		RETURN NEW
-	`, filter).Bind("user", user)
-
-	users := []models.User{}
+	before := map[string]*models.User{}
+	for j := range matched {
+		before[matched[j].Key] = &matched[j]
+	}
 
-	if err := i.Repo.Run(q, &users); err != nil {
+	users, err := i.Store.Update(f, revs, user)
+	if err != nil {
 		return nil, err
 	}
 
+	for _, updated := range users {
+		i.record(action, updated.Key, before[updated.Key], &updated)
+
+		if err := i.emailChanged(before[updated.Key], &updated); err != nil {
+			return nil, err
+		}
+
+		i.rotationRequired(before[updated.Key], &updated)
+	}
+
 	return users, nil
 }
 
-func (i *Users) UpdateByKey(key string, user *models.User) (*models.User, error) {
-	f := &filters.Filter{}
-	f.Where = append(f.Where, map[string]interface{}{"_key": key})
+// ReplaceByKey replaces the user with the given one, like UpdateByKey does for the revision check.
+// The password, the owner token, the two-factor and deletion fields and, unless given, the must change password
+// flag, the role and the email verification are preserved.
+func (i *Users) ReplaceByKey(key string, revs []string, user *models.User) (*models.User, error) {
+	before, err := i.snapshot(key)
+	if err != nil {
+		return nil, err
+	}
 
-	users, err := i.Update(user, f)
+	if before == nil {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	user, err = i.Store.Replace(key, revs, user)
 	if err != nil {
+		if merry.Is(err, errs.NotFound) {
+			return nil, i.missingOrStale(key, revs)
+		}
 		return nil, err
 	}
 
-	if len(users) == 0 {
+	i.record(constants.AuditUserReplace, key, before, user)
+
+	if err := i.emailChanged(before, user); err != nil {
+		return nil, err
+	}
+
+	i.rotationRequired(before, user)
+
+	return user, nil
+}
+
+// PatchByKey applies a RFC 7396 merge patch to the user: objects are merged recursively
+// and null values remove the matching fields.
+func (i *Users) PatchByKey(key string, revs []string, patch map[string]interface{}) (*models.User, error) {
+	return i.patchByKey(constants.AuditUserPatch, key, revs, patch)
+}
+
+func (i *Users) patchByKey(action models.AuditAction, key string, revs []string, patch map[string]interface{}) (*models.User, error) {
+	before, err := i.snapshot(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if before == nil {
 		return nil, merry.Here(errs.NotFound)
 	}
 
-	return &users[0], nil
+	user, err := i.patch(action, before, key, revs, patch)
+	if err != nil {
+		if merry.Is(err, errs.NotFound) {
+			return nil, i.missingOrStale(key, revs)
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// patch patches the user with the store and records the change under the given action.
+// Before is the state of the user the change is computed from.
+func (i *Users) patch(action models.AuditAction, before *models.User, key string, revs []string, patch map[string]interface{}) (*models.User, error) {
+	user, err := i.Store.Patch(key, revs, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	i.record(action, key, before, user)
+
+	if err := i.emailChanged(before, user); err != nil {
+		return nil, err
+	}
+
+	i.rotationRequired(before, user)
+
+	return user, nil
+}
+
+// emailChanged invalidates the verification tokens sent to the previous email of the user.
+func (i *Users) emailChanged(before, after *models.User) error {
+	if before == nil || before.Email == after.Email {
+		return nil
+	}
+
+	return i.Tokens.Delete("verificationTokens", after.Key)
+}
+
+// rotationRequired revokes the sessions of a user newly required to change its password, the flag
+// being carried by the session payloads. A revocation that could neither be processed nor queued
+// is only logged, the flag then applying once the sessions expire.
+func (i *Users) rotationRequired(before, after *models.User) {
+	if before == nil || before.MustChangePassword || !after.MustChangePassword {
+		return
+	}
+
+	if err := i.Revocations.Revoke([]models.User{*after}); err != nil {
+		i.Logger.WithFields(logrus.Fields{
+			"error": err,
+			"user":  after.Key,
+		}).Error("Could not revoke the sessions of the user required to change its password.")
+	}
+}
+
+// snapshot returns the current state of the user, or nil when it does not exist or is deleted,
+// so that the changes of the following update can be recorded.
+func (i *Users) snapshot(key string) (*models.User, error) {
+	user, err := i.FindByKey(key, nil)
+	if err != nil {
+		if merry.Is(err, errs.NotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// record appends the audit entry of an action already committed. A failed record is logged
+// without failing the action.
+func (i *Users) record(action models.AuditAction, target string, before, after *models.User) {
+	if err := i.Audit.Record(action, target, before, after); err != nil {
+		i.Logger.WithFields(logrus.Fields{
+			"error":  err,
+			"action": action,
+			"target": target,
+		}).Error("Could not record the audit entry.")
+	}
+}
+
+// missingOrStale explains why a by key update matched no user.
+func (i *Users) missingOrStale(key string, revs []string) error {
+	if revs == nil {
+		return merry.Here(errs.NotFound)
+	}
+
+	if _, err := i.FindByKey(key, nil); err != nil {
+		if merry.Is(err, errs.NotFound) {
+			return merry.Here(errs.NotFound)
+		}
+		return err
+	}
+
+	return merry.Here(errs.PreconditionFailed)
 }
 
 func (i *Users) UpdatePassword(key, password string) (*models.User, error) {
@@ -277,14 +793,193 @@ func (i *Users) UpdatePassword(key, password string) (*models.User, error) {
 		return nil, merry.Here(err)
 	}
 
-	user := &models.User{
-		Password: string(enc),
+	// A rotated password lifts the must change password flag.
+	patch := map[string]interface{}{
+		"password":           string(enc),
+		"mustChangePassword": nil,
+	}
+
+	user, err := i.patchByKey(constants.AuditUserPassword, key, nil, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ForgotPassword issues a new reset token for the user owning the given email and sends it
+// through the notifier. Previously issued tokens are invalidated. No error is returned when
+// the email is unknown so the endpoint cannot be used to enumerate accounts.
+func (i *Users) ForgotPassword(email string) error {
+	user, err := i.Store.FindByEmail(email)
+	if err == nil && user.DeletedAt != nil {
+		err = merry.Here(errs.NotFound)
+	}
+	if err != nil {
+		if merry.Is(err, errs.NotFound) {
+			i.Logger.WithField("email", email).Debug("Password reset requested for an unknown email.")
+			return nil
+		}
+		return err
+	}
+
+	token, err := i.issueToken("resetTokens", user, i.Constants.GetDuration(constants.ResetTokenTTL))
+	if err != nil {
+		return err
+	}
+
+	if err := i.Notifier.SendResetToken(user, token); err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
+
+// ResetTokenOwner returns the owner of the given reset token without consuming it, for the new
+// password to be checked against its email. InvalidToken is returned when the token is not valid.
+func (i *Users) ResetTokenOwner(token string) (*models.User, error) {
+	t, err := i.Tokens.Find("resetTokens", utils.HashToken(token))
+	if err != nil {
+		if merry.Is(err, errs.NotFound) {
+			return nil, merry.Here(errs.InvalidToken)
+		}
+		return nil, err
+	}
+
+	user, err := i.snapshot(t.UserKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, merry.Here(errs.InvalidToken)
 	}
 
-	user, err = i.UpdateByKey(key, user)
+	return user, nil
+}
+
+// ResetPassword consumes the given reset token and sets the new password of its owner.
+// All the sessions of the user are then revoked.
+func (i *Users) ResetPassword(token, password string) (*models.User, error) {
+	t, err := i.consumeToken("resetTokens", token)
 	if err != nil {
 		return nil, err
 	}
 
+	user, err := i.UpdatePassword(t.UserKey, password)
+	if err != nil {
+		if merry.Is(err, errs.NotFound) {
+			return nil, merry.Here(errs.InvalidToken)
+		}
+		return nil, err
+	}
+
+	// The password being changed, a revocation that could neither be processed nor queued
+	// is only logged. The sessions then expire with their TTL.
+	if err := i.Revocations.Revoke([]models.User{*user}); err != nil {
+		i.Logger.WithFields(logrus.Fields{
+			"error": err,
+			"user":  user.Key,
+		}).Error("Could not revoke the sessions after the password reset.")
+	}
+
 	return user, nil
 }
+
+// Verify consumes the given verification token and marks the email of its owner as verified.
+// The token is rejected if the email has changed since it was issued.
+func (i *Users) Verify(token string) (*models.User, error) {
+	t, err := i.consumeToken("verificationTokens", token)
+	if err != nil {
+		return nil, err
+	}
+
+	patch := map[string]interface{}{
+		"emailVerified":   true,
+		"emailVerifiedAt": time.Now().UTC(),
+	}
+
+	before, err := i.snapshot(t.UserKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if before == nil || before.Email != t.Email {
+		return nil, merry.Here(errs.InvalidToken)
+	}
+
+	user, err := i.patch(constants.AuditUserVerify, before, t.UserKey, nil, patch)
+	if err != nil {
+		if merry.Is(err, errs.NotFound) {
+			return nil, merry.Here(errs.InvalidToken)
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ResendVerification issues a new verification token for the given user and sends it
+// through the notifier. Previously issued tokens are invalidated.
+func (i *Users) ResendVerification(key string) (*models.User, error) {
+	user, err := i.FindByKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.EmailVerified {
+		return nil, merry.Here(errs.EmailAlreadyVerified)
+	}
+
+	if err := i.sendVerification(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (i *Users) sendVerification(user *models.User) error {
+	token, err := i.issueToken("verificationTokens", user, i.Constants.GetDuration(constants.VerificationTokenTTL))
+	if err != nil {
+		return err
+	}
+
+	if err := i.Notifier.SendVerificationToken(user, token); err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
+
+// issueToken replaces all the tokens of the user in the given collection by a new one
+// and returns it in clear. Only its hash is stored.
+func (i *Users) issueToken(collection string, user *models.User, ttl time.Duration) (string, error) {
+	token := utils.GenToken(32)
+	expiresAt := time.Now().UTC().Add(ttl)
+
+	t := &models.Token{
+		Hash:      utils.HashToken(token),
+		UserKey:   user.Key,
+		Email:     user.Email,
+		ExpiresAt: &expiresAt,
+	}
+
+	if err := i.Tokens.Replace(collection, t); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeToken atomically marks the given token as used if it is still valid.
+func (i *Users) consumeToken(collection, token string) (*models.Token, error) {
+	t, err := i.Tokens.Consume(collection, utils.HashToken(token))
+	if err != nil {
+		if merry.Is(err, errs.NotFound) {
+			return nil, merry.Here(errs.InvalidToken)
+		}
+		return nil, err
+	}
+
+	return t, nil
+}
@@ -0,0 +1,120 @@
+package interactors
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/solher/arangolite/filters"
+	"github.com/solher/snakepit"
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/models"
+)
+
+// purgedTokens lists the token collections cleared along with the purged users.
+var purgedTokens = []string{"resetTokens", "verificationTokens", "twoFactorChallenges"}
+
+type (
+	// UsersPurge hard deletes the users soft deleted for longer than the retention window,
+	// along with their tokens and sessions.
+	UsersPurge struct {
+		snakepit.Interactor
+		Store       UsersStore
+		Tokens      TokensStore
+		Revocations SessionsRevoker
+		Audit       UsersAuditor
+	}
+)
+
+func NewUsersPurge(
+	c *viper.Viper,
+	l *logrus.Entry,
+	s UsersStore,
+	t TokensStore,
+	sr SessionsRevoker,
+	a UsersAuditor,
+) *UsersPurge {
+	return &UsersPurge{
+		Interactor:  *snakepit.NewInteractor(c, l),
+		Store:       s,
+		Tokens:      t,
+		Revocations: sr,
+		Audit:       a,
+	}
+}
+
+// Purge removes the users deleted before the retention window and returns them.
+// With dryRun, the users are only returned.
+func (i *UsersPurge) Purge(dryRun bool) ([]models.User, error) {
+	cutoff := time.Now().UTC().Add(-i.Constants.GetDuration(constants.UsersPurgeRetention))
+
+	// The deletion times are compared once parsed: their JSON representation omits the
+	// trailing zeros of the fractional seconds, so it does not sort chronologically.
+	deleted, err := i.Store.Find(&filters.Filter{
+		Where: []map[string]interface{}{
+			{"deletedAt": map[string]interface{}{"neq": nil}},
+		},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := []models.User{}
+	keys := []string{}
+
+	for _, user := range deleted {
+		if user.DeletedAt != nil && user.DeletedAt.Before(cutoff) {
+			expired = append(expired, user)
+			keys = append(keys, user.Key)
+		}
+	}
+
+	if dryRun || len(keys) == 0 {
+		return expired, nil
+	}
+
+	// The deletion is checked again, in case a user has been restored in the meantime.
+	users, err := i.Store.Delete(&filters.Filter{
+		Where: []map[string]interface{}{
+			{"_key": map[string]interface{}{"in": keys}},
+			{"deletedAt": map[string]interface{}{"neq": nil}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The users being purged, the failures to clear their tokens and sessions are only logged.
+	for _, user := range users {
+		for _, collection := range purgedTokens {
+			if err := i.Tokens.Delete(collection, user.Key); err != nil {
+				i.Logger.WithFields(logrus.Fields{
+					"error":      err,
+					"target":     user.Key,
+					"collection": collection,
+				}).Error("Could not delete the tokens of the purged user.")
+			}
+		}
+	}
+
+	if err := i.Revocations.Revoke(users); err != nil {
+		i.Logger.WithField("error", err).Error("Could not revoke the sessions of the purged users.")
+	}
+
+	for _, user := range users {
+		// The users being purged, a failed record is only logged.
+		if err := i.Audit.Record(constants.AuditUserPurge, user.Key, &user, nil); err != nil {
+			i.Logger.WithFields(logrus.Fields{
+				"error":  err,
+				"target": user.Key,
+			}).Error("Could not record the audit entry.")
+		}
+	}
+
+	if len(users) > 0 {
+		i.Logger.WithField("count", len(users)).Info("Purged the deleted users.")
+	}
+
+	return users, nil
+}
@@ -0,0 +1,99 @@
+package interactors
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/stores"
+)
+
+// fakeRevoker records the users whose sessions are revoked.
+type fakeRevoker struct {
+	revoked []models.User
+}
+
+func (r *fakeRevoker) Revoke(users []models.User) error {
+	r.revoked = append(r.revoked, users...)
+	return nil
+}
+
+type fakeAuditor struct{}
+
+func (a fakeAuditor) Record(action models.AuditAction, target string, before, after *models.User) error {
+	return nil
+}
+
+func TestPurge(t *testing.T) {
+	v := viper.New()
+	v.Set(constants.UsersPurgeRetention, time.Hour)
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+
+	mem := stores.NewMemory(time.Hour)
+	revoker := &fakeRevoker{}
+	i := NewUsersPurge(v, logrus.NewEntry(l), mem.Users, mem.Tokens, revoker, fakeAuditor{})
+
+	// The deletion time of the expired user has no fractional seconds, while the cutoff
+	// computed a moment later has some: their JSON representations do not sort chronologically.
+	expired := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	recent := time.Now().UTC()
+
+	users, err := mem.Users.Insert([]models.User{
+		{Document: models.Document{Key: "expired"}, Email: "expired@localhost", DeletedAt: &expired},
+		{Document: models.Document{Key: "recent"}, Email: "recent@localhost", DeletedAt: &recent},
+		{Document: models.Document{Key: "active"}, Email: "active@localhost"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	for _, user := range users {
+		for _, collection := range purgedTokens {
+			token := &models.Token{Hash: collection + user.Key, UserKey: user.Key, ExpiresAt: &expiresAt}
+			if err := mem.Tokens.Replace(collection, token); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	listed, err := i.Purge(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Key != "expired" || len(revoker.revoked) != 0 {
+		t.Fatalf("Expected the dry run to only list the expired user, got %+v.", listed)
+	}
+
+	purged, err := i.Purge(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 1 || purged[0].Key != "expired" {
+		t.Fatalf("Expected the expired user to be purged, got %+v.", purged)
+	}
+
+	if remaining, _ := mem.Users.Count(nil); remaining != 2 {
+		t.Errorf("Expected the other users to be kept, %d remaining.", remaining)
+	}
+
+	if len(revoker.revoked) != 1 || revoker.revoked[0].Key != "expired" {
+		t.Errorf("Expected the sessions of the purged user to be revoked, revoked %+v.", revoker.revoked)
+	}
+
+	for _, user := range users {
+		for _, collection := range purgedTokens {
+			_, err := mem.Tokens.Find(collection, collection+user.Key)
+			if found := err == nil; found == (user.Key == "expired") {
+				t.Errorf("Expected the %s token of %s to be deleted only for the purged user.", collection, user.Key)
+			}
+		}
+	}
+}
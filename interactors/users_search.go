@@ -0,0 +1,89 @@
+package interactors
+
+import (
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/solher/arangolite"
+	"github.com/solher/snakepit"
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+type (
+	// UsersSearch searches the users through the fulltext indexes
+	// on their first name, last name and email.
+	UsersSearch struct {
+		snakepit.Interactor
+		Repo QueryRunner
+	}
+)
+
+func NewUsersSearch(
+	c *viper.Viper,
+	l *logrus.Entry,
+	r QueryRunner,
+) *UsersSearch {
+	return &UsersSearch{
+		Interactor: *snakepit.NewInteractor(c, l),
+		Repo:       r,
+	}
+}
+
+// Search returns the users with a first name, last name or email word starting with one of the
+// given words, the soft deleted ones excepted. The users are ranked by the number and the quality of their matches: for each word,
+// a whole field equal to the word scores 3, a field starting with it 2 and a field containing it 1.
+func (i *UsersSearch) Search(words []string, offset, limit int) ([]models.User, int, error) {
+	if len(words) == 0 {
+		return []models.User{}, 0, nil
+	}
+
+	query := "prefix:" + strings.Join(words, ",|prefix:")
+
+	q := arangolite.NewQuery(`
+		LET matches = (
+			FOR u IN UNION_DISTINCT(
+				FULLTEXT(users, "firstName", @query),
+				FULLTEXT(users, "lastName", @query),
+				FULLTEXT(users, "email", @query)
+			)
+			FILTER u.deletedAt == null
+			RETURN u
+		)
+		LET page = (
+			FOR u IN matches
+			LET fields = [LOWER(u.firstName), LOWER(u.lastName), LOWER(u.email)]
+			LET score = SUM(
+				FOR w IN @words
+				RETURN MAX(
+					FOR f IN fields
+					RETURN f == w ? 3 : (LIKE(f, CONCAT(w, "%%")) ? 2 : (CONTAINS(f, w) ? 1 : 0))
+				)
+			)
+			SORT score DESC, u.lastName, u.firstName, u._key
+			LIMIT @offset, @limit
+			RETURN u
+		)
+		RETURN { total: LENGTH(matches), users: page }
+	`).
+		Bind("query", query).
+		Bind("words", words).
+		Bind("offset", offset).
+		Bind("limit", limit)
+
+	results := []struct {
+		Total int           `json:"total"`
+		Users []models.User `json:"users"`
+	}{}
+
+	if err := i.Repo.Run(q, &results); err != nil {
+		return nil, 0, err
+	}
+
+	if len(results) == 0 {
+		return []models.User{}, 0, nil
+	}
+
+	return results[0].Users, results[0].Total, nil
+}
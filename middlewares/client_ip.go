@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/ansel1/merry"
+	"github.com/pressly/chi"
+	"github.com/solher/snakepit"
+	"golang.org/x/net/context"
+
+	"github.com/solher/snakepit-seed/utils"
+)
+
+const contextClientIP snakepit.CtxKey = "clientIP"
+
+func GetClientIP(ctx context.Context) (string, error) {
+	if ctx == nil {
+		return "", merry.New("nil context")
+	}
+
+	ip, ok := ctx.Value(contextClientIP).(string)
+	if !ok {
+		return "", merry.New("unexpected type")
+	}
+
+	if len(ip) == 0 {
+		return "", merry.New("empty value in context")
+	}
+
+	return ip, nil
+}
+
+// NewClientIP returns a middleware resolving the IP of the client, the forwarding headers
+// being only trusted when set by one of the given proxies.
+func NewClientIP(trusted []*net.IPNet) func(next chi.Handler) chi.Handler {
+	return func(next chi.Handler) chi.Handler {
+		return chi.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ctx = context.WithValue(ctx, contextClientIP, utils.ClientIP(r, trusted))
+			next.ServeHTTPC(ctx, w, r)
+		})
+	}
+}
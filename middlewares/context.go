@@ -4,9 +4,13 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/net/context"
 
+	"github.com/solher/snakepit-seed/errs"
 	"github.com/solher/snakepit-seed/models"
 
 	"github.com/Sirupsen/logrus"
@@ -72,19 +76,54 @@ func GetCurrentSession(ctx context.Context) (*models.Session, error) {
 	return session, nil
 }
 
-type Context struct{}
+type (
+	SessionFinder interface {
+		FindByToken(token string) (*models.Session, error)
+	}
 
-func NewContext() func(next chi.Handler) chi.Handler {
-	context := &Context{}
+	Context struct {
+		json          *snakepit.JSON
+		verifier      SignatureVerifier
+		allowUnsigned bool
+		maxAge        time.Duration
+		sessions      func(l *logrus.Entry) SessionFinder
+		jwt           *JWTOptions
+	}
+)
+
+// NewContext returns a context middleware trusting the auth server headers once their
+// "Auth-Server-Signature" is verified and their signed "Auth-Server-Timestamp" is at most
+// maxAge away from now. Unsigned headers are only accepted if allowUnsigned is set, which
+// must be restricted to development.
+func NewContext(j *snakepit.JSON, v SignatureVerifier, allowUnsigned bool, maxAge time.Duration) func(next chi.Handler) chi.Handler {
+	context := &Context{
+		json:          j,
+		verifier:      v,
+		allowUnsigned: allowUnsigned,
+		maxAge:        maxAge,
+	}
 	return context.middleware
 }
 
+// NewLocalContext returns a context middleware resolving the "Authorization: Bearer" tokens
+// against the local sessions store instead of trusting the auth server headers.
+func NewLocalContext(sessions func(l *logrus.Entry) SessionFinder) func(next chi.Handler) chi.Handler {
+	context := &Context{sessions: sessions}
+	return context.localMiddleware
+}
+
 func (c *Context) middleware(next chi.Handler) chi.Handler {
 	return chi.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		log, _ := snakepit.GetLogger(ctx)
 
+		if err := c.verifySignature(r); err != nil {
+			c.json.RenderError(ctx, w, http.StatusUnauthorized, errs.APIInvalidSignature, err)
+			return
+		}
+
 		payload := getAuthServerPayload(r, log)
-		token := getAccessToken(r, log)
+		// The query parameter cannot be signed, so it is only read by the unsigned setups.
+		token := getAccessToken(r, c.verifier == nil, log)
 		session := getCurrentSession(r, log)
 		if session != nil {
 			session.Role = payload.Role
@@ -98,6 +137,127 @@ func (c *Context) middleware(next chi.Handler) chi.Handler {
 	})
 }
 
+// verifySignature checks the signature of the auth server headers. Requests without any of them are anonymous
+// and do not need to be signed.
+func (c *Context) verifySignature(r *http.Request) error {
+	payload := r.Header.Get("Auth-Server-Payload")
+	session := r.Header.Get("Auth-Server-Session")
+	token := r.Header.Get("Auth-Server-Token")
+
+	if payload == "" && session == "" && token == "" {
+		return nil
+	}
+
+	enc := r.Header.Get("Auth-Server-Signature")
+	if enc == "" {
+		if c.allowUnsigned {
+			return nil
+		}
+		return merry.New("missing auth server signature")
+	}
+
+	if c.verifier == nil {
+		return merry.New("no auth server signature verifier configured")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return merry.New("could not base64 decode the auth server signature")
+	}
+
+	timestamp := r.Header.Get("Auth-Server-Timestamp")
+
+	if !c.verifier.Verify(signedMessage(payload, session, token, timestamp), signature) {
+		return merry.New("invalid auth server signature")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return merry.New("invalid auth server timestamp")
+	}
+
+	// The clocks of the servers may drift, so the timestamp can be slightly in the future.
+	if age := time.Since(time.Unix(seconds, 0)); age > c.maxAge || age < -c.maxAge {
+		return merry.New("expired auth server signature")
+	}
+
+	return nil
+}
+
+func (c *Context) localMiddleware(next chi.Handler) chi.Handler {
+	return chi.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		log, _ := snakepit.GetLogger(ctx)
+
+		var (
+			user    *models.User
+			session *models.Session
+		)
+
+		token := getBearerToken(r, log)
+		if len(token) != 0 {
+			session = getLocalSession(c.sessions(log), token, log)
+		}
+
+		if session != nil {
+			payload := getSessionPayload(session, log)
+			session.Role = payload.Role
+			user = payload.User
+		}
+
+		ctx = context.WithValue(ctx, contextCurrentUser, user)
+		ctx = context.WithValue(ctx, contextAccessToken, token)
+		ctx = context.WithValue(ctx, contextCurrentSession, session)
+
+		next.ServeHTTPC(ctx, w, r)
+	})
+}
+
+func getBearerToken(r *http.Request, log *logrus.Entry) string {
+	token := ""
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+
+	if t := r.URL.Query().Get("accessToken"); t != "" {
+		token = t
+	}
+
+	// The token itself is never logged.
+	if len(token) == 0 {
+		log.Debug("No bearer token received.")
+	} else {
+		log.Debug("Bearer token received.")
+	}
+
+	return token
+}
+
+func getLocalSession(sessions SessionFinder, token string, log *logrus.Entry) *models.Session {
+	session, err := sessions.FindByToken(token)
+	if err != nil {
+		log.WithField("error", err).
+			Debug("Could not find a valid local session.")
+		return nil
+	}
+
+	log.WithField("role", session.Role).
+		Debug("Local session found.")
+
+	return session
+}
+
+func getSessionPayload(session *models.Session, log *logrus.Entry) *models.AuthServerPayload {
+	payload := &models.AuthServerPayload{}
+
+	if err := json.Unmarshal([]byte(session.Payload), payload); err != nil {
+		log.WithField("sessionPayload", session.Payload).
+			Debug("Could not unmarshal the local session payload.")
+	}
+
+	return payload
+}
+
 func getAuthServerPayload(r *http.Request, log *logrus.Entry) *models.AuthServerPayload {
 	payload := &models.AuthServerPayload{}
 
@@ -127,35 +287,34 @@ func getAuthServerPayload(r *http.Request, log *logrus.Entry) *models.AuthServer
 	return payload
 }
 
-func getAccessToken(r *http.Request, log *logrus.Entry) string {
+func getAccessToken(r *http.Request, fromQuery bool, log *logrus.Entry) string {
 	token := r.Header.Get("Auth-Server-Token")
 
-	if t := r.URL.Query().Get("accessToken"); t != "" {
+	if t := r.URL.Query().Get("accessToken"); t != "" && fromQuery {
 		token = t
 	}
 
+	// The token itself is never logged.
 	if len(token) == 0 {
-		log.WithField("accessToken", "").
-			Debug("No access token received.")
+		log.Debug("No access token received.")
 	} else {
-		log.WithField("accessToken", token).
-			Debug("Access token received.")
+		log.Debug("Access token received.")
 	}
 
 	return token
 }
 
 func getCurrentSession(r *http.Request, log *logrus.Entry) *models.Session {
+	// The session holds the access token, so only its role is logged.
 	enc := r.Header.Get("Auth-Server-Session")
 	if enc == "" {
-		log.WithField("currentSession", enc).
-			Debug("No current session received.")
+		log.Debug("No current session received.")
 		return nil
 	}
 
 	data, err := base64.StdEncoding.DecodeString(enc)
 	if err != nil {
-		log.WithField("currentSession", enc).
+		log.WithField("error", err).
 			Debug("Could not base64 decode the received current session.")
 		return nil
 	}
@@ -163,12 +322,12 @@ func getCurrentSession(r *http.Request, log *logrus.Entry) *models.Session {
 	session := &models.Session{}
 
 	if err := json.Unmarshal(data, session); err != nil {
-		log.WithField("currentSession", string(data)).
+		log.WithField("error", err).
 			Debug("Could not unmarshal the received current session.")
 		return nil
 	}
 
-	log.WithField("currentSession", string(data)).
+	log.WithField("role", session.Role).
 		Debug("Current session received.")
 
 	return session
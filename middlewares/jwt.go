@@ -0,0 +1,230 @@
+package middlewares
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/pressly/chi"
+	"github.com/solher/snakepit"
+	"golang.org/x/net/context"
+
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+type (
+	// JWKS holds the verification keys loaded from a local JWKS file or from a JWKS URL.
+	// Keys loaded from an URL are refreshed in the background of the requests once outdated,
+	// a single refresh running at a time.
+	JWKS struct {
+		mutex      sync.RWMutex
+		file       string
+		url        string
+		refresh    time.Duration
+		keys       []utils.JWTKey
+		loaded     time.Time
+		refreshing bool
+	}
+
+	// JWTClaimNames are the names of the claims mapped onto the context models.
+	// Nested claims can be reached using dot separated paths.
+	JWTClaimNames struct {
+		Key        string
+		Email      string
+		FirstName  string
+		LastName   string
+		Role       string
+		OwnerToken string
+	}
+
+	JWTOptions struct {
+		Keys     *JWKS
+		Issuer   string
+		Audience string
+		Leeway   time.Duration
+		Claims   JWTClaimNames
+	}
+)
+
+func NewJWKS(file, url string, refresh time.Duration) (*JWKS, error) {
+	jwks := &JWKS{file: file, url: url, refresh: refresh}
+
+	if err := jwks.load(); err != nil {
+		return nil, err
+	}
+
+	return jwks, nil
+}
+
+// Keys returns the current keys, starting a background refresh when they are outdated.
+// The previous keys are served until the refresh succeeds.
+func (j *JWKS) Keys() []utils.JWTKey {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.url != "" && j.refresh > 0 && time.Since(j.loaded) > j.refresh && !j.refreshing {
+		j.refreshing = true
+		go j.backgroundLoad()
+	}
+
+	return j.keys
+}
+
+// backgroundLoad reloads the keys, a failed refresh being retried by the next request.
+func (j *JWKS) backgroundLoad() {
+	j.load()
+
+	j.mutex.Lock()
+	j.refreshing = false
+	j.mutex.Unlock()
+}
+
+func (j *JWKS) load() error {
+	var (
+		data []byte
+		err  error
+	)
+
+	switch {
+	case j.file != "":
+		data, err = ioutil.ReadFile(j.file)
+	case j.url != "":
+		data, err = fetchJWKS(j.url)
+	default:
+		return merry.New("no JWKS file or URL configured")
+	}
+	if err != nil {
+		return merry.Here(err)
+	}
+
+	keys, err := utils.ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	j.mutex.Lock()
+	j.keys = keys
+	j.loaded = time.Now()
+	j.mutex.Unlock()
+
+	return nil
+}
+
+func fetchJWKS(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, merry.Here(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, merry.Errorf("unexpected JWKS response status: %d", res.StatusCode)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+// NewJWTContext returns a context middleware validating "Authorization: Bearer" JWTs issued by
+// an external identity provider and mapping their claims onto the current user and session.
+func NewJWTContext(j *snakepit.JSON, o *JWTOptions) func(next chi.Handler) chi.Handler {
+	context := &Context{json: j, jwt: o}
+	return context.jwtMiddleware
+}
+
+func (c *Context) jwtMiddleware(next chi.Handler) chi.Handler {
+	return chi.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		log, _ := snakepit.GetLogger(ctx)
+
+		var (
+			user    *models.User
+			session *models.Session
+		)
+
+		token := getBearerToken(r, log)
+		if len(token) != 0 {
+			claims, err := c.verifyJWT(token)
+			if err != nil {
+				log.WithField("error", err).Debug("Invalid JWT received.")
+				c.json.RenderError(ctx, w, http.StatusUnauthorized, errs.APIUnauthorized, err)
+				return
+			}
+
+			user, session = c.jwtModels(claims, token, r.UserAgent())
+
+			log.WithField("currentUser", user.Key).
+				WithField("role", session.Role).
+				Debug("JWT claims mapped.")
+		}
+
+		ctx = context.WithValue(ctx, contextCurrentUser, user)
+		ctx = context.WithValue(ctx, contextAccessToken, token)
+		ctx = context.WithValue(ctx, contextCurrentSession, session)
+
+		next.ServeHTTPC(ctx, w, r)
+	})
+}
+
+func (c *Context) verifyJWT(token string) (utils.JWTClaims, error) {
+	claims, err := utils.VerifyJWT(token, c.jwt.Keys.Keys())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := claims.Validate(c.jwt.Issuer, c.jwt.Audience, time.Now(), c.jwt.Leeway); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (c *Context) jwtModels(claims utils.JWTClaims, token, agent string) (*models.User, *models.Session) {
+	names := c.jwt.Claims
+	role := jwtRole(claims.Strings(names.Role))
+
+	user := &models.User{
+		Document:   models.NewDocument("", "", claims.String(names.Key)),
+		Email:      claims.String(names.Email),
+		FirstName:  claims.String(names.FirstName),
+		LastName:   claims.String(names.LastName),
+		OwnerToken: claims.String(names.OwnerToken),
+		Role:       role,
+	}
+
+	session := &models.Session{
+		Token:      token,
+		OwnerToken: user.OwnerToken,
+		Agent:      agent,
+		Role:       role,
+	}
+
+	if iat, ok := claims.Time("iat"); ok {
+		session.Created = &iat
+	}
+
+	if exp, ok := claims.Time("exp"); ok {
+		session.ValidTo = &exp
+	}
+
+	return user, session
+}
+
+// jwtRole returns the first known role among the claimed ones, case insensitively.
+func jwtRole(claimed []string) models.Role {
+	for _, name := range claimed {
+		for _, role := range constants.Roles {
+			if strings.EqualFold(name, string(role)) {
+				return role
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,84 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/ansel1/merry"
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	SignatureHMAC    = "hmac"
+	SignatureEd25519 = "ed25519"
+)
+
+type SignatureVerifier interface {
+	Verify(message, signature []byte) bool
+}
+
+// HMACVerifier checks HMAC-SHA256 signatures computed with a secret shared with the auth server.
+type HMACVerifier struct {
+	secret []byte
+}
+
+func NewHMACVerifier(secret string) *HMACVerifier {
+	return &HMACVerifier{secret: []byte(secret)}
+}
+
+func (v *HMACVerifier) Verify(message, signature []byte) bool {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write(message)
+
+	return hmac.Equal(mac.Sum(nil), signature)
+}
+
+// Ed25519Verifier checks Ed25519 signatures against the public key of the auth server.
+type Ed25519Verifier struct {
+	publicKey ed25519.PublicKey
+}
+
+// NewEd25519Verifier expects a base64 encoded public key.
+func NewEd25519Verifier(publicKey string) (*Ed25519Verifier, error) {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, merry.Here(err)
+	}
+
+	if len(key) != ed25519.PublicKeySize {
+		return nil, merry.New("invalid ed25519 public key size")
+	}
+
+	return &Ed25519Verifier{publicKey: ed25519.PublicKey(key)}, nil
+}
+
+func (v *Ed25519Verifier) Verify(message, signature []byte) bool {
+	return ed25519.Verify(v.publicKey, message, signature)
+}
+
+// NewSignatureVerifier builds the verifier of the given mode.
+func NewSignatureVerifier(mode, secret, publicKey string) (SignatureVerifier, error) {
+	switch mode {
+	case SignatureHMAC:
+		if len(secret) == 0 {
+			return nil, merry.New("empty auth headers HMAC secret")
+		}
+		return NewHMACVerifier(secret), nil
+	case SignatureEd25519:
+		verifier, err := NewEd25519Verifier(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		return verifier, nil
+	default:
+		return nil, merry.Errorf("unknown auth headers signature mode: %s", mode)
+	}
+}
+
+// signedMessage returns the message signed by the auth server: the raw auth headers joined by new lines.
+// The timestamp is the Unix time of the signature, in seconds, so that the headers cannot be replayed
+// once they are too old.
+func signedMessage(payload, session, token, timestamp string) []byte {
+	return []byte(payload + "\n" + session + "\n" + token + "\n" + timestamp)
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+type AuditAction string
+
+// AuditEntry records a mutation of a user or an authentication event. The entries are
+// never updated nor removed.
+type AuditEntry struct {
+	Document
+	// The audited action.
+	Action AuditAction `json:"action,omitempty"`
+	// The key of the authenticated user who performed the action. Empty when anonymous.
+	Actor string `json:"actor,omitempty"`
+	// The key of the user the action applies to.
+	Target string `json:"target,omitempty"`
+	// The changed fields of the target before the action. The secrets are redacted.
+	Before map[string]interface{} `json:"before,omitempty"`
+	// The changed fields of the target after the action. The secrets are redacted.
+	After map[string]interface{} `json:"after,omitempty"`
+	// The ID of the request that performed the action.
+	RequestID string `json:"requestId,omitempty"`
+	// The IP address of the client.
+	IP string `json:"ip,omitempty"`
+	// The user agent of the client.
+	UserAgent string `json:"userAgent,omitempty"`
+	// The time of the action.
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+// swagger:response AuditEntriesResponse
+type auditEntriesResponse struct {
+	// in: body
+	Body []AuditEntry
+}
+
+// swagger:parameters AuditFind
+type auditFilterParam struct {
+	// JSON filter defining offset, limit, sort and where
+	//
+	// in: query
+	Filter string
+}
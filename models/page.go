@@ -0,0 +1,11 @@
+package models
+
+// Page locates a page of results in the whole result set.
+type Page struct {
+	// The number of documents matched by the filter.
+	Total int `json:"total"`
+	// The cursor of the next page. Empty on the last page.
+	Next string `json:"next,omitempty"`
+	// The cursor of the previous page. Empty on the first page.
+	Prev string `json:"prev,omitempty"`
+}
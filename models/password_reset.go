@@ -0,0 +1,27 @@
+package models
+
+type PasswordForgot struct {
+	// The user email.
+	Email string `json:"email,omitempty"`
+}
+
+// swagger:parameters UsersForgotPassword
+type passwordForgotBodyParam struct {
+	// required: true
+	// in: body
+	Body PasswordForgot
+}
+
+type PasswordReset struct {
+	// The reset token received by the user.
+	Token string `json:"token,omitempty"`
+	// The new user password.
+	Password string `json:"password,omitempty"`
+}
+
+// swagger:parameters UsersResetPassword
+type passwordResetBodyParam struct {
+	// required: true
+	// in: body
+	Body PasswordReset
+}
@@ -3,6 +3,8 @@ package models
 import "time"
 
 type Session struct {
+	// The session identifier, derived from its token.
+	ID string `json:"id,omitempty"`
 	// The creation timestamp.
 	Created *time.Time `json:"created,omitempty"`
 	// The validity time limit of the session.
@@ -21,6 +23,8 @@ type Session struct {
 	Payload string `json:"payload,omitempty"`
 	// The role name of the session.
 	Role Role `json:"role,omitempty"`
+	// Whether the session is the one of the current request.
+	Current bool `json:"current,omitempty"`
 }
 
 // swagger:response SessionResponse
@@ -28,3 +32,18 @@ type sessionResponse struct {
 	// in: body
 	Body Session
 }
+
+// swagger:response SessionsResponse
+type sessionsResponse struct {
+	// in: body
+	Body []Session
+}
+
+// swagger:parameters UsersDeleteSession
+type sessionIDParam struct {
+	// Session identifier or token
+	//
+	// required: true
+	// in: path
+	Session string
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// SessionRevocation is a pending revocation of the sessions of removed users,
+// kept until the sessions backend acknowledges it.
+type SessionRevocation struct {
+	Document
+	// The owner tokens of the sessions to revoke.
+	OwnerTokens []string `json:"ownerTokens,omitempty"`
+	// The number of failed attempts.
+	Attempts int `json:"attempts,omitempty"`
+	// The time before which the revocation is not retried.
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+	// The error returned by the last attempt.
+	LastError string `json:"lastError,omitempty"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type Token struct {
+	Document
+	// The SHA-256 hash of the token sent to the user.
+	Hash string `json:"hash,omitempty"`
+	// The key of the user the token was issued for.
+	UserKey string `json:"userKey,omitempty"`
+	// The email of the user when the token was issued.
+	Email string `json:"email,omitempty"`
+	// The validity time limit of the token.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Whether the token has already been consumed.
+	Used bool `json:"used,omitempty"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+type TwoFactorSetup struct {
+	// The base32 encoded TOTP secret.
+	Secret string `json:"secret,omitempty"`
+	// The otpauth URI to provision authenticator apps with.
+	URI string `json:"uri,omitempty"`
+}
+
+// swagger:response TwoFactorSetupResponse
+type twoFactorSetupResponse struct {
+	// in: body
+	Body TwoFactorSetup
+}
+
+type TwoFactorCode struct {
+	// A TOTP code or a recovery code.
+	Code string `json:"code,omitempty"`
+}
+
+// swagger:parameters UsersConfirmTwoFactor UsersDisableTwoFactor UsersRegenerateRecoveryCodes
+type twoFactorCodeBodyParam struct {
+	// required: true
+	// in: body
+	Body TwoFactorCode
+}
+
+type RecoveryCodes struct {
+	// The single-use recovery codes. They are only displayed once.
+	Codes []string `json:"codes,omitempty"`
+}
+
+// swagger:response RecoveryCodesResponse
+type recoveryCodesResponse struct {
+	// in: body
+	Body RecoveryCodes
+}
+
+type TwoFactorChallenge struct {
+	// The challenge to exchange with a code for a session.
+	Challenge string `json:"challenge,omitempty"`
+	// The validity time limit of the challenge.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// swagger:response TwoFactorChallengeResponse
+type twoFactorChallengeResponse struct {
+	// in: body
+	Body TwoFactorChallenge
+}
+
+type TwoFactorSignin struct {
+	// The challenge returned by the first sign in step.
+	Challenge string `json:"challenge,omitempty"`
+	// A TOTP code or a recovery code.
+	Code string `json:"code,omitempty"`
+}
+
+// swagger:parameters UsersSigninTwoFactor
+type twoFactorSigninBodyParam struct {
+	// required: true
+	// in: body
+	Body TwoFactorSignin
+}
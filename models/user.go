@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type User struct {
 	Document
 	// The user first name.
@@ -8,16 +10,40 @@ type User struct {
 	LastName string `json:"lastName,omitempty"`
 	// The user email.
 	Email string `json:"email,omitempty"`
+	// Whether the user email has been verified.
+	EmailVerified bool `json:"emailVerified,omitempty"`
+	// The email verification timestamp.
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty"`
 	// A unique identifier across the auth system.
 	OwnerToken string `json:"ownerToken,omitempty"`
 	// The user password.
 	Password string `json:"password,omitempty"`
+	// Whether the user must change its password before using the /users/me routes.
+	MustChangePassword bool `json:"mustChangePassword,omitempty"`
 	// The role name of the user.
 	Role Role `json:"role,omitempty"`
+	// Whether the two-factor authentication is enabled.
+	TwoFactorEnabled bool `json:"twoFactorEnabled,omitempty"`
+	// The TOTP secret of the user.
+	TwoFactorSecret string `json:"twoFactorSecret,omitempty"`
+	// The TOTP secret waiting for a confirmation code.
+	TwoFactorPendingSecret string `json:"twoFactorPendingSecret,omitempty"`
+	// The last accepted TOTP time step, used to reject replayed codes.
+	TwoFactorLastCounter int64 `json:"twoFactorLastCounter,omitempty"`
+	// The hashes of the unused recovery codes.
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+	// The soft deletion timestamp. Deleted users are hidden until restored or purged.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// The key of the user who deleted the user.
+	DeletedBy string `json:"deletedBy,omitempty"`
 }
 
 // swagger:response UsersResponse
 type usersResponse struct {
+	// The number of users matched by the filter.
+	XTotalCount int `json:"X-Total-Count"`
+	// The links to the next and previous pages.
+	Link string
 	// in: body
 	Body []User
 }
@@ -28,7 +54,8 @@ type userResponse struct {
 	Body User
 }
 
-// swagger:parameters UsersFindByKey UsersDeleteByKey UsersUpdateByKey UsersUpdatePassword
+// swagger:parameters UsersFindByKey UsersDeleteByKey UsersUpdateByKey UsersPatchByKey UsersUpdatePassword UsersUnlock UsersRestore
+// swagger:parameters UsersFindSessions UsersDeleteSession UsersDeleteSessions
 type usersKeyParam struct {
 	// User key
 	//
@@ -45,7 +72,49 @@ type usersFilterParam struct {
 	Filter string
 }
 
-// swagger:parameters UsersCreate UsersUpdate UsersUpdateByKey UsersSignup
+// swagger:parameters UsersUpdateByKey UsersPatchByKey UsersDeleteByKey
+type usersIfMatchParam struct {
+	// ETag of the user revision the change is based on
+	//
+	// in: header
+	IfMatch string `json:"If-Match"`
+}
+
+// swagger:parameters UsersFind UsersFindByKey
+type usersFieldsParam struct {
+	// Comma separated list of the fields to return. The key and the revision are always returned,
+	// and the private fields like the password or the TOTP secret cannot be selected
+	//
+	// in: query
+	Fields string
+}
+
+// swagger:parameters UsersSearch
+type usersSearchParams struct {
+	// Words to search, matching the beginning of the first name, last name or email words
+	//
+	// required: true
+	// in: query
+	Q string
+	// Number of users to skip
+	//
+	// in: query
+	Offset int
+	// Maximum number of users to return
+	//
+	// in: query
+	Limit int
+}
+
+// swagger:parameters UsersFind
+type usersCursorParam struct {
+	// Opaque pagination cursor, as given by the Link header
+	//
+	// in: query
+	Cursor string
+}
+
+// swagger:parameters UsersCreate UsersUpdate UsersUpdateByKey UsersPatchByKey UsersSignup
 type usersBodyParam struct {
 	// required: true
 	// in: body
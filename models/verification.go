@@ -0,0 +1,13 @@
+package models
+
+type Verification struct {
+	// The verification token received by the user.
+	Token string `json:"token,omitempty"`
+}
+
+// swagger:parameters UsersVerify
+type verificationBodyParam struct {
+	// required: true
+	// in: body
+	Body Verification
+}
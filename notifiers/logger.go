@@ -0,0 +1,41 @@
+package notifiers
+
+import (
+	"github.com/Sirupsen/logrus"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+// Logger is a notifier only logging the issued tokens, until a real delivery service is plugged.
+// The tokens themselves are written at debug level when logTokens is set, which must be
+// restricted to development.
+type Logger struct {
+	logger    *logrus.Logger
+	logTokens bool
+}
+
+func NewLogger(l *logrus.Logger, logTokens bool) *Logger {
+	return &Logger{logger: l, logTokens: logTokens}
+}
+
+func (n *Logger) SendResetToken(user *models.User, token string) error {
+	n.log("resetToken", user, token, "Password reset token issued.")
+	return nil
+}
+
+func (n *Logger) SendVerificationToken(user *models.User, token string) error {
+	n.log("verificationToken", user, token, "Email verification token issued.")
+	return nil
+}
+
+func (n *Logger) log(field string, user *models.User, token, msg string) {
+	if !n.logTokens {
+		n.logger.WithField("email", user.Email).Info(msg)
+		return
+	}
+
+	n.logger.WithFields(logrus.Fields{
+		"email": user.Email,
+		field:   token,
+	}).Debug(msg)
+}
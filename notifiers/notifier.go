@@ -0,0 +1,9 @@
+package notifiers
+
+import "github.com/solher/snakepit-seed/models"
+
+// Notifier delivers the password reset and email verification tokens to the users.
+type Notifier interface {
+	SendResetToken(user *models.User, token string) error
+	SendVerificationToken(user *models.User, token string) error
+}
@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"github.com/solher/arangolite"
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+// Audit stores the audit entries in the audit collection. The entries are only ever inserted.
+type Audit struct {
+	*Repository
+}
+
+func NewAudit(r *Repository) *Audit {
+	return &Audit{Repository: r}
+}
+
+func (r *Audit) Insert(entry *models.AuditEntry) error {
+	q := arangolite.NewQuery(`
+		INSERT @entry IN audit
+	`).Bind("entry", entry)
+
+	return r.Run(q, nil)
+}
+
+func (r *Audit) Find(f *filters.Filter) ([]models.AuditEntry, error) {
+	filter, err := utils.FilterToAQL("a", f)
+	if err != nil {
+		return nil, err
+	}
+
+	q := arangolite.NewQuery(`
+		FOR a IN audit
+		%s
+		RETURN a
+	`, filter)
+
+	entries := []models.AuditEntry{}
+
+	if err := r.Run(q, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
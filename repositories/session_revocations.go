@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/solher/arangolite"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+// SessionRevocations stores the pending session revocations in the sessionRevocations collection.
+type SessionRevocations struct {
+	*Repository
+}
+
+func NewSessionRevocations(r *Repository) *SessionRevocations {
+	return &SessionRevocations{Repository: r}
+}
+
+func (r *SessionRevocations) Insert(revocation *models.SessionRevocation) error {
+	q := arangolite.NewQuery(`
+		INSERT @revocation IN sessionRevocations
+	`).Bind("revocation", revocation)
+
+	return r.Run(q, nil)
+}
+
+// FindPending returns the revocations whose next attempt is due, the most overdue first.
+func (r *SessionRevocations) FindPending(limit int) ([]models.SessionRevocation, error) {
+	q := arangolite.NewQuery(`
+		FOR r IN sessionRevocations
+		FILTER DATE_TIMESTAMP(r.nextAttempt) <= DATE_NOW()
+		SORT r.nextAttempt
+		LIMIT @limit
+		RETURN r
+	`).Bind("limit", limit)
+
+	revocations := []models.SessionRevocation{}
+
+	if err := r.Run(q, &revocations); err != nil {
+		return nil, err
+	}
+
+	return revocations, nil
+}
+
+func (r *SessionRevocations) Reschedule(key string, attempts int, next time.Time, lastError string) error {
+	q := arangolite.NewQuery(`
+		UPDATE @key WITH { attempts: @attempts, nextAttempt: @next, lastError: @error } IN sessionRevocations
+	`).
+		Bind("key", key).
+		Bind("attempts", attempts).
+		Bind("next", next).
+		Bind("error", lastError)
+
+	return r.Run(q, nil)
+}
+
+func (r *SessionRevocations) Delete(key string) error {
+	q := arangolite.NewQuery(`
+		REMOVE @key IN sessionRevocations
+	`).Bind("key", key)
+
+	return r.Run(q, nil)
+}
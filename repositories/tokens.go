@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+)
+
+// Tokens stores the hashed single-use tokens, one collection per usage.
+type Tokens struct {
+	*Repository
+}
+
+func NewTokens(r *Repository) *Tokens {
+	return &Tokens{Repository: r}
+}
+
+// Replace removes the tokens of the user in the collection, then stores the given one.
+func (r *Tokens) Replace(collection string, token *models.Token) error {
+	q := arangolite.NewQuery(`
+		FOR t IN @@collection
+		FILTER t.userKey == @userKey
+		REMOVE t IN @@collection
+	`).Bind("@collection", collection).Bind("userKey", token.UserKey)
+
+	if err := r.Run(q, nil); err != nil {
+		return err
+	}
+
+	q = arangolite.NewQuery(`
+		INSERT @token IN @@collection
+	`).Bind("@collection", collection).Bind("token", token)
+
+	return r.Run(q, nil)
+}
+
+// Delete removes the tokens of the user in the collection.
+func (r *Tokens) Delete(collection, userKey string) error {
+	q := arangolite.NewQuery(`
+		FOR t IN @@collection
+		FILTER t.userKey == @userKey
+		REMOVE t IN @@collection
+	`).Bind("@collection", collection).Bind("userKey", userKey)
+
+	return r.Run(q, nil)
+}
+
+// Find returns the token with the given hash if it is still valid, without consuming it.
+func (r *Tokens) Find(collection, hash string) (*models.Token, error) {
+	q := arangolite.NewQuery(`
+		FOR t IN @@collection
+		FILTER t.hash == @hash && t.used != true && DATE_TIMESTAMP(t.expiresAt) > DATE_NOW()
+		LIMIT 1
+		RETURN t
+	`).Bind("@collection", collection).Bind("hash", hash)
+
+	tokens := []models.Token{}
+
+	if err := r.Run(q, &tokens); err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	return &tokens[0], nil
+}
+
+// Consume atomically marks the token with the given hash as used if it is still valid, and returns it.
+func (r *Tokens) Consume(collection, hash string) (*models.Token, error) {
+	q := arangolite.NewQuery(`
+		FOR t IN @@collection
+		FILTER t.hash == @hash && t.used != true && DATE_TIMESTAMP(t.expiresAt) > DATE_NOW()
+		UPDATE t WITH { used: true } IN @@collection
+		RETURN NEW
+	`).Bind("@collection", collection).Bind("hash", hash)
+
+	tokens := []models.Token{}
+
+	if err := r.Run(q, &tokens); err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	return &tokens[0], nil
+}
@@ -0,0 +1,226 @@
+package repositories
+
+import (
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite"
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+// Users stores the users in the ArangoDB users collection.
+type Users struct {
+	*Repository
+}
+
+func NewUsers(r *Repository) *Users {
+	return &Users{Repository: r}
+}
+
+// Find only returns the given fields of the users, plus their key and revision.
+// All the fields are returned when fields is nil.
+func (r *Users) Find(f *filters.Filter, fields []string) ([]models.User, error) {
+	filter, err := utils.FilterToAQL("u", f)
+	if err != nil {
+		return nil, err
+	}
+
+	q := arangolite.NewQuery(`
+		FOR u IN users
+		%s
+		RETURN @fields == null ? u : KEEP(u, APPEND(@fields, ["_key", "_rev"]))
+	`, filter).Bind("fields", fields)
+
+	users := []models.User{}
+
+	if err := r.Run(q, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Count returns the number of users matched by the where conditions of the filter.
+func (r *Users) Count(f *filters.Filter) (int, error) {
+	where := &filters.Filter{}
+	if f != nil {
+		where.Where = f.Where
+	}
+
+	filter, err := utils.FilterToAQL("u", where)
+	if err != nil {
+		return 0, err
+	}
+
+	q := arangolite.NewQuery(`
+		FOR u IN users
+		%s
+		COLLECT WITH COUNT INTO n
+		RETURN n
+	`, filter)
+
+	counts := []int{}
+
+	if err := r.Run(q, &counts); err != nil {
+		return 0, err
+	}
+
+	if len(counts) == 0 {
+		return 0, nil
+	}
+
+	return counts[0], nil
+}
+
+func (r *Users) FindByEmail(email string) (*models.User, error) {
+	q := arangolite.NewQuery(`
+		FOR u IN users
+		FILTER u.email == @email
+		LIMIT 1
+		RETURN u
+	`).Bind("email", email)
+
+	users := []models.User{}
+
+	if err := r.Run(q, &users); err != nil {
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	return &users[0], nil
+}
+
+func (r *Users) Insert(users []models.User) ([]models.User, error) {
+	q := arangolite.NewQuery(`
+		FOR u IN @users
+		INSERT u IN users
+		RETURN NEW
+	`).Bind("users", users)
+
+	users = []models.User{}
+
+	if err := r.run(q, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Update merges the user into the users matched by the filter whose revision is one of revs,
+// unless revs is nil. The check is done in the query so a concurrent update cannot slip in between.
+// Changing the email resets its verification.
+func (r *Users) Update(f *filters.Filter, revs []string, user *models.User) ([]models.User, error) {
+	filter, err := utils.FilterToAQL("u", f)
+	if err != nil {
+		return nil, err
+	}
+
+	q := arangolite.NewQuery(`
+		FOR u IN users
+		%s
+		FILTER @revs == null || u._rev IN @revs
+		LET verification = @user.email != null && @user.email != u.email ?
+			{ emailVerified: false, emailVerifiedAt: null } : {}
+		UPDATE u WITH MERGE(verification, @user) IN users
+		RETURN NEW
+	`, filter).Bind("user", user).Bind("revs", revs)
+
+	users := []models.User{}
+
+	if err := r.run(q, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Replace replaces the user with the given one, like Update does for the revision check.
+// The password, the owner token, the two-factor and deletion fields and, unless given, the must change password
+// flag, the role and the email verification are preserved. NotFound is returned when no user
+// has the key with one of the given revisions.
+func (r *Users) Replace(key string, revs []string, user *models.User) (*models.User, error) {
+	q := arangolite.NewQuery(`
+		FOR u IN users
+		FILTER u._key == @key
+		FILTER @revs == null || u._rev IN @revs
+		LET protected = KEEP(u, "password", "mustChangePassword", "ownerToken", "role", "emailVerified", "emailVerifiedAt",
+			"twoFactorEnabled", "twoFactorSecret", "twoFactorPendingSecret", "twoFactorLastCounter", "recoveryCodes",
+			"deletedAt", "deletedBy")
+		LET verification = @user.email != u.email ?
+			{ emailVerified: false, emailVerifiedAt: null } : {}
+		REPLACE u WITH MERGE(protected, verification, @user) IN users
+		RETURN NEW
+	`).Bind("key", key).Bind("revs", revs).Bind("user", user)
+
+	return r.runOne(q)
+}
+
+// Patch applies a RFC 7396 merge patch to the user: objects are merged recursively
+// and null values remove the matching fields. NotFound is returned when no user
+// has the key with one of the given revisions.
+func (r *Users) Patch(key string, revs []string, patch map[string]interface{}) (*models.User, error) {
+	q := arangolite.NewQuery(`
+		FOR u IN users
+		FILTER u._key == @key
+		FILTER @revs == null || u._rev IN @revs
+		LET verification = HAS(@patch, "email") && @patch.email != u.email ?
+			{ emailVerified: null, emailVerifiedAt: null } : {}
+		UPDATE u WITH MERGE(verification, @patch) IN users OPTIONS { keepNull: false, mergeObjects: true }
+		RETURN NEW
+	`).Bind("key", key).Bind("revs", revs).Bind("patch", patch)
+
+	return r.runOne(q)
+}
+
+func (r *Users) Delete(f *filters.Filter) ([]models.User, error) {
+	filter, err := utils.FilterToAQL("u", f)
+	if err != nil {
+		return nil, err
+	}
+
+	q := arangolite.NewQuery(`
+		FOR u IN users
+		%s
+		REMOVE u IN users
+		RETURN OLD
+	`, filter)
+
+	users := []models.User{}
+
+	if err := r.Run(q, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// run runs a writing query, reporting the unique index violations as taken emails.
+func (r *Users) run(q arangolite.Runnable, users *[]models.User) error {
+	if err := r.Run(q, users); err != nil {
+		if utils.IsUniqueViolation(err) {
+			return merry.Here(errs.EmailTaken)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *Users) runOne(q arangolite.Runnable) (*models.User, error) {
+	users := []models.User{}
+
+	if err := r.run(q, &users); err != nil {
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	return &users[0], nil
+}
@@ -0,0 +1,22 @@
+package stores
+
+import "time"
+
+// Memory gathers the in-memory stores backing the API when it runs without database.
+type Memory struct {
+	Users       *MemoryUsers
+	Tokens      *MemoryTokens
+	Sessions    *MemorySessions
+	Revocations *MemorySessionRevocations
+	Audit       *MemoryAudit
+}
+
+func NewMemory(sessionsTTL time.Duration) *Memory {
+	return &Memory{
+		Users:       NewMemoryUsers(),
+		Tokens:      NewMemoryTokens(),
+		Sessions:    NewMemorySessions(sessionsTTL),
+		Revocations: NewMemorySessionRevocations(),
+		Audit:       NewMemoryAudit(),
+	}
+}
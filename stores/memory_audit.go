@@ -0,0 +1,62 @@
+package stores
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+// MemoryAudit is a goroutine safe in-memory append-only store of the audit entries.
+// It is only suited for tests and development as nothing is persisted.
+type MemoryAudit struct {
+	mutex   sync.RWMutex
+	serial  int
+	entries []document
+}
+
+func NewMemoryAudit() *MemoryAudit {
+	return &MemoryAudit{}
+}
+
+func (s *MemoryAudit) Insert(entry *models.AuditEntry) error {
+	doc, err := toDocument(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.serial++
+	key := strconv.Itoa(s.serial)
+
+	doc["_key"] = key
+	doc["_id"] = "audit/" + key
+	doc["_rev"] = "1"
+
+	s.entries = append(s.entries, doc)
+
+	return nil
+}
+
+func (s *MemoryAudit) Find(f *filters.Filter) ([]models.AuditEntry, error) {
+	s.mutex.RLock()
+	docs := append([]document{}, s.entries...)
+	s.mutex.RUnlock()
+
+	docs, err := applyFilter(docs, f)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.AuditEntry{}
+
+	if err := fromDocuments(docs, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
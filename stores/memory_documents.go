@@ -0,0 +1,457 @@
+package stores
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/errs"
+)
+
+// document is the JSON representation of a stored model. The in-memory stores evaluate
+// the filters and apply the updates on it, so that they behave like ArangoDB does.
+type document map[string]interface{}
+
+func toDocument(v interface{}) (document, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, merry.Here(err)
+	}
+
+	doc := document{}
+
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	return doc, nil
+}
+
+// fromDocuments decodes the documents into v, which must be a pointer to a slice of models.
+func fromDocuments(docs []document, v interface{}) error {
+	raw, err := json.Marshal(docs)
+	if err != nil {
+		return merry.Here(err)
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
+
+// get returns the value at the given dot separated path, or nil when missing.
+func (d document) get(path string) interface{} {
+	var value interface{} = map[string]interface{}(d)
+
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	return value
+}
+
+// keep returns a copy of the document only containing the given attributes, like the AQL KEEP.
+func (d document) keep(names ...string) document {
+	kept := document{}
+
+	for _, name := range names {
+		if value, ok := d[name]; ok {
+			kept[name] = value
+		}
+	}
+
+	return kept
+}
+
+// merge returns a copy of the document with the patch recursively merged in, like an AQL UPDATE
+// with mergeObjects. Null patch values remove the attributes unless keepNull is set.
+func (d document) merge(patch map[string]interface{}, keepNull bool) document {
+	merged := document{}
+	for name, value := range d {
+		merged[name] = value
+	}
+
+	for name, value := range patch {
+		switch value := value.(type) {
+		case nil:
+			if keepNull {
+				merged[name] = nil
+			} else {
+				delete(merged, name)
+			}
+		case map[string]interface{}:
+			current, _ := merged[name].(map[string]interface{})
+			merged[name] = map[string]interface{}(document(current).merge(value, keepNull))
+		default:
+			merged[name] = value
+		}
+	}
+
+	return merged
+}
+
+// normalizeWhere converts the values of the where conditions to their JSON representation,
+// so that they can be compared with the documents ones.
+func normalizeWhere(where []map[string]interface{}) ([]map[string]interface{}, error) {
+	raw, err := json.Marshal(where)
+	if err != nil {
+		return nil, merry.Here(err)
+	}
+
+	normalized := []map[string]interface{}{}
+
+	if err := json.Unmarshal(raw, &normalized); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	return normalized, nil
+}
+
+// matchWhere reports whether the document matches all the where conditions of a filter.
+func matchWhere(doc document, where []map[string]interface{}) (bool, error) {
+	for _, cond := range where {
+		ok, err := matchCondition(doc, cond)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchCondition(doc document, cond map[string]interface{}) (bool, error) {
+	for field, value := range cond {
+		var (
+			ok  bool
+			err error
+		)
+
+		switch field {
+		case "and", "or":
+			ok, err = matchConditions(doc, field, value)
+		case "not":
+			sub, isCond := value.(map[string]interface{})
+			if !isCond {
+				return false, merry.Here(errs.InvalidFilter).WithMessagef("%q expects a condition", field)
+			}
+			ok, err = matchCondition(doc, sub)
+			ok = !ok
+		default:
+			ops, isOps := value.(map[string]interface{})
+			if !isOps {
+				ops = map[string]interface{}{"eq": value}
+			}
+			ok, err = matchOperators(doc.get(field), ops)
+		}
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchConditions(doc document, op string, value interface{}) (bool, error) {
+	conds, ok := value.([]interface{})
+	if !ok {
+		return false, merry.Here(errs.InvalidFilter).WithMessagef("%q expects a list of conditions", op)
+	}
+
+	for _, c := range conds {
+		sub, ok := c.(map[string]interface{})
+		if !ok {
+			return false, merry.Here(errs.InvalidFilter).WithMessagef("%q expects a list of conditions", op)
+		}
+
+		matched, err := matchCondition(doc, sub)
+		if err != nil {
+			return false, err
+		}
+
+		if op == "or" && matched {
+			return true, nil
+		}
+		if op == "and" && !matched {
+			return false, nil
+		}
+	}
+
+	return op == "and", nil
+}
+
+func matchOperators(value interface{}, ops map[string]interface{}) (bool, error) {
+	for op, operand := range ops {
+		var ok bool
+
+		switch op {
+		case "eq":
+			ok = compareValues(value, operand) == 0
+		case "neq":
+			ok = compareValues(value, operand) != 0
+		case "gt":
+			ok = compareValues(value, operand) > 0
+		case "gte":
+			ok = compareValues(value, operand) >= 0
+		case "lt":
+			ok = compareValues(value, operand) < 0
+		case "lte":
+			ok = compareValues(value, operand) <= 0
+		case "in", "nin":
+			list, isList := operand.([]interface{})
+			if !isList {
+				return false, merry.Here(errs.InvalidFilter).WithMessagef("%q expects a list", op)
+			}
+			ok = contains(list, value) == (op == "in")
+		case "like", "nlike":
+			pattern, isString := operand.(string)
+			if !isString {
+				return false, merry.Here(errs.InvalidFilter).WithMessagef("%q expects a string", op)
+			}
+			s, _ := value.(string)
+			ok = like(s, pattern) == (op == "like")
+		default:
+			return false, merry.Here(errs.InvalidFilter).WithMessagef("unknown operator %q", op)
+		}
+
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func contains(list []interface{}, value interface{}) bool {
+	for _, v := range list {
+		if compareValues(v, value) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// like matches the string against a case insensitive LIKE pattern, where "%" matches any
+// sequence of characters and "_" any single character. They can be escaped with a backslash.
+func like(s, pattern string) bool {
+	expr := []string{"(?is)^"}
+	escaped := false
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expr = append(expr, regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			expr = append(expr, ".*")
+		case r == '_':
+			expr = append(expr, ".")
+		default:
+			expr = append(expr, regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	expr = append(expr, "$")
+
+	return regexp.MustCompile(strings.Join(expr, "")).MatchString(s)
+}
+
+// compareValues orders two JSON values like AQL does: null < bool < number < string < array < object.
+// Arrays are compared element by element and objects attribute by attribute, in name order.
+func compareValues(a, b interface{}) int {
+	if ra, rb := typeRank(a), typeRank(b); ra != rb {
+		return compareInts(ra, rb)
+	}
+
+	switch a := a.(type) {
+	case bool:
+		b := b.(bool)
+		switch {
+		case a == b:
+			return 0
+		case !a:
+			return -1
+		default:
+			return 1
+		}
+	case float64:
+		b := b.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		default:
+			return 0
+		}
+	case string:
+		return strings.Compare(a, b.(string))
+	case []interface{}:
+		b := b.([]interface{})
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if c := compareValues(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(len(a), len(b))
+	case map[string]interface{}:
+		b := b.(map[string]interface{})
+		names := []string{}
+		for name := range a {
+			names = append(names, name)
+		}
+		for name := range b {
+			if _, ok := a[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if c := compareValues(a[name], b[name]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	default:
+		return 0
+	}
+}
+
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	case []interface{}:
+		return 4
+	default:
+		return 5
+	}
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+type sortClause struct {
+	field string
+	desc  bool
+}
+
+// sortDocuments sorts the documents according to the sort clauses of a filter, "field" or "field DESC".
+func sortDocuments(docs []document, clauses []string) error {
+	sorter := &documentsSorter{docs: docs}
+
+	for _, clause := range clauses {
+		fields := strings.Fields(clause)
+		if len(fields) == 0 || len(fields) > 2 {
+			return merry.Here(errs.InvalidFilter).WithMessagef("invalid sort clause %q", clause)
+		}
+
+		c := sortClause{field: fields[0]}
+		if len(fields) == 2 {
+			switch strings.ToUpper(fields[1]) {
+			case "ASC":
+			case "DESC":
+				c.desc = true
+			default:
+				return merry.Here(errs.InvalidFilter).WithMessagef("invalid sort clause %q", clause)
+			}
+		}
+
+		sorter.clauses = append(sorter.clauses, c)
+	}
+
+	sort.Stable(sorter)
+
+	return nil
+}
+
+type documentsSorter struct {
+	docs    []document
+	clauses []sortClause
+}
+
+func (s *documentsSorter) Len() int      { return len(s.docs) }
+func (s *documentsSorter) Swap(i, j int) { s.docs[i], s.docs[j] = s.docs[j], s.docs[i] }
+
+func (s *documentsSorter) Less(i, j int) bool {
+	for _, c := range s.clauses {
+		cmp := compareValues(s.docs[i].get(c.field), s.docs[j].get(c.field))
+		if cmp == 0 {
+			continue
+		}
+		if c.desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+
+	return false
+}
+
+// applyFilter returns the documents matched by the filter, sorted and paginated.
+func applyFilter(docs []document, f *filters.Filter) ([]document, error) {
+	if f == nil {
+		f = &filters.Filter{}
+	}
+
+	where, err := normalizeWhere(f.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []document{}
+
+	for _, doc := range docs {
+		ok, err := matchWhere(doc, where)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, doc)
+		}
+	}
+
+	if err := sortDocuments(matched, f.Sort); err != nil {
+		return nil, err
+	}
+
+	if offset := f.Offset; offset > 0 {
+		if offset > len(matched) {
+			offset = len(matched)
+		}
+		matched = matched[offset:]
+	}
+
+	if f.Limit > 0 && f.Limit < len(matched) {
+		matched = matched[:f.Limit]
+	}
+
+	return matched, nil
+}
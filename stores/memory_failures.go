@@ -0,0 +1,100 @@
+package stores
+
+import (
+	"sync"
+	"time"
+)
+
+const sweepInterval = 1000
+
+type failures struct {
+	count int
+	last  time.Time
+}
+
+// MemoryFailures is a goroutine safe in-memory failures counter.
+// Counters are forgotten after ttl without new failure. It is only suited
+// for tests and single node deployments as the counters are not shared.
+type MemoryFailures struct {
+	mutex    sync.Mutex
+	ttl      time.Duration
+	counters map[string]*failures
+	incrs    int
+}
+
+func NewMemoryFailures(ttl time.Duration) *MemoryFailures {
+	return &MemoryFailures{
+		ttl:      ttl,
+		counters: map[string]*failures{},
+	}
+}
+
+func (s *MemoryFailures) Get(key string) (int, time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f := s.get(key, time.Now())
+	if f == nil {
+		return 0, time.Time{}, nil
+	}
+
+	return f.count, f.last, nil
+}
+
+func (s *MemoryFailures) Incr(key string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+
+	s.incrs++
+	if s.incrs%sweepInterval == 0 {
+		s.sweep(now)
+	}
+
+	f := s.get(key, now)
+	if f == nil {
+		f = &failures{}
+		s.counters[key] = f
+	}
+
+	f.count++
+	f.last = now
+
+	return f.count, nil
+}
+
+func (s *MemoryFailures) Reset(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.counters, key)
+
+	return nil
+}
+
+func (s *MemoryFailures) get(key string, now time.Time) *failures {
+	f, ok := s.counters[key]
+	if !ok {
+		return nil
+	}
+
+	if s.expired(f, now) {
+		delete(s.counters, key)
+		return nil
+	}
+
+	return f
+}
+
+func (s *MemoryFailures) expired(f *failures, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(f.last) > s.ttl
+}
+
+func (s *MemoryFailures) sweep(now time.Time) {
+	for key, f := range s.counters {
+		if s.expired(f, now) {
+			delete(s.counters, key)
+		}
+	}
+}
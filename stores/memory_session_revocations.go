@@ -0,0 +1,103 @@
+package stores
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+// MemorySessionRevocations is a goroutine safe in-memory store of the pending session revocations.
+// It is only suited for tests and development as nothing is persisted.
+type MemorySessionRevocations struct {
+	mutex       sync.Mutex
+	serial      int
+	revocations map[string]models.SessionRevocation
+}
+
+func NewMemorySessionRevocations() *MemorySessionRevocations {
+	return &MemorySessionRevocations{
+		revocations: map[string]models.SessionRevocation{},
+	}
+}
+
+func (s *MemorySessionRevocations) Insert(revocation *models.SessionRevocation) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.serial++
+	key := strconv.Itoa(s.serial)
+
+	inserted := *revocation
+	inserted.Key = key
+	inserted.ID = "sessionRevocations/" + key
+	inserted.Rev = "1"
+
+	s.revocations[key] = inserted
+
+	return nil
+}
+
+// FindPending returns the revocations whose next attempt is due, the most overdue first.
+func (s *MemorySessionRevocations) FindPending(limit int) ([]models.SessionRevocation, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	revocations := revocationsByNextAttempt{}
+
+	for _, revocation := range s.revocations {
+		if revocation.NextAttempt == nil || !revocation.NextAttempt.After(now) {
+			revocations = append(revocations, revocation)
+		}
+	}
+
+	sort.Sort(revocations)
+
+	if limit >= 0 && len(revocations) > limit {
+		revocations = revocations[:limit]
+	}
+
+	return revocations, nil
+}
+
+func (s *MemorySessionRevocations) Reschedule(key string, attempts int, next time.Time, lastError string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	revocation, ok := s.revocations[key]
+	if !ok {
+		return nil
+	}
+
+	revocation.Attempts = attempts
+	revocation.NextAttempt = &next
+	revocation.LastError = lastError
+
+	s.revocations[key] = revocation
+
+	return nil
+}
+
+func (s *MemorySessionRevocations) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.revocations, key)
+
+	return nil
+}
+
+// revocationsByNextAttempt sorts the revocations from the most overdue to the least.
+type revocationsByNextAttempt []models.SessionRevocation
+
+func (r revocationsByNextAttempt) Len() int      { return len(r) }
+func (r revocationsByNextAttempt) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r revocationsByNextAttempt) Less(i, j int) bool {
+	if r[i].NextAttempt == nil || r[j].NextAttempt == nil {
+		return r[j].NextAttempt != nil
+	}
+	return r[i].NextAttempt.Before(*r[j].NextAttempt)
+}
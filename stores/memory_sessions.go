@@ -0,0 +1,149 @@
+package stores
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ansel1/merry"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+// MemorySessions is a goroutine safe in-memory implementation of the local sessions, keyed by
+// the hash of their token. It is only suited for tests and development as nothing is persisted.
+type MemorySessions struct {
+	mutex    sync.Mutex
+	ttl      time.Duration
+	sessions map[string]models.Session
+}
+
+func NewMemorySessions(ttl time.Duration) *MemorySessions {
+	return &MemorySessions{
+		ttl:      ttl,
+		sessions: map[string]models.Session{},
+	}
+}
+
+func (s *MemorySessions) Create(session *models.Session) (*models.Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	validTo := now.Add(s.ttl)
+
+	for id, existing := range s.sessions {
+		if existing.OwnerToken == session.OwnerToken && !existing.ValidTo.After(now) {
+			delete(s.sessions, id)
+		}
+	}
+
+	token := utils.GenToken(64)
+
+	stored := *session
+	stored.ID = utils.HashToken(token)
+	stored.Token = ""
+	stored.Created = &now
+	stored.ValidTo = &validTo
+
+	s.sessions[stored.ID] = stored
+
+	created := stored
+	created.Token = token
+
+	return &created, nil
+}
+
+func (s *MemorySessions) FindByToken(token string) (*models.Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, ok := s.sessions[utils.HashToken(token)]
+	if !ok || !session.ValidTo.After(time.Now()) {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	session.Token = token
+
+	return &session, nil
+}
+
+func (s *MemorySessions) Delete(token string) (*models.Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := utils.HashToken(token)
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	delete(s.sessions, id)
+
+	session.Token = token
+
+	return &session, nil
+}
+
+// FindByOwnerToken returns the active sessions of the owner, identified by their ID.
+func (s *MemorySessions) FindByOwnerToken(ownerToken string) ([]models.Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	sessions := sessionsByCreation{}
+
+	for _, session := range s.sessions {
+		if session.OwnerToken == ownerToken && session.ValidTo.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Sort(sessions)
+
+	return sessions, nil
+}
+
+func (s *MemorySessions) DeleteByIDs(ownerToken string, ids []string) ([]models.Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sessions := []models.Session{}
+
+	for _, id := range ids {
+		if session, ok := s.sessions[id]; ok && session.OwnerToken == ownerToken {
+			sessions = append(sessions, session)
+			delete(s.sessions, id)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *MemorySessions) DeleteCascade(ownerTokens []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	owners := map[string]bool{}
+	for _, ownerToken := range ownerTokens {
+		owners[ownerToken] = true
+	}
+
+	for id, session := range s.sessions {
+		if owners[session.OwnerToken] {
+			delete(s.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+// sessionsByCreation sorts the sessions from the most recent to the oldest.
+type sessionsByCreation []models.Session
+
+func (s sessionsByCreation) Len() int           { return len(s) }
+func (s sessionsByCreation) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s sessionsByCreation) Less(i, j int) bool { return s[i].Created.After(*s[j].Created) }
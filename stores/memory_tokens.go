@@ -0,0 +1,89 @@
+package stores
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ansel1/merry"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+)
+
+// MemoryTokens is a goroutine safe in-memory tokens store. It is only suited for tests
+// and development as nothing is persisted.
+type MemoryTokens struct {
+	mutex       sync.Mutex
+	collections map[string]map[string]models.Token
+}
+
+func NewMemoryTokens() *MemoryTokens {
+	return &MemoryTokens{
+		collections: map[string]map[string]models.Token{},
+	}
+}
+
+// Replace removes the tokens of the user in the collection, then stores the given one.
+func (s *MemoryTokens) Replace(collection string, token *models.Token) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tokens, ok := s.collections[collection]
+	if !ok {
+		tokens = map[string]models.Token{}
+		s.collections[collection] = tokens
+	}
+
+	for hash, t := range tokens {
+		if t.UserKey == token.UserKey {
+			delete(tokens, hash)
+		}
+	}
+
+	tokens[token.Hash] = *token
+
+	return nil
+}
+
+// Delete removes the tokens of the user in the collection.
+func (s *MemoryTokens) Delete(collection, userKey string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for hash, t := range s.collections[collection] {
+		if t.UserKey == userKey {
+			delete(s.collections[collection], hash)
+		}
+	}
+
+	return nil
+}
+
+// Find returns the token with the given hash if it is still valid, without consuming it.
+func (s *MemoryTokens) Find(collection, hash string) (*models.Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	t, ok := s.collections[collection][hash]
+	if !ok || t.Used || t.ExpiresAt == nil || !t.ExpiresAt.After(time.Now()) {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	return &t, nil
+}
+
+// Consume marks the token with the given hash as used if it is still valid, and returns it.
+func (s *MemoryTokens) Consume(collection, hash string) (*models.Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	t, ok := s.collections[collection][hash]
+	if !ok || t.Used || t.ExpiresAt == nil || !t.ExpiresAt.After(time.Now()) {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	t.Used = true
+	s.collections[collection][hash] = t
+
+	return &t, nil
+}
@@ -0,0 +1,380 @@
+package stores
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+)
+
+// protectedUserFields are preserved when a user is replaced, unless given.
+var protectedUserFields = []string{
+	"password", "mustChangePassword", "ownerToken", "role", "emailVerified", "emailVerifiedAt",
+	"twoFactorEnabled", "twoFactorSecret", "twoFactorPendingSecret", "twoFactorLastCounter", "recoveryCodes",
+	"deletedAt", "deletedBy",
+}
+
+// MemoryUsers is a goroutine safe in-memory users store, filtering and updating the users
+// like the ArangoDB one, including the email uniqueness. The users are also indexed for
+// the search. It is only suited for tests and development as nothing is persisted.
+type MemoryUsers struct {
+	mutex    sync.RWMutex
+	users    map[string]document
+	keys     []string
+	serial   int
+	revision int
+	search   *MemoryUsersSearch
+}
+
+func NewMemoryUsers() *MemoryUsers {
+	return &MemoryUsers{
+		users:  map[string]document{},
+		search: NewMemoryUsersSearch(),
+	}
+}
+
+func (s *MemoryUsers) Find(f *filters.Filter, fields []string) ([]models.User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	docs, err := applyFilter(s.all(), f)
+	if err != nil {
+		return nil, err
+	}
+
+	if fields != nil {
+		names := append(append([]string{}, fields...), "_key", "_rev")
+		for i, doc := range docs {
+			docs[i] = doc.keep(names...)
+		}
+	}
+
+	return toUsers(docs)
+}
+
+func (s *MemoryUsers) Count(f *filters.Filter) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	where := &filters.Filter{}
+	if f != nil {
+		where.Where = f.Where
+	}
+
+	docs, err := applyFilter(s.all(), where)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(docs), nil
+}
+
+func (s *MemoryUsers) FindByEmail(email string) (*models.User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, key := range s.keys {
+		if s.users[key]["email"] == email {
+			users, err := toUsers([]document{s.users[key]})
+			if err != nil {
+				return nil, err
+			}
+			return &users[0], nil
+		}
+	}
+
+	return nil, merry.Here(errs.NotFound)
+}
+
+func (s *MemoryUsers) Insert(users []models.User) ([]models.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	docs := []document{}
+	inserted := map[string]bool{}
+
+	for _, user := range users {
+		doc, err := toDocument(&user)
+		if err != nil {
+			return nil, err
+		}
+
+		key, _ := doc["_key"].(string)
+		if key == "" {
+			key = s.nextKey()
+		}
+		if _, ok := s.users[key]; ok || inserted[key] {
+			return nil, merry.Here(errs.EmailTaken)
+		}
+		inserted[key] = true
+
+		docs = append(docs, s.stamp(doc, key))
+	}
+
+	if err := s.commit(docs, nil); err != nil {
+		return nil, err
+	}
+
+	return toUsers(docs)
+}
+
+// Update merges the user into the users matched by the filter whose revision is one of revs,
+// unless revs is nil. Changing the email resets its verification.
+func (s *MemoryUsers) Update(f *filters.Filter, revs []string, user *models.User) ([]models.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	patch, err := toDocument(user)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := applyFilter(s.all(), f)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := []document{}
+
+	for _, doc := range matched {
+		if !hasRevision(doc, revs) {
+			continue
+		}
+
+		update := document{}
+		if email, ok := patch["email"]; ok && compareValues(email, doc["email"]) != 0 {
+			update["emailVerified"] = false
+			update["emailVerifiedAt"] = nil
+		}
+
+		docs = append(docs, s.stamp(doc.merge(update, true).merge(patch, true), doc["_key"].(string)))
+	}
+
+	if err := s.commit(docs, nil); err != nil {
+		return nil, err
+	}
+
+	return toUsers(docs)
+}
+
+// Replace replaces the user, preserving its protected fields unless given. NotFound is returned
+// when no user has the key with one of the given revisions.
+func (s *MemoryUsers) Replace(key string, revs []string, user *models.User) (*models.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	doc, ok := s.users[key]
+	if !ok || !hasRevision(doc, revs) {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	replacement, err := toDocument(user)
+	if err != nil {
+		return nil, err
+	}
+
+	next := doc.keep(protectedUserFields...)
+	if compareValues(replacement["email"], doc["email"]) != 0 {
+		next["emailVerified"] = false
+		next["emailVerifiedAt"] = nil
+	}
+	for name, value := range replacement {
+		next[name] = value
+	}
+
+	return s.commitOne(s.stamp(next, key))
+}
+
+// Patch applies a merge patch to the user, null values removing the fields. NotFound is returned
+// when no user has the key with one of the given revisions.
+func (s *MemoryUsers) Patch(key string, revs []string, patch map[string]interface{}) (*models.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	doc, ok := s.users[key]
+	if !ok || !hasRevision(doc, revs) {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	normalized, err := toDocument(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	update := document{}
+	if email, ok := normalized["email"]; ok && compareValues(email, doc["email"]) != 0 {
+		update["emailVerified"] = nil
+		update["emailVerifiedAt"] = nil
+	}
+
+	return s.commitOne(s.stamp(doc.merge(update, false).merge(normalized, false), key))
+}
+
+func (s *MemoryUsers) Delete(f *filters.Filter) ([]models.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	docs, err := applyFilter(s.all(), f)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.commit(nil, docs); err != nil {
+		return nil, err
+	}
+
+	return toUsers(docs)
+}
+
+// Search ranks the users like the ArangoDB fulltext search.
+func (s *MemoryUsers) Search(words []string, offset, limit int) ([]models.User, int, error) {
+	return s.search.Search(words, offset, limit)
+}
+
+// all returns the users in insertion order.
+func (s *MemoryUsers) all() []document {
+	docs := make([]document, 0, len(s.keys))
+
+	for _, key := range s.keys {
+		docs = append(docs, s.users[key])
+	}
+
+	return docs
+}
+
+func (s *MemoryUsers) nextKey() string {
+	for {
+		s.serial++
+		key := strconv.Itoa(s.serial)
+		if _, ok := s.users[key]; !ok {
+			return key
+		}
+	}
+}
+
+// stamp sets the system attributes of the document, with a new revision.
+func (s *MemoryUsers) stamp(doc document, key string) document {
+	s.revision++
+
+	stamped := doc.merge(nil, true)
+	stamped["_key"] = key
+	stamped["_id"] = "users/" + key
+	stamped["_rev"] = strconv.Itoa(s.revision)
+
+	return stamped
+}
+
+func (s *MemoryUsers) commitOne(doc document) (*models.User, error) {
+	if err := s.commit([]document{doc}, nil); err != nil {
+		return nil, err
+	}
+
+	users, err := toUsers([]document{doc})
+	if err != nil {
+		return nil, err
+	}
+
+	return &users[0], nil
+}
+
+// commit saves the written documents and removes the removed ones. Nothing is changed
+// if a written document would break the email uniqueness.
+func (s *MemoryUsers) commit(written, removed []document) error {
+	changed := map[string]bool{}
+	for _, doc := range written {
+		changed[doc["_key"].(string)] = true
+	}
+	for _, doc := range removed {
+		changed[doc["_key"].(string)] = true
+	}
+
+	for i, doc := range written {
+		for _, other := range written[i+1:] {
+			if compareValues(doc["email"], other["email"]) == 0 {
+				return merry.Here(errs.EmailTaken)
+			}
+		}
+
+		for _, key := range s.keys {
+			if !changed[key] && compareValues(doc["email"], s.users[key]["email"]) == 0 {
+				return merry.Here(errs.EmailTaken)
+			}
+		}
+	}
+
+	if len(removed) > 0 {
+		keys := []string{}
+		for _, key := range s.keys {
+			if !isRemoved(key, removed) {
+				keys = append(keys, key)
+			}
+		}
+		s.keys = keys
+
+		for _, doc := range removed {
+			key := doc["_key"].(string)
+			delete(s.users, key)
+			s.search.Remove(key)
+		}
+	}
+
+	users, err := toUsers(written)
+	if err != nil {
+		return err
+	}
+
+	for i, doc := range written {
+		key := doc["_key"].(string)
+		if _, ok := s.users[key]; !ok {
+			s.keys = append(s.keys, key)
+		}
+		s.users[key] = doc
+
+		// The soft deleted users are not searchable.
+		if users[i].DeletedAt != nil {
+			s.search.Remove(key)
+		} else {
+			s.search.Put(users[i])
+		}
+	}
+
+	return nil
+}
+
+func isRemoved(key string, removed []document) bool {
+	for _, doc := range removed {
+		if doc["_key"] == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasRevision(doc document, revs []string) bool {
+	if revs == nil {
+		return true
+	}
+
+	for _, rev := range revs {
+		if doc["_rev"] == rev {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toUsers(docs []document) ([]models.User, error) {
+	users := []models.User{}
+
+	if err := fromDocuments(docs, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
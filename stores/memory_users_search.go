@@ -0,0 +1,138 @@
+package stores
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+// MemoryUsersSearch is a goroutine safe in-memory implementation of the users search,
+// ranking the users like the ArangoDB one. It is only suited for tests as the indexed
+// users must be kept in sync by the caller.
+type MemoryUsersSearch struct {
+	mutex sync.RWMutex
+	users map[string]models.User
+}
+
+func NewMemoryUsersSearch() *MemoryUsersSearch {
+	return &MemoryUsersSearch{
+		users: map[string]models.User{},
+	}
+}
+
+// Put indexes the given users, replacing the ones with the same key.
+func (s *MemoryUsersSearch) Put(users ...models.User) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, user := range users {
+		s.users[user.Key] = user
+	}
+}
+
+func (s *MemoryUsersSearch) Remove(keys ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(s.users, key)
+	}
+}
+
+func (s *MemoryUsersSearch) Search(words []string, offset, limit int) ([]models.User, int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	matches := rankedUsers{}
+
+	for _, user := range s.users {
+		if score := searchScore(&user, words); score > 0 {
+			matches = append(matches, rankedUser{user: user, score: score})
+		}
+	}
+
+	sort.Sort(matches)
+
+	users := []models.User{}
+
+	for i := offset; i < len(matches) && i < offset+limit; i++ {
+		users = append(users, matches[i].user)
+	}
+
+	return users, len(matches), nil
+}
+
+// searchScore mirrors the fulltext matching, a field word having to start with one of
+// the searched words, then the ArangoDB ranking.
+func searchScore(user *models.User, words []string) int {
+	fields := []string{
+		strings.ToLower(user.FirstName),
+		strings.ToLower(user.LastName),
+		strings.ToLower(user.Email),
+	}
+
+	matched := false
+	score := 0
+
+	for _, w := range words {
+		best := 0
+
+		for _, f := range fields {
+			for _, fw := range utils.SearchWords(f) {
+				if strings.HasPrefix(fw, w) {
+					matched = true
+				}
+			}
+
+			fieldScore := 0
+			switch {
+			case f == w:
+				fieldScore = 3
+			case strings.HasPrefix(f, w):
+				fieldScore = 2
+			case strings.Contains(f, w):
+				fieldScore = 1
+			}
+
+			if fieldScore > best {
+				best = fieldScore
+			}
+		}
+
+		score += best
+	}
+
+	if !matched {
+		return 0
+	}
+
+	return score
+}
+
+type rankedUser struct {
+	user  models.User
+	score int
+}
+
+type rankedUsers []rankedUser
+
+func (r rankedUsers) Len() int      { return len(r) }
+func (r rankedUsers) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+
+func (r rankedUsers) Less(i, j int) bool {
+	a, b := &r[i], &r[j]
+
+	switch {
+	case a.score != b.score:
+		return a.score > b.score
+	case a.user.LastName != b.user.LastName:
+		return a.user.LastName < b.user.LastName
+	case a.user.FirstName != b.user.FirstName:
+		return a.user.FirstName < b.user.FirstName
+	default:
+		return a.user.Key < b.user.Key
+	}
+}
@@ -0,0 +1,180 @@
+package stores_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/stores"
+)
+
+var (
+	filterNow     = time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	filterEarlier = filterNow.Add(-time.Hour)
+)
+
+func newFilterUsers(t *testing.T) *stores.MemoryUsers {
+	s := stores.NewMemoryUsers()
+
+	users := []models.User{
+		{Document: models.Document{Key: "1"}, FirstName: "Ann", LastName: "Smith", Email: "ann@x.io", Role: "USER", EmailVerified: true, EmailVerifiedAt: &filterNow},
+		{Document: models.Document{Key: "2"}, FirstName: "bob", LastName: "Jones", Email: "bob_1@x.io", Role: "ADMIN", TwoFactorLastCounter: 42},
+		{Document: models.Document{Key: "3"}, FirstName: "Carl", LastName: "Jones", Email: "carl%@y.io", Role: "USER", EmailVerifiedAt: &filterEarlier},
+		{Document: models.Document{Key: "4"}, LastName: "Doe", Email: "d@x.io", DeletedAt: &filterEarlier, DeletedBy: "2"},
+	}
+
+	if _, err := s.Insert(users); err != nil {
+		t.Fatalf("Could not insert the users: %v", err)
+	}
+
+	return s
+}
+
+// where parses a JSON where clause, as given in the filter query parameter.
+func where(t *testing.T, clause string) []map[string]interface{} {
+	parsed := []map[string]interface{}{}
+	if err := json.Unmarshal([]byte(clause), &parsed); err != nil {
+		t.Fatalf("Could not parse the where clause %s: %v", clause, err)
+	}
+	return parsed
+}
+
+func userKeys(users []models.User) []string {
+	keys := []string{}
+	for _, user := range users {
+		keys = append(keys, user.Key)
+	}
+	return keys
+}
+
+func TestMemoryUsersFind(t *testing.T) {
+	s := newFilterUsers(t)
+
+	earlier := filterEarlier.Format(time.RFC3339Nano)
+
+	tests := []struct {
+		name   string
+		where  string
+		sort   []string
+		offset int
+		limit  int
+		keys   []string
+	}{
+		{"no filter", ``, nil, 0, 0, []string{"1", "2", "3", "4"}},
+		{"equality", `[{"role":"USER"}]`, nil, 0, 0, []string{"1", "3"}},
+		{"implicit and", `[{"role":"USER","lastName":"Jones"}]`, nil, 0, 0, []string{"3"}},
+		{"null equality", `[{"firstName":null}]`, nil, 0, 0, []string{"4"}},
+		{"eq", `[{"role":{"eq":"ADMIN"}}]`, nil, 0, 0, []string{"2"}},
+		{"neq", `[{"role":{"neq":"USER"}}]`, nil, 0, 0, []string{"2", "4"}},
+		{"neq null", `[{"firstName":{"neq":null}}]`, nil, 0, 0, []string{"1", "2", "3"}},
+		{"lt", `[{"lastName":{"lt":"Jones"}}]`, nil, 0, 0, []string{"4"}},
+		{"lte", `[{"lastName":{"lte":"Jones"}}]`, nil, 0, 0, []string{"2", "3", "4"}},
+		{"gt", `[{"twoFactorLastCounter":{"gt":1}}]`, nil, 0, 0, []string{"2"}},
+		{"gte", `[{"lastName":{"gte":"Jones"}}]`, nil, 0, 0, []string{"1", "2", "3"}},
+		{"time range", `[{"emailVerifiedAt":{"gt":"` + earlier + `"}}]`, nil, 0, 0, []string{"1"}},
+		{"null is lower than strings", `[{"deletedAt":{"lt":"` + earlier + `"}}]`, nil, 0, 0, []string{"1", "2", "3"}},
+		{"in", `[{"role":{"in":["ADMIN",null]}}]`, nil, 0, 0, []string{"2", "4"}},
+		{"empty in", `[{"role":{"in":[]}}]`, nil, 0, 0, []string{}},
+		{"nin", `[{"role":{"nin":["ADMIN"]}}]`, nil, 0, 0, []string{"1", "3", "4"}},
+		{"like is case insensitive", `[{"email":{"like":"%X.IO"}}]`, nil, 0, 0, []string{"1", "2", "4"}},
+		{"like escaped underscore", `[{"email":{"like":"bob\\_%"}}]`, nil, 0, 0, []string{"2"}},
+		{"like escaped percent", `[{"email":{"like":"carl\\%%"}}]`, nil, 0, 0, []string{"3"}},
+		{"like single character", `[{"email":{"like":"_@x.io"}}]`, nil, 0, 0, []string{"4"}},
+		{"nlike", `[{"email":{"nlike":"%x.io"}}]`, nil, 0, 0, []string{"3"}},
+		{"and", `[{"and":[{"role":"USER"},{"emailVerified":true}]}]`, nil, 0, 0, []string{"1"}},
+		{"or", `[{"or":[{"role":"ADMIN"},{"lastName":"Doe"}]}]`, nil, 0, 0, []string{"2", "4"}},
+		{"not", `[{"not":{"role":"USER"}}]`, nil, 0, 0, []string{"2", "4"}},
+		{"nested", `[{"or":[{"and":[{"role":"USER"},{"not":{"emailVerified":true}}]},{"_key":"2"}]}]`, nil, 0, 0, []string{"2", "3"}},
+		{"empty and", `[{"and":[]}]`, nil, 0, 0, []string{"1", "2", "3", "4"}},
+		{"empty or", `[{"or":[]}]`, nil, 0, 0, []string{}},
+		{"sort", ``, []string{"lastName"}, 0, 0, []string{"4", "2", "3", "1"}},
+		{"sort descending", ``, []string{"lastName DESC"}, 0, 0, []string{"1", "2", "3", "4"}},
+		{"sort by several fields", ``, []string{"lastName", "_key DESC"}, 0, 0, []string{"4", "3", "2", "1"}},
+		{"null sorts first", ``, []string{"firstName"}, 0, 0, []string{"4", "1", "3", "2"}},
+		{"offset", ``, []string{"_key"}, 1, 0, []string{"2", "3", "4"}},
+		{"limit", ``, []string{"_key"}, 0, 2, []string{"1", "2"}},
+		{"offset and limit", `[{"role":{"neq":"ADMIN"}}]`, []string{"_key DESC"}, 1, 1, []string{"3"}},
+		{"offset past the end", ``, []string{"_key"}, 10, 2, []string{}},
+	}
+
+	for _, test := range tests {
+		f := &filters.Filter{Sort: test.sort, Offset: test.offset, Limit: test.limit}
+		if test.where != "" {
+			f.Where = where(t, test.where)
+		}
+
+		users, err := s.Find(f, nil)
+		if err != nil {
+			t.Errorf("%s: could not find the users: %v", test.name, err)
+			continue
+		}
+
+		// Without sort, the memory store returns the users in insertion order.
+		if keys := userKeys(users); !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("%s: expected the users %v, got %v.", test.name, test.keys, keys)
+		}
+	}
+}
+
+func TestMemoryUsersCount(t *testing.T) {
+	s := newFilterUsers(t)
+
+	// The count ignores the pagination.
+	count, err := s.Count(&filters.Filter{Where: where(t, `[{"role":"USER"}]`), Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatalf("Could not count the users: %v", err)
+	}
+
+	if count != 2 {
+		t.Errorf("Expected 2 users, got %d.", count)
+	}
+}
+
+func TestMemoryUsersFindInvalidFilter(t *testing.T) {
+	s := newFilterUsers(t)
+
+	tests := []struct {
+		name string
+		f    *filters.Filter
+	}{
+		{"unknown operator", &filters.Filter{Where: where(t, `[{"role":{"regex":"U.*"}}]`)}},
+		{"not without condition", &filters.Filter{Where: where(t, `[{"not":"USER"}]`)}},
+		{"or without conditions", &filters.Filter{Where: where(t, `[{"or":{"role":"USER"}}]`)}},
+		{"in without list", &filters.Filter{Where: where(t, `[{"role":{"in":"USER"}}]`)}},
+		{"invalid sort direction", &filters.Filter{Sort: []string{"lastName UP"}}},
+		{"empty sort", &filters.Filter{Sort: []string{""}}},
+	}
+
+	for _, test := range tests {
+		if _, err := s.Find(test.f, nil); !merry.Is(err, errs.InvalidFilter) {
+			t.Errorf("%s: expected an invalid filter error, got %v.", test.name, err)
+		}
+	}
+}
+
+func TestMemoryUsersFindFields(t *testing.T) {
+	s := newFilterUsers(t)
+
+	users, err := s.Find(&filters.Filter{Where: where(t, `[{"_key":"1"}]`)}, []string{"email"})
+	if err != nil {
+		t.Fatalf("Could not find the users: %v", err)
+	}
+
+	if len(users) != 1 {
+		t.Fatalf("Expected 1 user, got %d.", len(users))
+	}
+
+	user := users[0]
+	if user.Email != "ann@x.io" || user.Key != "1" || user.Rev == "" {
+		t.Errorf("Expected the email, key and revision to be kept, got %+v.", user)
+	}
+	if user.FirstName != "" || user.Role != "" || user.EmailVerifiedAt != nil {
+		t.Errorf("Expected the other fields to be dropped, got %+v.", user)
+	}
+}
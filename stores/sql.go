@@ -0,0 +1,159 @@
+package stores
+
+import (
+	"bytes"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/ansel1/merry"
+	// The PostgreSQL and SQLite drivers.
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/solher/snakepit-seed/utils"
+)
+
+const (
+	SQLDriverPostgres = "postgres"
+	SQLDriverSQLite   = "sqlite3"
+)
+
+// sqlKeySize is the length of the generated document keys, about 119 bits of randomness.
+const sqlKeySize = 20
+
+// SQL gathers the stores backing the API with a relational database, PostgreSQL or SQLite.
+// The schema is created by the SQL migrations of the database package.
+type SQL struct {
+	DB          *sql.DB
+	Driver      string
+	Users       *SQLUsers
+	Tokens      *SQLTokens
+	Revocations *SQLSessionRevocations
+	Audit       *SQLAudit
+}
+
+func NewSQL(driver, dsn string) (*SQL, error) {
+	if driver != SQLDriverPostgres && driver != SQLDriverSQLite {
+		return nil, merry.Errorf("unsupported SQL driver %q", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, merry.Here(err)
+	}
+
+	// SQLite only allows a single writer, and each connection to an in-memory database opens
+	// a new one: the queries are serialized on a single connection.
+	if driver == SQLDriverSQLite {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, merry.Here(err)
+	}
+
+	s := &SQL{DB: db, Driver: driver}
+	s.Users = &SQLUsers{db: s}
+	s.Tokens = &SQLTokens{db: s}
+	s.Revocations = &SQLSessionRevocations{db: s}
+	s.Audit = &SQLAudit{db: s}
+
+	return s, nil
+}
+
+func (s *SQL) Close() error {
+	return s.DB.Close()
+}
+
+// Rebind replaces the "?" bind parameters of the query by the ones of the driver.
+func (s *SQL) Rebind(query string) string {
+	if s.Driver != SQLDriverPostgres {
+		return query
+	}
+
+	var rebound bytes.Buffer
+	n := 0
+
+	for _, r := range query {
+		if r == '?' {
+			n++
+			rebound.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		rebound.WriteRune(r)
+	}
+
+	return rebound.String()
+}
+
+// Transaction runs fn in a transaction, committed if fn succeeds and rolled back otherwise.
+func (s *SQL) Transaction(fn func(tx *sql.Tx) error) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return merry.Here(err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
+
+// forUpdate returns the clause locking the selected rows until the end of the transaction.
+// SQLite needs none, its transactions being serialized.
+func (s *SQL) forUpdate() string {
+	if s.Driver == SQLDriverPostgres {
+		return " FOR UPDATE"
+	}
+
+	return ""
+}
+
+// limit returns the LIMIT and OFFSET clauses, binding their values. SQLite requires a limit
+// with an offset, -1 meaning no limit.
+func (s *SQL) limit(q *sqlQuery, limit, offset int) string {
+	clauses := []string{}
+
+	switch {
+	case limit > 0:
+		clauses = append(clauses, "LIMIT "+q.bind(limit))
+	case offset > 0 && s.Driver == SQLDriverSQLite:
+		clauses = append(clauses, "LIMIT -1")
+	}
+
+	if offset > 0 {
+		clauses = append(clauses, "OFFSET "+q.bind(offset))
+	}
+
+	return strings.Join(clauses, " ")
+}
+
+// nextKey returns a new random document key. The keys are generated by the app, and several
+// instances can share the database: unlike timestamps, random keys cannot collide in practice.
+func (s *SQL) nextKey() string {
+	return utils.GenToken(sqlKeySize)
+}
+
+// sqlQuery accumulates the arguments of a query built with "?" bind parameters.
+type sqlQuery struct {
+	args []interface{}
+}
+
+func (q *sqlQuery) bind(value interface{}) string {
+	q.args = append(q.args, value)
+	return "?"
+}
+
+// sqlRunner is implemented by both *sql.DB and *sql.Tx.
+type sqlRunner interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
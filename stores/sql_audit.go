@@ -0,0 +1,55 @@
+package stores
+
+import (
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+var auditTable = &sqlTable{
+	name:       "audit",
+	collection: "audit",
+	columns: []sqlColumn{
+		{field: "_key", name: "key", typ: sqlText},
+		{field: "action", name: "action", typ: sqlText},
+		{field: "actor", name: "actor", typ: sqlText},
+		{field: "target", name: "target", typ: sqlText},
+		{field: "before", name: "before", typ: sqlJSON},
+		{field: "after", name: "after", typ: sqlJSON},
+		{field: "requestId", name: "request_id", typ: sqlText},
+		{field: "ip", name: "ip", typ: sqlText},
+		{field: "userAgent", name: "user_agent", typ: sqlText},
+		{field: "createdAt", name: "created_at", typ: sqlTime},
+	},
+}
+
+// SQLAudit stores the audit entries in the audit table. The rows are only ever inserted.
+type SQLAudit struct {
+	db *SQL
+}
+
+func (s *SQLAudit) Insert(entry *models.AuditEntry) error {
+	doc, err := toDocument(entry)
+	if err != nil {
+		return err
+	}
+
+	doc["_key"] = s.db.nextKey()
+
+	return s.db.insert(s.db.DB, auditTable, []document{doc})
+}
+
+func (s *SQLAudit) Find(f *filters.Filter) ([]models.AuditEntry, error) {
+	docs, err := s.db.find(s.db.DB, auditTable, f, auditTable.columns, false)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.AuditEntry{}
+
+	if err := fromDocuments(docs, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
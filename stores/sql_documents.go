@@ -0,0 +1,316 @@
+package stores
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/errs"
+)
+
+type sqlType int
+
+const (
+	sqlText sqlType = iota
+	sqlBool
+	sqlInt
+	sqlTime
+	// sqlJSON columns store their value as JSON text and cannot be filtered.
+	sqlJSON
+)
+
+// sqlColumn maps a top level attribute of the documents to a column.
+type sqlColumn struct {
+	field string
+	name  string
+	typ   sqlType
+}
+
+// sqlTable stores the documents of a collection, one column per attribute. The missing
+// attributes are stored as NULL. The SQL stores convert the rows to documents, so that
+// the updates are applied like the in-memory stores do.
+type sqlTable struct {
+	name       string
+	collection string
+	columns    []sqlColumn
+}
+
+func (t *sqlTable) column(field string) (sqlColumn, bool) {
+	for _, c := range t.columns {
+		if c.field == field {
+			return c, true
+		}
+	}
+
+	return sqlColumn{}, false
+}
+
+// selection returns the columns of the given fields, plus the key and the revision.
+// The unknown fields are ignored, like the AQL KEEP does. All the columns are returned
+// when fields is nil.
+func (t *sqlTable) selection(fields []string) []sqlColumn {
+	if fields == nil {
+		return t.columns
+	}
+
+	selected := []sqlColumn{}
+
+	for _, c := range t.columns {
+		if c.field == "_key" || c.field == "_rev" {
+			selected = append(selected, c)
+			continue
+		}
+		for _, field := range fields {
+			if c.field == field {
+				selected = append(selected, c)
+				break
+			}
+		}
+	}
+
+	return selected
+}
+
+// list returns the quoted names of the columns, comma separated.
+func (t *sqlTable) list(columns []sqlColumn) string {
+	names := []string{}
+
+	for _, c := range columns {
+		names = append(names, quoteIdent(c.name))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// values returns the values of the document for all the columns of the table.
+func (t *sqlTable) values(doc document) ([]interface{}, error) {
+	values := []interface{}{}
+
+	for _, c := range t.columns {
+		value, err := c.toSQL(doc[c.field])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// scan reads the documents from rows selecting the given columns.
+func (t *sqlTable) scan(rows *sql.Rows, columns []sqlColumn) ([]document, error) {
+	defer rows.Close()
+
+	docs := []document{}
+
+	for rows.Next() {
+		raw := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range raw {
+			dest[i] = &raw[i]
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, merry.Here(err)
+		}
+
+		doc := document{}
+
+		for i, c := range columns {
+			value, err := c.fromSQL(raw[i])
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				doc[c.field] = value
+			}
+		}
+
+		if key, ok := doc["_key"].(string); ok {
+			doc["_id"] = t.collection + "/" + key
+		}
+
+		docs = append(docs, doc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	return docs, nil
+}
+
+// toSQL converts a JSON value of the attribute to the column type.
+func (c *sqlColumn) toSQL(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch c.typ {
+	case sqlText:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case sqlBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case sqlInt:
+		if n, ok := value.(float64); ok {
+			return int64(n), nil
+		}
+	case sqlTime:
+		if s, ok := value.(string); ok {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, merry.Here(err)
+			}
+			return t.UTC(), nil
+		}
+	case sqlJSON:
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, merry.Here(err)
+		}
+		return string(raw), nil
+	}
+
+	return nil, merry.Errorf("invalid value for the %s attribute", c.field)
+}
+
+// fromSQL converts a value scanned from the column to its JSON representation.
+func (c *sqlColumn) fromSQL(value interface{}) (interface{}, error) {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		if c.typ == sqlBool {
+			return value != 0, nil
+		}
+		return float64(value), nil
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano), nil
+	case string:
+		switch c.typ {
+		case sqlJSON:
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+				return nil, merry.Here(err)
+			}
+			return decoded, nil
+		case sqlTime:
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, merry.Here(err)
+			}
+			return t.UTC().Format(time.RFC3339Nano), nil
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+func quoteIdent(name string) string {
+	return `"` + name + `"`
+}
+
+// find returns the documents of the table matched by the filter, only reading the given columns.
+// The rows are locked until the end of the transaction when lock is set.
+func (s *SQL) find(db sqlRunner, t *sqlTable, f *filters.Filter, columns []sqlColumn, lock bool) ([]document, error) {
+	q := &sqlQuery{}
+
+	filter, err := s.sqlFilter(q, t, f)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + t.list(columns) + " FROM " + quoteIdent(t.name) + " " + filter
+	if lock {
+		query += s.forUpdate()
+	}
+
+	rows, err := db.Query(s.Rebind(query), q.args...)
+	if err != nil {
+		return nil, merry.Here(err)
+	}
+
+	return t.scan(rows, columns)
+}
+
+// findByKey returns the document with the given key, or NotFound.
+func (s *SQL) findByKey(db sqlRunner, t *sqlTable, key string, lock bool) (document, error) {
+	f := &filters.Filter{Where: []map[string]interface{}{{"_key": key}}}
+
+	docs, err := s.find(db, t, f, t.columns, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(docs) == 0 {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	return docs[0], nil
+}
+
+func (s *SQL) insert(db sqlRunner, t *sqlTable, docs []document) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(t.columns)), ", ")
+	query := "INSERT INTO " + quoteIdent(t.name) + " (" + t.list(t.columns) + ") VALUES (" + placeholders + ")"
+
+	for _, doc := range docs {
+		values, err := t.values(doc)
+		if err != nil {
+			return err
+		}
+
+		if _, err := db.Exec(s.Rebind(query), values...); err != nil {
+			return merry.Here(err)
+		}
+	}
+
+	return nil
+}
+
+// update writes all the columns of the documents, identified by their key.
+func (s *SQL) update(db sqlRunner, t *sqlTable, docs []document) error {
+	assignments := []string{}
+	for _, c := range t.columns {
+		assignments = append(assignments, quoteIdent(c.name)+" = ?")
+	}
+
+	query := "UPDATE " + quoteIdent(t.name) + " SET " + strings.Join(assignments, ", ") + " WHERE " + quoteIdent("key") + " = ?"
+
+	for _, doc := range docs {
+		values, err := t.values(doc)
+		if err != nil {
+			return err
+		}
+
+		if _, err := db.Exec(s.Rebind(query), append(values, doc["_key"])...); err != nil {
+			return merry.Here(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SQL) remove(db sqlRunner, t *sqlTable, docs []document) error {
+	query := "DELETE FROM " + quoteIdent(t.name) + " WHERE " + quoteIdent("key") + " = ?"
+
+	for _, doc := range docs {
+		if _, err := db.Exec(s.Rebind(query), doc["_key"]); err != nil {
+			return merry.Here(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package stores
+
+import (
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/errs"
+)
+
+// sqlFilter translates the filter into parameterized WHERE, ORDER BY, LIMIT and OFFSET clauses.
+// The conditions evaluate the missing attributes like AQL does, NULL being lower than any
+// other value, so that the results match the ArangoDB and in-memory stores ones.
+func (s *SQL) sqlFilter(q *sqlQuery, t *sqlTable, f *filters.Filter) (string, error) {
+	if f == nil {
+		f = &filters.Filter{}
+	}
+
+	clauses := []string{}
+
+	where, err := sqlWhere(q, t, f)
+	if err != nil {
+		return "", err
+	}
+
+	if where != "" {
+		clauses = append(clauses, where)
+	}
+
+	if len(f.Sort) > 0 {
+		order, err := sqlOrderBy(t, f.Sort)
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, order)
+	}
+
+	if limit := s.limit(q, f.Limit, f.Offset); limit != "" {
+		clauses = append(clauses, limit)
+	}
+
+	return strings.Join(clauses, " "), nil
+}
+
+// sqlWhere translates the where conditions of the filter, ignoring its sort and pagination.
+func sqlWhere(q *sqlQuery, t *sqlTable, f *filters.Filter) (string, error) {
+	if f == nil || len(f.Where) == 0 {
+		return "", nil
+	}
+
+	where, err := normalizeWhere(f.Where)
+	if err != nil {
+		return "", err
+	}
+
+	conds := []string{}
+
+	for _, cond := range where {
+		expr, err := sqlCondition(q, t, cond)
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, expr)
+	}
+
+	return "WHERE " + strings.Join(conds, " AND "), nil
+}
+
+func sqlCondition(q *sqlQuery, t *sqlTable, cond map[string]interface{}) (string, error) {
+	conds := []string{}
+
+	for field, value := range cond {
+		var (
+			expr string
+			err  error
+		)
+
+		switch field {
+		case "and", "or":
+			expr, err = sqlConditions(q, t, field, value)
+		case "not":
+			sub, isCond := value.(map[string]interface{})
+			if !isCond {
+				return "", merry.Here(errs.InvalidFilter).WithMessagef("%q expects a condition", field)
+			}
+			expr, err = sqlCondition(q, t, sub)
+			expr = "NOT " + expr
+		default:
+			c, ok := t.column(field)
+			if !ok || c.typ == sqlJSON {
+				return "", merry.Here(errs.InvalidFilter).WithMessagef("the %q field cannot be filtered", field)
+			}
+			ops, isOps := value.(map[string]interface{})
+			if !isOps {
+				ops = map[string]interface{}{"eq": value}
+			}
+			expr, err = sqlOperators(q, c, ops)
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		conds = append(conds, expr)
+	}
+
+	if len(conds) == 0 {
+		return "(1 = 1)", nil
+	}
+
+	return "(" + strings.Join(conds, " AND ") + ")", nil
+}
+
+func sqlConditions(q *sqlQuery, t *sqlTable, op string, value interface{}) (string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return "", merry.Here(errs.InvalidFilter).WithMessagef("%q expects a list of conditions", op)
+	}
+
+	conds := []string{}
+
+	for _, c := range list {
+		sub, ok := c.(map[string]interface{})
+		if !ok {
+			return "", merry.Here(errs.InvalidFilter).WithMessagef("%q expects a list of conditions", op)
+		}
+
+		expr, err := sqlCondition(q, t, sub)
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, expr)
+	}
+
+	if len(conds) == 0 {
+		if op == "and" {
+			return "(1 = 1)", nil
+		}
+		return "(1 = 0)", nil
+	}
+
+	return "(" + strings.Join(conds, " "+strings.ToUpper(op)+" ") + ")", nil
+}
+
+// sqlOperators translates the operators applied to a column. Each generated condition is either
+// true or false, never NULL, so that they can be negated.
+func sqlOperators(q *sqlQuery, c sqlColumn, ops map[string]interface{}) (string, error) {
+	conds := []string{}
+	col := quoteIdent(c.name)
+
+	for op, operand := range ops {
+		var expr string
+
+		switch op {
+		case "eq", "neq", "gt", "gte", "lt", "lte":
+			value, err := sqlOperand(c, op, operand)
+			if err != nil {
+				return "", err
+			}
+			expr = sqlComparison(q, col, op, value)
+		case "in", "nin":
+			list, ok := operand.([]interface{})
+			if !ok {
+				return "", merry.Here(errs.InvalidFilter).WithMessagef("%q expects a list", op)
+			}
+			eqs := []string{}
+			for _, item := range list {
+				value, err := sqlOperand(c, op, item)
+				if err != nil {
+					return "", err
+				}
+				eqs = append(eqs, sqlComparison(q, col, "eq", value))
+			}
+			expr = "(1 = 0)"
+			if len(eqs) > 0 {
+				expr = "(" + strings.Join(eqs, " OR ") + ")"
+			}
+			if op == "nin" {
+				expr = "NOT " + expr
+			}
+		case "like", "nlike":
+			pattern, ok := operand.(string)
+			if !ok || c.typ != sqlText {
+				return "", merry.Here(errs.InvalidFilter).WithMessagef("%q expects a string", op)
+			}
+			expr = "(LOWER(COALESCE(" + col + ", '')) LIKE LOWER(" + q.bind(pattern) + ") ESCAPE '\\')"
+			if op == "nlike" {
+				expr = "NOT " + expr
+			}
+		default:
+			return "", merry.Here(errs.InvalidFilter).WithMessagef("unknown operator %q", op)
+		}
+
+		conds = append(conds, expr)
+	}
+
+	if len(conds) == 0 {
+		return "(1 = 1)", nil
+	}
+
+	return "(" + strings.Join(conds, " AND ") + ")", nil
+}
+
+// sqlOperand converts the operand to the column type. Unlike AQL, the values of another type
+// than the attribute one cannot be compared.
+func sqlOperand(c sqlColumn, op string, operand interface{}) (interface{}, error) {
+	value, err := c.toSQL(operand)
+	if err != nil {
+		return nil, merry.Here(errs.InvalidFilter).WithMessagef("invalid %q operand for the %q field", op, c.field)
+	}
+
+	return value, nil
+}
+
+func sqlComparison(q *sqlQuery, col, op string, value interface{}) string {
+	if value == nil {
+		switch op {
+		case "eq", "lte":
+			return "(" + col + " IS NULL)"
+		case "neq", "gt":
+			return "(" + col + " IS NOT NULL)"
+		case "gte":
+			return "(1 = 1)"
+		default:
+			return "(1 = 0)"
+		}
+	}
+
+	switch op {
+	case "eq":
+		return "(" + col + " IS NOT NULL AND " + col + " = " + q.bind(value) + ")"
+	case "neq":
+		return "(" + col + " IS NULL OR " + col + " <> " + q.bind(value) + ")"
+	case "gt":
+		return "(" + col + " IS NOT NULL AND " + col + " > " + q.bind(value) + ")"
+	case "gte":
+		return "(" + col + " IS NOT NULL AND " + col + " >= " + q.bind(value) + ")"
+	case "lt":
+		return "(" + col + " IS NULL OR " + col + " < " + q.bind(value) + ")"
+	default:
+		return "(" + col + " IS NULL OR " + col + " <= " + q.bind(value) + ")"
+	}
+}
+
+// sqlOrderBy translates the sort clauses, "field" or "field DESC". The NULL values come first
+// in ascending order, like in AQL.
+func sqlOrderBy(t *sqlTable, clauses []string) (string, error) {
+	order := []string{}
+
+	for _, clause := range clauses {
+		fields := strings.Fields(clause)
+		if len(fields) == 0 || len(fields) > 2 {
+			return "", merry.Here(errs.InvalidFilter).WithMessagef("invalid sort clause %q", clause)
+		}
+
+		c, ok := t.column(fields[0])
+		if !ok || c.typ == sqlJSON {
+			return "", merry.Here(errs.InvalidFilter).WithMessagef("the %q field cannot be sorted", fields[0])
+		}
+		col := quoteIdent(c.name)
+
+		desc := false
+		if len(fields) == 2 {
+			switch strings.ToUpper(fields[1]) {
+			case "ASC":
+			case "DESC":
+				desc = true
+			default:
+				return "", merry.Here(errs.InvalidFilter).WithMessagef("invalid sort clause %q", clause)
+			}
+		}
+
+		if desc {
+			order = append(order, "("+col+" IS NULL)", col+" DESC")
+		} else {
+			order = append(order, "("+col+" IS NOT NULL)", col)
+		}
+	}
+
+	return "ORDER BY " + strings.Join(order, ", "), nil
+}
@@ -0,0 +1,112 @@
+package stores
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/ansel1/merry"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+// SQLSessionRevocations stores the pending session revocations in the session_revocations table.
+type SQLSessionRevocations struct {
+	db *SQL
+}
+
+func (s *SQLSessionRevocations) Insert(revocation *models.SessionRevocation) error {
+	ownerTokens, err := json.Marshal(revocation.OwnerTokens)
+	if err != nil {
+		return merry.Here(err)
+	}
+
+	var nextAttempt interface{}
+	if revocation.NextAttempt != nil {
+		nextAttempt = revocation.NextAttempt.UTC()
+	}
+
+	query := `INSERT INTO "session_revocations" ("key", "owner_tokens", "attempts", "next_attempt", "last_error")
+		VALUES (?, ?, ?, ?, ?)`
+
+	_, err = s.db.DB.Exec(
+		s.db.Rebind(query),
+		s.db.nextKey(),
+		string(ownerTokens),
+		revocation.Attempts,
+		nextAttempt,
+		revocation.LastError,
+	)
+	if err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
+
+// FindPending returns the revocations whose next attempt is due, the most overdue first.
+func (s *SQLSessionRevocations) FindPending(limit int) ([]models.SessionRevocation, error) {
+	query := `SELECT "key", "owner_tokens", "attempts", "next_attempt", "last_error" FROM "session_revocations"
+		WHERE "next_attempt" IS NULL OR "next_attempt" <= ?
+		ORDER BY ("next_attempt" IS NOT NULL), "next_attempt"
+		LIMIT ?`
+
+	rows, err := s.db.DB.Query(s.db.Rebind(query), time.Now().UTC(), limit)
+	if err != nil {
+		return nil, merry.Here(err)
+	}
+	defer rows.Close()
+
+	revocations := []models.SessionRevocation{}
+
+	for rows.Next() {
+		var (
+			revocation  models.SessionRevocation
+			ownerTokens string
+			nextAttempt *time.Time
+			lastError   sql.NullString
+		)
+
+		if err := rows.Scan(&revocation.Key, &ownerTokens, &revocation.Attempts, &nextAttempt, &lastError); err != nil {
+			return nil, merry.Here(err)
+		}
+
+		if err := json.Unmarshal([]byte(ownerTokens), &revocation.OwnerTokens); err != nil {
+			return nil, merry.Here(err)
+		}
+
+		if nextAttempt != nil {
+			next := nextAttempt.UTC()
+			revocation.NextAttempt = &next
+		}
+
+		revocation.ID = "sessionRevocations/" + revocation.Key
+		revocation.LastError = lastError.String
+
+		revocations = append(revocations, revocation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	return revocations, nil
+}
+
+func (s *SQLSessionRevocations) Reschedule(key string, attempts int, next time.Time, lastError string) error {
+	query := `UPDATE "session_revocations" SET "attempts" = ?, "next_attempt" = ?, "last_error" = ? WHERE "key" = ?`
+
+	if _, err := s.db.DB.Exec(s.db.Rebind(query), attempts, next.UTC(), lastError, key); err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
+
+func (s *SQLSessionRevocations) Delete(key string) error {
+	if _, err := s.db.DB.Exec(s.db.Rebind(`DELETE FROM "session_revocations" WHERE "key" = ?`), key); err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
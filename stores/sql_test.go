@@ -0,0 +1,58 @@
+package stores_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/solher/snakepit-seed/database"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/stores"
+)
+
+// TestSQLKeysAcrossInstances inserts users through two stores sharing a database, like
+// two instances of the app, the keys having to stay unique.
+func TestSQLKeysAcrossInstances(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snakepit-seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dsn := filepath.Join(dir, "users.db")
+
+	instances := []*stores.SQL{}
+	for i := 0; i < 2; i++ {
+		db, err := stores.NewSQL(stores.SQLDriverSQLite, dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		instances = append(instances, db)
+	}
+
+	if _, err := database.NewSQLManager(instances[0], nil).MigrateTo(0, false); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		users, err := instances[i%2].Users.Insert([]models.User{
+			{Email: fmt.Sprintf("a%d@localhost", i)},
+			{Email: fmt.Sprintf("b%d@localhost", i)},
+		})
+		if err != nil {
+			t.Fatalf("Could not insert the users %d: %v", i, err)
+		}
+
+		for _, user := range users {
+			if keys[user.Key] {
+				t.Fatalf("Expected unique keys, got %s twice.", user.Key)
+			}
+			keys[user.Key] = true
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package stores
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ansel1/merry"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+)
+
+// tokensTables maps the token collections to their tables.
+var tokensTables = map[string]string{
+	"resetTokens":         "reset_tokens",
+	"verificationTokens":  "verification_tokens",
+	"twoFactorChallenges": "two_factor_challenges",
+}
+
+// SQLTokens stores the hashed single-use tokens, one table per usage.
+type SQLTokens struct {
+	db *SQL
+}
+
+// Replace removes the tokens of the user in the collection, then stores the given one.
+func (s *SQLTokens) Replace(collection string, token *models.Token) error {
+	table, err := tokensTable(collection)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *sql.Tx) error {
+		query := "DELETE FROM " + table + ` WHERE "user_key" = ?`
+
+		if _, err := tx.Exec(s.db.Rebind(query), token.UserKey); err != nil {
+			return merry.Here(err)
+		}
+
+		var expiresAt interface{}
+		if token.ExpiresAt != nil {
+			expiresAt = token.ExpiresAt.UTC()
+		}
+
+		query = "INSERT INTO " + table + ` ("hash", "user_key", "email", "expires_at", "used") VALUES (?, ?, ?, ?, ?)`
+
+		if _, err := tx.Exec(s.db.Rebind(query), token.Hash, token.UserKey, token.Email, expiresAt, token.Used); err != nil {
+			return merry.Here(err)
+		}
+
+		return nil
+	})
+}
+
+// Delete removes the tokens of the user in the collection.
+func (s *SQLTokens) Delete(collection, userKey string) error {
+	table, err := tokensTable(collection)
+	if err != nil {
+		return err
+	}
+
+	query := "DELETE FROM " + table + ` WHERE "user_key" = ?`
+
+	if _, err := s.db.DB.Exec(s.db.Rebind(query), userKey); err != nil {
+		return merry.Here(err)
+	}
+
+	return nil
+}
+
+// Find returns the token with the given hash if it is still valid, without consuming it.
+func (s *SQLTokens) Find(collection, hash string) (*models.Token, error) {
+	table, err := tokensTable(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		token     = &models.Token{Hash: hash}
+		expiresAt time.Time
+		email     sql.NullString
+	)
+
+	query := `SELECT "user_key", "email", "expires_at" FROM ` + table + ` WHERE "hash" = ? AND "used" = ? AND "expires_at" > ?`
+
+	err = s.db.DB.QueryRow(s.db.Rebind(query), hash, false, time.Now().UTC()).Scan(&token.UserKey, &email, &expiresAt)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, merry.Here(errs.NotFound)
+	case err != nil:
+		return nil, merry.Here(err)
+	}
+
+	token.Email = email.String
+
+	expiresAt = expiresAt.UTC()
+	token.ExpiresAt = &expiresAt
+
+	return token, nil
+}
+
+// Consume atomically marks the token with the given hash as used if it is still valid, and returns it.
+func (s *SQLTokens) Consume(collection, hash string) (*models.Token, error) {
+	table, err := tokensTable(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &models.Token{Hash: hash, Used: true}
+
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		query := "UPDATE " + table + ` SET "used" = ? WHERE "hash" = ? AND "used" = ? AND "expires_at" > ?`
+
+		res, err := tx.Exec(s.db.Rebind(query), true, hash, false, time.Now().UTC())
+		if err != nil {
+			return merry.Here(err)
+		}
+
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return merry.Here(errs.NotFound)
+		}
+
+		var (
+			expiresAt time.Time
+			email     sql.NullString
+		)
+
+		query = `SELECT "user_key", "email", "expires_at" FROM ` + table + ` WHERE "hash" = ?`
+
+		if err := tx.QueryRow(s.db.Rebind(query), hash).Scan(&token.UserKey, &email, &expiresAt); err != nil {
+			return merry.Here(err)
+		}
+
+		token.Email = email.String
+
+		expiresAt = expiresAt.UTC()
+		token.ExpiresAt = &expiresAt
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func tokensTable(collection string) (string, error) {
+	table, ok := tokensTables[collection]
+	if !ok {
+		return "", merry.Errorf("unknown tokens collection %q", collection)
+	}
+
+	return quoteIdent(table), nil
+}
@@ -0,0 +1,295 @@
+package stores
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+var usersTable = &sqlTable{
+	name:       "users",
+	collection: "users",
+	columns: []sqlColumn{
+		{field: "_key", name: "key", typ: sqlText},
+		{field: "_rev", name: "rev", typ: sqlText},
+		{field: "firstName", name: "first_name", typ: sqlText},
+		{field: "lastName", name: "last_name", typ: sqlText},
+		{field: "email", name: "email", typ: sqlText},
+		{field: "emailVerified", name: "email_verified", typ: sqlBool},
+		{field: "emailVerifiedAt", name: "email_verified_at", typ: sqlTime},
+		{field: "ownerToken", name: "owner_token", typ: sqlText},
+		{field: "password", name: "password", typ: sqlText},
+		{field: "mustChangePassword", name: "must_change_password", typ: sqlBool},
+		{field: "role", name: "role", typ: sqlText},
+		{field: "twoFactorEnabled", name: "two_factor_enabled", typ: sqlBool},
+		{field: "twoFactorSecret", name: "two_factor_secret", typ: sqlText},
+		{field: "twoFactorPendingSecret", name: "two_factor_pending_secret", typ: sqlText},
+		{field: "twoFactorLastCounter", name: "two_factor_last_counter", typ: sqlInt},
+		{field: "recoveryCodes", name: "recovery_codes", typ: sqlJSON},
+		{field: "deletedAt", name: "deleted_at", typ: sqlTime},
+		{field: "deletedBy", name: "deleted_by", typ: sqlText},
+	},
+}
+
+// SQLUsers stores the users in the users table. The updates are applied in transactions,
+// the matched rows being locked, so that the revision checks cannot be raced.
+type SQLUsers struct {
+	db *SQL
+}
+
+// Find only returns the given fields of the users, plus their key and revision.
+// All the fields are returned when fields is nil.
+func (s *SQLUsers) Find(f *filters.Filter, fields []string) ([]models.User, error) {
+	docs, err := s.db.find(s.db.DB, usersTable, f, usersTable.selection(fields), false)
+	if err != nil {
+		return nil, err
+	}
+
+	return toUsers(docs)
+}
+
+// Count returns the number of users matched by the where conditions of the filter.
+func (s *SQLUsers) Count(f *filters.Filter) (int, error) {
+	q := &sqlQuery{}
+
+	where, err := sqlWhere(q, usersTable, f)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	row := s.db.DB.QueryRow(s.db.Rebind("SELECT COUNT(*) FROM "+quoteIdent(usersTable.name)+" "+where), q.args...)
+	if err := row.Scan(&count); err != nil {
+		return 0, merry.Here(err)
+	}
+
+	return count, nil
+}
+
+func (s *SQLUsers) FindByEmail(email string) (*models.User, error) {
+	f := &filters.Filter{Where: []map[string]interface{}{{"email": email}}, Limit: 1}
+
+	users, err := s.Find(f, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return nil, merry.Here(errs.NotFound)
+	}
+
+	return &users[0], nil
+}
+
+func (s *SQLUsers) Insert(users []models.User) ([]models.User, error) {
+	docs := []document{}
+
+	for _, user := range users {
+		doc, err := toDocument(&user)
+		if err != nil {
+			return nil, err
+		}
+
+		key, _ := doc["_key"].(string)
+		if key == "" {
+			key = s.db.nextKey()
+		}
+
+		docs = append(docs, stampUser(doc, key))
+	}
+
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		return s.db.insert(tx, usersTable, docs)
+	})
+	if err != nil {
+		return nil, usersError(err)
+	}
+
+	return toUsers(docs)
+}
+
+// Update merges the user into the users matched by the filter whose revision is one of revs,
+// unless revs is nil. Changing the email resets its verification.
+func (s *SQLUsers) Update(f *filters.Filter, revs []string, user *models.User) ([]models.User, error) {
+	patch, err := toDocument(user)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := []document{}
+
+	err = s.db.Transaction(func(tx *sql.Tx) error {
+		matched, err := s.db.find(tx, usersTable, f, usersTable.columns, true)
+		if err != nil {
+			return err
+		}
+
+		for _, doc := range matched {
+			if !hasRevision(doc, revs) {
+				continue
+			}
+
+			update := document{}
+			if email, ok := patch["email"]; ok && compareValues(email, doc["email"]) != 0 {
+				update["emailVerified"] = false
+				update["emailVerifiedAt"] = nil
+			}
+
+			docs = append(docs, stampUser(doc.merge(update, true).merge(patch, true), doc["_key"].(string)))
+		}
+
+		return s.db.update(tx, usersTable, docs)
+	})
+	if err != nil {
+		return nil, usersError(err)
+	}
+
+	return toUsers(docs)
+}
+
+// Replace replaces the user, preserving its protected fields unless given. NotFound is returned
+// when no user has the key with one of the given revisions.
+func (s *SQLUsers) Replace(key string, revs []string, user *models.User) (*models.User, error) {
+	replacement, err := toDocument(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.write(key, revs, func(doc document) document {
+		next := doc.keep(protectedUserFields...)
+		if compareValues(replacement["email"], doc["email"]) != 0 {
+			next["emailVerified"] = false
+			next["emailVerifiedAt"] = nil
+		}
+		for name, value := range replacement {
+			next[name] = value
+		}
+		return next
+	})
+}
+
+// Patch applies a merge patch to the user, null values removing the fields. NotFound is returned
+// when no user has the key with one of the given revisions.
+func (s *SQLUsers) Patch(key string, revs []string, patch map[string]interface{}) (*models.User, error) {
+	normalized, err := toDocument(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.write(key, revs, func(doc document) document {
+		update := document{}
+		if email, ok := normalized["email"]; ok && compareValues(email, doc["email"]) != 0 {
+			update["emailVerified"] = nil
+			update["emailVerifiedAt"] = nil
+		}
+		return doc.merge(update, false).merge(normalized, false)
+	})
+}
+
+func (s *SQLUsers) Delete(f *filters.Filter) ([]models.User, error) {
+	docs := []document{}
+
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		var err error
+
+		docs, err = s.db.find(tx, usersTable, f, usersTable.columns, true)
+		if err != nil {
+			return err
+		}
+
+		return s.db.remove(tx, usersTable, docs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toUsers(docs)
+}
+
+// Search narrows the users to the ones containing one of the words in SQL, then ranks them
+// like the ArangoDB fulltext search.
+func (s *SQLUsers) Search(words []string, offset, limit int) ([]models.User, int, error) {
+	if len(words) == 0 {
+		return []models.User{}, 0, nil
+	}
+
+	conds := []interface{}{}
+	for _, w := range words {
+		pattern := "%" + escapeLike(w) + "%"
+		for _, field := range []string{"firstName", "lastName", "email"} {
+			conds = append(conds, map[string]interface{}{field: map[string]interface{}{"like": pattern}})
+		}
+	}
+
+	f := &filters.Filter{Where: []map[string]interface{}{{"or": conds}, {"deletedAt": nil}}}
+
+	candidates, err := s.Find(f, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	search := NewMemoryUsersSearch()
+	search.Put(candidates...)
+
+	return search.Search(words, offset, limit)
+}
+
+// write replaces the user with the document returned by change in a transaction.
+func (s *SQLUsers) write(key string, revs []string, change func(doc document) document) (*models.User, error) {
+	var written document
+
+	err := s.db.Transaction(func(tx *sql.Tx) error {
+		doc, err := s.db.findByKey(tx, usersTable, key, true)
+		if err != nil {
+			return err
+		}
+
+		if !hasRevision(doc, revs) {
+			return merry.Here(errs.NotFound)
+		}
+
+		written = stampUser(change(doc), key)
+
+		return s.db.update(tx, usersTable, []document{written})
+	})
+	if err != nil {
+		return nil, usersError(err)
+	}
+
+	users, err := toUsers([]document{written})
+	if err != nil {
+		return nil, err
+	}
+
+	return &users[0], nil
+}
+
+// stampUser sets the system attributes of the document, with a new revision.
+func stampUser(doc document, key string) document {
+	stamped := doc.merge(nil, true)
+	stamped["_key"] = key
+	stamped["_id"] = "users/" + key
+	stamped["_rev"] = utils.GenToken(12)
+
+	return stamped
+}
+
+// usersError reports the unique constraint violations as taken emails.
+func usersError(err error) error {
+	if utils.IsSQLUniqueViolation(err) {
+		return merry.Here(errs.EmailTaken)
+	}
+
+	return err
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,30 @@
+package utils
+
+import "strings"
+
+// ETag returns the strong entity tag of a document revision.
+func ETag(rev string) string {
+	return `"` + rev + `"`
+}
+
+// ParseIfMatch returns the revisions listed by an If-Match header.
+// Nil is returned when the header is empty or is "*", meaning any revision matches.
+// Weak tags are ignored as If-Match requires a strong comparison.
+func ParseIfMatch(header string) []string {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil
+	}
+
+	revs := []string{}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		revs = append(revs, strings.Trim(tag, `"`))
+	}
+
+	return revs
+}
@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+)
+
+type (
+	// JWK is a JSON Web Key as defined by RFC 7517. Only the "oct", "RSA" and "EC" (P-256) types are supported.
+	JWK struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid,omitempty"`
+		Alg string `json:"alg,omitempty"`
+		K   string `json:"k,omitempty"`
+		N   string `json:"n,omitempty"`
+		E   string `json:"e,omitempty"`
+		Crv string `json:"crv,omitempty"`
+		X   string `json:"x,omitempty"`
+		Y   string `json:"y,omitempty"`
+	}
+
+	// JWTKey is a parsed verification key.
+	JWTKey struct {
+		ID  string
+		Alg string
+		Key interface{}
+	}
+
+	JWTClaims map[string]interface{}
+)
+
+// ParseJWKS parses a JSON Web Key Set document.
+func ParseJWKS(data []byte) ([]JWTKey, error) {
+	set := &struct {
+		Keys []JWK `json:"keys"`
+	}{}
+
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	keys := []JWTKey{}
+
+	for _, jwk := range set.Keys {
+		key, err := parseJWK(&jwk)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, nil
+}
+
+func parseJWK(jwk *JWK) (*JWTKey, error) {
+	key := &JWTKey{ID: jwk.Kid, Alg: jwk.Alg}
+
+	switch jwk.Kty {
+	case "oct":
+		k, err := decodeSegment(jwk.K)
+		if err != nil {
+			return nil, err
+		}
+		key.Key = k
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		key.Key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, merry.Errorf("unsupported JWK curve: %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key.Key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	default:
+		return nil, merry.Errorf("unsupported JWK type: %s", jwk.Kty)
+	}
+
+	return key, nil
+}
+
+// VerifyJWT checks the signature of a compact serialized JWS and returns its claims.
+// The key is chosen by the "kid" header among the given keys and must be of the type
+// expected by the HS256, RS256 or ES256 algorithm announced by the token.
+func VerifyJWT(token string, keys []JWTKey) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, merry.New("malformed JWT")
+	}
+
+	rawHeader, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	header := &struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+
+	if err := json.Unmarshal(rawHeader, header); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := findJWTKey(keys, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch header.Alg {
+	case "HS256":
+		secret, ok := key.Key.([]byte)
+		if !ok {
+			return nil, merry.New("HS256 requires a symmetric key")
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return nil, merry.New("invalid JWT signature")
+		}
+	case "RS256":
+		pub, ok := key.Key.(*rsa.PublicKey)
+		if !ok {
+			return nil, merry.New("RS256 requires a RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], signature); err != nil {
+			return nil, merry.New("invalid JWT signature")
+		}
+	case "ES256":
+		pub, ok := key.Key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, merry.New("ES256 requires an EC key")
+		}
+		if len(signature) != 64 {
+			return nil, merry.New("invalid JWT signature")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, sum[:], r, s) {
+			return nil, merry.New("invalid JWT signature")
+		}
+	default:
+		return nil, merry.Errorf("unsupported JWT algorithm: %s", header.Alg)
+	}
+
+	rawClaims, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	claims := JWTClaims{}
+
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return nil, merry.Here(err)
+	}
+
+	return claims, nil
+}
+
+func findJWTKey(keys []JWTKey, kid, alg string) (*JWTKey, error) {
+	for i := range keys {
+		if kid != "" && keys[i].ID != kid {
+			continue
+		}
+		if keys[i].Alg != "" && keys[i].Alg != alg {
+			continue
+		}
+		if !keyFitsAlg(keys[i].Key, alg) {
+			continue
+		}
+		return &keys[i], nil
+	}
+
+	return nil, merry.Errorf("no %s JWT key found for kid %q", alg, kid)
+}
+
+func keyFitsAlg(key interface{}, alg string) bool {
+	switch key.(type) {
+	case []byte:
+		return alg == "HS256"
+	case *rsa.PublicKey:
+		return alg == "RS256"
+	case *ecdsa.PublicKey:
+		return alg == "ES256"
+	default:
+		return false
+	}
+}
+
+// Validate checks the exp, nbf, iss and aud claims. The issuer and audience checks are skipped
+// when empty. The expiration claim is mandatory.
+func (c JWTClaims) Validate(issuer, audience string, now time.Time, leeway time.Duration) error {
+	exp, ok := c.Time("exp")
+	if !ok {
+		return merry.New("missing JWT exp claim")
+	}
+
+	if now.Add(-leeway).After(exp) {
+		return merry.New("expired JWT")
+	}
+
+	if nbf, ok := c.Time("nbf"); ok && now.Add(leeway).Before(nbf) {
+		return merry.New("JWT not valid yet")
+	}
+
+	if issuer != "" && c.String("iss") != issuer {
+		return merry.New("invalid JWT issuer")
+	}
+
+	if audience != "" && !c.hasAudience(audience) {
+		return merry.New("invalid JWT audience")
+	}
+
+	return nil
+}
+
+// Get returns the claim at the given dot separated path, allowing nested claims like "realm_access.roles".
+func (c JWTClaims) Get(path string) interface{} {
+	var value interface{} = map[string]interface{}(c)
+
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	return value
+}
+
+func (c JWTClaims) String(path string) string {
+	s, _ := c.Get(path).(string)
+	return s
+}
+
+// Strings returns the claim as a list, whether it is a single string or an array.
+func (c JWTClaims) Strings(path string) []string {
+	switch value := c.Get(path).(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		strs := []string{}
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	default:
+		return nil
+	}
+}
+
+func (c JWTClaims) Time(path string) (time.Time, bool) {
+	seconds, ok := c.Get(path).(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(seconds), 0).UTC(), true
+}
+
+func (c JWTClaims) hasAudience(audience string) bool {
+	for _, aud := range c.Strings("aud") {
+		if aud == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodeSegment(seg string) ([]byte, error) {
+	if pad := len(seg) % 4; pad != 0 {
+		seg += strings.Repeat("=", 4-pad)
+	}
+
+	data, err := base64.URLEncoding.DecodeString(seg)
+	if err != nil {
+		return nil, merry.Here(err)
+	}
+
+	return data, nil
+}
+
+func decodeBigInt(seg string) (*big.Int, error) {
+	data, err := decodeSegment(seg)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
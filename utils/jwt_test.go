@@ -0,0 +1,172 @@
+package utils_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/solher/snakepit-seed/utils"
+)
+
+var hmacSecret = []byte("jwt-test-secret")
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Could not marshal the segment: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(t *testing.T, secret []byte, header, claims map[string]interface{}) string {
+	input := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, header, claims map[string]interface{}) string {
+	input := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	sum := sha256.Sum256([]byte(input))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatalf("Could not sign the token: %v", err)
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func parseJWKS(t *testing.T, keys ...map[string]interface{}) []utils.JWTKey {
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatalf("Could not marshal the JWKS: %v", err)
+	}
+
+	parsed, err := utils.ParseJWKS(data)
+	if err != nil {
+		t.Fatalf("Could not parse the JWKS: %v", err)
+	}
+
+	return parsed
+}
+
+func rsaJWK(key *rsa.PrivateKey) map[string]interface{} {
+	return map[string]interface{}{
+		"kty": "RSA",
+		"kid": "rsa",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func TestVerifyJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Could not generate the RSA key: %v", err)
+	}
+
+	keys := parseJWKS(t,
+		map[string]interface{}{"kty": "oct", "kid": "hmac", "k": base64.RawURLEncoding.EncodeToString(hmacSecret)},
+		rsaJWK(rsaKey),
+	)
+	claims := map[string]interface{}{"sub": "1"}
+
+	if _, err := utils.VerifyJWT(signHS256(t, hmacSecret, map[string]interface{}{"alg": "HS256", "kid": "hmac"}, claims), keys); err != nil {
+		t.Errorf("Expected the HS256 token to be valid, got %v.", err)
+	}
+
+	if _, err := utils.VerifyJWT(signRS256(t, rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, claims), keys); err != nil {
+		t.Errorf("Expected the RS256 token to be valid, got %v.", err)
+	}
+
+	tampered := signHS256(t, hmacSecret, map[string]interface{}{"alg": "HS256", "kid": "hmac"}, claims)
+	tampered = tampered[:strings.LastIndex(tampered, ".")] + "." + base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	if _, err := utils.VerifyJWT(tampered, keys); err == nil {
+		t.Error("Expected a token with an invalid signature to be refused.")
+	}
+}
+
+func TestVerifyJWTAlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Could not generate the RSA key: %v", err)
+	}
+
+	rsaOnly := parseJWKS(t, rsaJWK(rsaKey))
+	claims := map[string]interface{}{"sub": "1"}
+
+	// The public key is known to the attacker, who uses it as HMAC secret.
+	forged := signHS256(t, rsaKey.N.Bytes(), map[string]interface{}{"alg": "HS256", "kid": "rsa"}, claims)
+	if _, err := utils.VerifyJWT(forged, rsaOnly); err == nil {
+		t.Error("Expected a HS256 token to be refused with a RSA key.")
+	}
+
+	none := encodeSegment(t, map[string]interface{}{"alg": "none"}) + "." + encodeSegment(t, claims) + "."
+	if _, err := utils.VerifyJWT(none, rsaOnly); err == nil {
+		t.Error("Expected an unsigned token to be refused.")
+	}
+
+	// A key announcing its algorithm is not used for another one.
+	pinned := parseJWKS(t, map[string]interface{}{
+		"kty": "oct",
+		"kid": "hmac",
+		"alg": "HS512",
+		"k":   base64.RawURLEncoding.EncodeToString(hmacSecret),
+	})
+	if _, err := utils.VerifyJWT(signHS256(t, hmacSecret, map[string]interface{}{"alg": "HS256", "kid": "hmac"}, claims), pinned); err == nil {
+		t.Error("Expected a key to be refused for another algorithm than its own.")
+	}
+}
+
+func TestJWTClaimsValidate(t *testing.T) {
+	now := time.Unix(1500000000, 0).UTC()
+	leeway := 30 * time.Second
+
+	at := func(d time.Duration) float64 {
+		return float64(now.Add(d).Unix())
+	}
+
+	tests := []struct {
+		name     string
+		claims   utils.JWTClaims
+		audience string
+		valid    bool
+	}{
+		{"valid", utils.JWTClaims{"exp": at(time.Minute)}, "", true},
+		{"missing exp", utils.JWTClaims{}, "", false},
+		{"expired within leeway", utils.JWTClaims{"exp": at(-10 * time.Second)}, "", true},
+		{"expired beyond leeway", utils.JWTClaims{"exp": at(-time.Minute)}, "", false},
+		{"not valid yet within leeway", utils.JWTClaims{"exp": at(time.Hour), "nbf": at(10 * time.Second)}, "", true},
+		{"not valid yet beyond leeway", utils.JWTClaims{"exp": at(time.Hour), "nbf": at(time.Minute)}, "", false},
+		{"audience string", utils.JWTClaims{"exp": at(time.Minute), "aud": "api"}, "api", true},
+		{"audience list", utils.JWTClaims{"exp": at(time.Minute), "aud": []interface{}{"web", "api"}}, "api", true},
+		{"other audience", utils.JWTClaims{"exp": at(time.Minute), "aud": []interface{}{"web"}}, "api", false},
+		{"missing audience", utils.JWTClaims{"exp": at(time.Minute)}, "api", false},
+	}
+
+	for _, test := range tests {
+		err := test.claims.Validate("", test.audience, now, leeway)
+		if test.valid && err != nil {
+			t.Errorf("%s: expected the claims to be valid, got %v.", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: expected the claims to be refused.", test.name)
+		}
+	}
+
+	issued := utils.JWTClaims{"exp": at(time.Minute), "iss": "https://idp"}
+	if err := issued.Validate("https://other", "", now, leeway); err == nil {
+		t.Error("Expected another issuer to be refused.")
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/snakepit-seed/errs"
+)
+
+// Cursor is the position of a page boundary: the sort value and the key of the
+// boundary document, the key breaking the ties between equal sort values.
+type Cursor struct {
+	Sort   string      `json:"s"`
+	Desc   bool        `json:"d,omitempty"`
+	Value  interface{} `json:"v"`
+	Key    string      `json:"k"`
+	Before bool        `json:"b,omitempty"`
+}
+
+// SearchWords splits a search query in lower case words, the same way the fulltext indexes do.
+func SearchWords(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// EncodeCursor returns the opaque representation of the cursor sent to the clients.
+func EncodeCursor(c *Cursor) string {
+	m, _ := json.Marshal(c)
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(m), "=")
+}
+
+func DecodeCursor(cursor string) (*Cursor, error) {
+	if pad := len(cursor) % 4; pad != 0 {
+		cursor += strings.Repeat("=", 4-pad)
+	}
+
+	m, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, merry.Here(errs.InvalidCursor)
+	}
+
+	c := &Cursor{}
+
+	if err := json.Unmarshal(m, c); err != nil || c.Sort == "" || c.Key == "" {
+		return nil, merry.Here(errs.InvalidCursor)
+	}
+
+	return c, nil
+}
+
+// PageLinks returns a RFC 5988 Link header value pointing to the next and previous pages.
+// The links are built from the current URL, only setting the given page parameter.
+func PageLinks(u *url.URL, param, next, prev string) string {
+	links := []string{}
+
+	link := func(value, rel string) {
+		v := u.Query()
+		v.Set(param, value)
+
+		page := *u
+		page.RawQuery = v.Encode()
+
+		links = append(links, `<`+page.RequestURI()+`>; rel="`+rel+`"`)
+	}
+
+	if next != "" {
+		link(next, "next")
+	}
+	if prev != "" {
+		link(prev, "prev")
+	}
+
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,69 @@
+package utils_test
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/ansel1/merry"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/utils"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursors := []*utils.Cursor{
+		{Sort: "_key", Value: "12", Key: "12"},
+		{Sort: "lastName", Desc: true, Value: "Doe", Key: "3", Before: true},
+		{Sort: "twoFactorLastCounter", Value: float64(42), Key: "7"},
+		{Sort: "firstName", Value: nil, Key: "9"},
+	}
+
+	for _, c := range cursors {
+		encoded := utils.EncodeCursor(c)
+
+		// The cursors are sent in query parameters, without padding.
+		if url.QueryEscape(encoded) != encoded {
+			t.Errorf("Expected the cursor %q to be URL safe.", encoded)
+		}
+
+		decoded, err := utils.DecodeCursor(encoded)
+		if err != nil {
+			t.Errorf("Could not decode the cursor %+v: %v", c, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(decoded, c) {
+			t.Errorf("Expected the cursor %+v, got %+v.", c, decoded)
+		}
+	}
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	cursors := map[string]string{
+		"not base64":    "not a cursor!",
+		"not an object": "WzFd",
+		"missing sort":  "eyJ2IjoiYSIsImsiOiIxIn0",
+		"missing key":   "eyJzIjoibGFzdE5hbWUiLCJ2IjoiYSJ9",
+	}
+
+	for name, cursor := range cursors {
+		if _, err := utils.DecodeCursor(cursor); !merry.Is(err, errs.InvalidCursor) {
+			t.Errorf("%s: expected an invalid cursor error, got %v.", name, err)
+		}
+	}
+}
+
+func TestPageLinks(t *testing.T) {
+	u, _ := url.Parse("http://localhost/users?filter=%7B%7D&cursor=old")
+
+	links := utils.PageLinks(u, "cursor", "next", "prev")
+	expected := `</users?cursor=next&filter=%7B%7D>; rel="next", </users?cursor=prev&filter=%7B%7D>; rel="prev"`
+	if links != expected {
+		t.Errorf("Expected the links %s, got %s.", expected, links)
+	}
+
+	if links := utils.PageLinks(u, "cursor", "", ""); links != "" {
+		t.Errorf("Expected no link without adjacent pages, got %s.", links)
+	}
+}
@@ -0,0 +1,76 @@
+package utils_test
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/solher/snakepit-seed/utils"
+)
+
+// rfc6238Secret is the SHA1 seed of the RFC 6238 test vectors, base32 encoded.
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// The RFC 6238 appendix B vectors are 8 digits long, the 6 digits codes being their last digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCode(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		code, err := utils.TOTPCode(rfc6238Secret, utils.TOTPCounter(time.Unix(vector.unix, 0)))
+		if err != nil {
+			t.Fatalf("Could not compute the code at %d: %v", vector.unix, err)
+		}
+
+		if code != vector.code {
+			t.Errorf("Expected the code %s at %d, got %s.", vector.code, vector.unix, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	counter := utils.TOTPCounter(at)
+
+	if matched, ok := utils.ValidateTOTP(rfc6238Secret, "050471", at, 0); !ok || matched != counter {
+		t.Errorf("Expected the current code to match the counter %d, got %d and %v.", counter, matched, ok)
+	}
+
+	// The code of the previous step, valid at 1111111109.
+	if _, ok := utils.ValidateTOTP(rfc6238Secret, "081804", at, 0); ok {
+		t.Error("Expected the code of the previous step to be refused without skew.")
+	}
+
+	if matched, ok := utils.ValidateTOTP(rfc6238Secret, "081804", at, 1); !ok || matched != counter-1 {
+		t.Errorf("Expected the code of the previous step to match the counter %d with skew, got %d and %v.", counter-1, matched, ok)
+	}
+
+	if _, ok := utils.ValidateTOTP(rfc6238Secret, "50471", at, 1); ok {
+		t.Error("Expected a code of the wrong length to be refused.")
+	}
+}
+
+func TestGenTOTPSecret(t *testing.T) {
+	secret, err := utils.GenTOTPSecret()
+	if err != nil {
+		t.Fatalf("Could not generate the secret: %v", err)
+	}
+
+	// 160 bits encode to 32 base32 characters, without padding.
+	if len(secret) != 32 {
+		t.Errorf("Expected a 32 characters secret, got %q.", secret)
+	}
+
+	if _, err := utils.TOTPCode(secret, 0); err != nil {
+		t.Errorf("Expected the secret to be usable, got %v.", err)
+	}
+}
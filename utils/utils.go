@@ -2,12 +2,23 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
 
 	"github.com/ansel1/merry"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 	"github.com/solher/arangolite/filters"
 	"github.com/solher/snakepit-seed/errs"
 )
 
+// pqUniqueViolation is the PostgreSQL error code of the unique constraint violations.
+const pqUniqueViolation = "23505"
+
 func FilterToAQL(tmpVar string, f *filters.Filter) (string, error) {
 	filter, err := filters.ToAQL(tmpVar, f)
 	if err != nil {
@@ -17,6 +28,19 @@ func FilterToAQL(tmpVar string, f *filters.Filter) (string, error) {
 	return filter, nil
 }
 
+// ParseFields parses a comma separated list of fields. Nil is returned when the list is empty.
+func ParseFields(list string) []string {
+	var fields []string
+
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
 func GenToken(strSize int) string {
 	dictionary := "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
 
@@ -29,3 +53,124 @@ func GenToken(strSize int) string {
 
 	return string(bytes)
 }
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsUniqueViolation reports the unique constraint violations of ArangoDB (error 1210).
+// Arangolite only returns the error message of the server, so the message of the error is matched.
+func IsUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return strings.Contains(err.Error(), "unique constraint violated")
+}
+
+// IsSQLUniqueViolation reports the unique and primary key constraint violations of PostgreSQL
+// and SQLite, from the error codes returned by their drivers.
+func IsSQLUniqueViolation(err error) bool {
+	switch err := merry.Unwrap(err).(type) {
+	case *pq.Error:
+		return err.Code == pqUniqueViolation
+	case sqlite3.Error:
+		return err.ExtendedCode == sqlite3.ErrConstraintUnique || err.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	default:
+		return false
+	}
+}
+
+func IsCollectionNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := err.Error()
+
+	return strings.Contains(msg, "collection not found") || strings.Contains(msg, "collection or view not found")
+}
+
+func IsDuplicateName(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return strings.Contains(err.Error(), "duplicate name")
+}
+
+// ClientIP returns the IP of the client. The forwarding headers are only read when the request
+// comes from one of the trusted proxies, in which case the rightmost untrusted hop of
+// "X-Forwarded-For" is returned, as the hops on its left can be forged by the client.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrusted(host, trusted) {
+		return host
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if !isTrusted(hop, trusted) || i == 0 {
+				return hop
+			}
+		}
+	}
+
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return strings.TrimSpace(realIP)
+	}
+
+	return host
+}
+
+// ParseTrustedProxies parses a list of IPs and CIDR ranges.
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, merry.Errorf("invalid trusted proxy %q", proxy)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+
+		_, n, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, merry.Prependf(err, "invalid trusted proxy %q", proxy)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+func isTrusted(host string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
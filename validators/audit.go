@@ -0,0 +1,48 @@
+package validators
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/solher/arangolite/filters"
+	"github.com/solher/snakepit"
+)
+
+var auditFilters = &FilterPolicy{
+	Fields: map[string][]string{
+		"_key":      equalityOperators,
+		"action":    textOperators,
+		"actor":     equalityOperators,
+		"target":    equalityOperators,
+		"requestId": equalityOperators,
+		"ip":        textOperators,
+		"userAgent": textOperators,
+		"createdAt": comparisonOperators,
+	},
+	Sortable: map[string]bool{
+		"action":    true,
+		"actor":     true,
+		"target":    true,
+		"ip":        true,
+		"createdAt": true,
+	},
+}
+
+type (
+	Audit struct {
+		snakepit.Validator
+	}
+)
+
+func NewAudit(l *logrus.Entry) *Audit {
+	return &Audit{
+		Validator: *snakepit.NewValidator(l),
+	}
+}
+
+func (v *Audit) Filter(f *filters.Filter) (*filters.Filter, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return auditFilters.validate(f)
+}
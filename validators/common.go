@@ -0,0 +1,7 @@
+package validators
+
+import "github.com/solher/snakepit-seed/models"
+
+type UsersFinder interface {
+	FindByEmail(email string) (*models.User, error)
+}
@@ -0,0 +1,55 @@
+package validators
+
+// commonPasswords holds some of the most used passwords according to the public leaks.
+// The lookup is done on the lowercased password.
+var commonPasswords = map[string]bool{
+	"123456": true, "password": true, "12345678": true, "qwerty": true, "123456789": true,
+	"12345": true, "1234": true, "111111": true, "1234567": true, "dragon": true, "123123": true,
+	"baseball": true, "abc123": true, "football": true, "monkey": true, "letmein": true,
+	"696969": true, "shadow": true, "master": true, "666666": true, "qwertyuiop": true,
+	"123321": true, "mustang": true, "1234567890": true, "michael": true, "654321": true,
+	"superman": true, "1qaz2wsx": true, "7777777": true, "121212": true, "000000": true,
+	"qazwsx": true, "123qwe": true, "killer": true, "trustno1": true, "jordan": true,
+	"jennifer": true, "zxcvbnm": true, "asdfgh": true, "hunter": true, "buster": true, "soccer": true,
+	"harley": true, "batman": true, "andrew": true, "tigger": true, "sunshine": true,
+	"iloveyou": true, "2000": true, "charlie": true, "robert": true, "thomas": true, "hockey": true,
+	"ranger": true, "daniel": true, "starwars": true, "klaster": true, "112233": true, "george": true,
+	"computer": true, "michelle": true, "jessica": true, "pepper": true, "1111": true, "zxcvbn": true,
+	"555555": true, "11111111": true, "131313": true, "freedom": true, "777777": true, "pass": true,
+	"maggie": true, "159753": true, "aaaaaa": true, "ginger": true, "princess": true, "joshua": true,
+	"cheese": true, "amanda": true, "summer": true, "love": true, "ashley": true, "nicole": true,
+	"chelsea": true, "biteme": true, "matthew": true, "access": true, "yankees": true,
+	"987654321": true, "dallas": true, "austin": true, "thunder": true, "taylor": true,
+	"matrix": true, "minecraft": true, "william": true, "corvette": true, "hello": true,
+	"martin": true, "heather": true, "secret": true, "merlin": true, "diamond": true,
+	"1234qwer": true, "gfhjkm": true, "hammer": true, "silver": true, "222222": true,
+	"88888888": true, "anthony": true, "justin": true, "test": true, "bailey": true,
+	"q1w2e3r4t5": true, "patrick": true, "internet": true, "scooter": true, "orange": true,
+	"11111": true, "golfer": true, "cookie": true, "richard": true, "samantha": true, "bigdog": true,
+	"guitar": true, "jackson": true, "whatever": true, "mickey": true, "chicken": true,
+	"sparky": true, "snoopy": true, "maverick": true, "phoenix": true, "camaro": true, "peanut": true,
+	"morgan": true, "welcome": true, "falcon": true, "cowboy": true, "ferrari": true, "samsung": true,
+	"andrea": true, "smokey": true, "steelers": true, "joseph": true, "mercedes": true,
+	"dakota": true, "arsenal": true, "eagles": true, "melissa": true, "boomer": true, "booboo": true,
+	"spider": true, "nascar": true, "monster": true, "tigers": true, "yellow": true, "xxxxxx": true,
+	"123123123": true, "gateway": true, "marina": true, "diablo": true, "bulldog": true,
+	"qwer1234": true, "compaq": true, "purple": true, "banana": true,
+	"junior": true, "hannah": true, "123654": true, "porsche": true, "lakers": true, "iceman": true,
+	"money": true, "cowboys": true, "987654": true, "london": true, "tennis": true, "999999": true,
+	"ncc1701": true, "coffee": true, "scooby": true, "0000": true, "miller": true, "boston": true,
+	"q1w2e3r4": true, "brandon": true, "yamaha": true, "chester": true, "mother": true,
+	"forever": true, "johnny": true, "edward": true, "333333": true, "oliver": true, "redsox": true,
+	"player": true, "nikita": true, "knight": true, "fender": true, "barney": true, "midnight": true,
+	"please": true, "brandy": true, "chicago": true, "badboy": true, "slayer": true, "rangers": true,
+	"charles": true, "angel": true, "flower": true, "bigdaddy": true, "rabbit": true, "wizard": true,
+	"jasper": true, "enter": true, "rachel": true, "chris": true, "steven": true,
+	"winner": true, "adidas": true, "victoria": true, "natasha": true, "1q2w3e4r": true,
+	"jasmine": true, "winter": true, "prince": true, "marine": true, "ghbdtn": true,
+	"fishing": true, "cocacola": true, "casper": true, "james": true, "232323": true, "raiders": true,
+	"888888": true, "marlboro": true, "gandalf": true, "asdfasdf": true, "crystal": true,
+	"87654321": true, "12344321": true, "golden": true, "8675309": true, "hallo": true, "admin": true,
+	"administrator": true, "root": true, "toor": true, "changeme": true, "passw0rd": true,
+	"password1": true, "password123": true, "qwerty123": true, "letmein1": true, "welcome1": true,
+	"abc12345": true, "iloveyou1": true, "admin123": true, "000000000": true, "1q2w3e": true,
+	"123abc": true,
+}
@@ -0,0 +1,123 @@
+package validators
+
+import (
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/arangolite/filters"
+
+	"github.com/solher/snakepit-seed/errs"
+)
+
+var (
+	equalityOperators   = []string{"eq", "neq", "in", "nin"}
+	comparisonOperators = append([]string{"gt", "gte", "lt", "lte"}, equalityOperators...)
+	textOperators       = append([]string{"like", "nlike"}, comparisonOperators...)
+)
+
+// FilterPolicy declares the fields a role can filter on, with the allowed operators,
+// the fields it can sort on, the fields it can select and the options it can set. Any other
+// field is rejected, so that private fields like the password hash cannot be probed through
+// filtering, ordering or projections.
+type FilterPolicy struct {
+	Fields      map[string][]string
+	Sortable    map[string]bool
+	Projectable map[string]bool
+	Options     map[string]bool
+}
+
+func (p *FilterPolicy) validate(f *filters.Filter) (*filters.Filter, error) {
+	if f == nil {
+		return f, nil
+	}
+
+	for _, cond := range f.Where {
+		if err := p.condition(cond); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, clause := range f.Sort {
+		fields := strings.Fields(clause)
+		if len(fields) == 0 || !p.Sortable[fields[0]] {
+			return nil, merry.Here(errs.InvalidFilter).WithMessagef("cannot sort on %q", clause)
+		}
+	}
+
+	for _, option := range f.Options {
+		if !p.Options[option] {
+			return nil, merry.Here(errs.InvalidFilter).WithMessagef("cannot use the %q option", option)
+		}
+	}
+
+	return f, nil
+}
+
+// projection checks the fields selected by the fields query parameter.
+func (p *FilterPolicy) projection(fields []string) ([]string, error) {
+	for _, field := range fields {
+		if !p.Projectable[field] {
+			return nil, merry.Here(errs.InvalidFilter).WithMessagef("cannot select %q", field)
+		}
+	}
+
+	return fields, nil
+}
+
+func (p *FilterPolicy) condition(cond map[string]interface{}) error {
+	for field, value := range cond {
+		switch field {
+		case "and", "or":
+			conds, ok := value.([]interface{})
+			if !ok {
+				return merry.Here(errs.InvalidFilter).WithMessagef("%q expects a list of conditions", field)
+			}
+
+			for _, c := range conds {
+				sub, ok := c.(map[string]interface{})
+				if !ok {
+					return merry.Here(errs.InvalidFilter).WithMessagef("%q expects a list of conditions", field)
+				}
+				if err := p.condition(sub); err != nil {
+					return err
+				}
+			}
+		case "not":
+			sub, ok := value.(map[string]interface{})
+			if !ok {
+				return merry.Here(errs.InvalidFilter).WithMessagef("%q expects a condition", field)
+			}
+			if err := p.condition(sub); err != nil {
+				return err
+			}
+		default:
+			operators, ok := p.Fields[field]
+			if !ok {
+				return merry.Here(errs.InvalidFilter).WithMessagef("cannot filter on %q", field)
+			}
+
+			ops, ok := value.(map[string]interface{})
+			if !ok {
+				ops = map[string]interface{}{"eq": value}
+			}
+
+			for op := range ops {
+				if !contains(operators, op) {
+					return merry.Here(errs.InvalidFilter).WithMessagef("cannot use the %q operator on %q", op, field)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,115 @@
+package validators
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/ansel1/merry"
+	"github.com/solher/snakepit"
+	"github.com/spf13/viper"
+
+	"github.com/solher/snakepit-seed/constants"
+	"github.com/solher/snakepit-seed/errs"
+)
+
+// bcrypt ignores everything after the 72nd byte.
+const bcryptMaxLength = 72
+
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	RejectCommon  bool
+	RejectEmail   bool
+}
+
+func NewPasswordPolicy(c *viper.Viper) *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:     c.GetInt(constants.PasswordMinLength),
+		MaxLength:     c.GetInt(constants.PasswordMaxLength),
+		RequireUpper:  c.GetBool(constants.PasswordRequireUpper),
+		RequireLower:  c.GetBool(constants.PasswordRequireLower),
+		RequireDigit:  c.GetBool(constants.PasswordRequireDigit),
+		RequireSymbol: c.GetBool(constants.PasswordRequireSymbol),
+		RejectCommon:  c.GetBool(constants.PasswordRejectCommon),
+		RejectEmail:   c.GetBool(constants.PasswordRejectEmail),
+	}
+}
+
+// Validate returns a validation error on the password field for the first rule the password breaks.
+// The email check is skipped when the email is empty.
+func (p *PasswordPolicy) Validate(password, email string) error {
+	if len(password) == 0 {
+		return merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidBlank))
+	}
+
+	if len([]rune(password)) < p.MinLength {
+		return merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidTooShort))
+	}
+
+	max := p.MaxLength
+	if max <= 0 || max > bcryptMaxLength {
+		max = bcryptMaxLength
+	}
+
+	if len(password) > max {
+		return merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidTooLong))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	if p.RequireUpper && !upper {
+		return merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidMissingUpper))
+	}
+
+	if p.RequireLower && !lower {
+		return merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidMissingLower))
+	}
+
+	if p.RequireDigit && !digit {
+		return merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidMissingDigit))
+	}
+
+	if p.RequireSymbol && !symbol {
+		return merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidMissingSymbol))
+	}
+
+	if p.RejectCommon && commonPasswords[strings.ToLower(password)] {
+		return merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidCommon))
+	}
+
+	if p.RejectEmail && len(email) != 0 && containsEmail(password, email) {
+		return merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidContainsEmail))
+	}
+
+	return nil
+}
+
+// containsEmail checks the password against the whole email and its local part.
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(email)
+
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	local := strings.SplitN(email, "@", 2)[0]
+
+	return len(local) >= 3 && strings.Contains(password, local)
+}
@@ -0,0 +1,69 @@
+package validators_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/solher/snakepit"
+
+	"github.com/solher/snakepit-seed/errs"
+	"github.com/solher/snakepit-seed/validators"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	strict := &validators.PasswordPolicy{
+		MinLength:     8,
+		MaxLength:     128,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		RejectCommon:  true,
+		RejectEmail:   true,
+	}
+
+	// The common passwords do not have all the character classes.
+	lenient := &validators.PasswordPolicy{MinLength: 8, RejectCommon: true, RejectEmail: true}
+
+	cases := []struct {
+		name     string
+		policy   *validators.PasswordPolicy
+		password string
+		email    string
+		valid    string
+	}{
+		{"valid", strict, "Correct-Horse-7", "john.doe@localhost", ""},
+		{"blank", strict, "", "", errs.ValidBlank},
+		{"too short", strict, "Ab1!", "", errs.ValidTooShort},
+		{"too short in characters", strict, "Ééé1!", "", errs.ValidTooShort},
+		{"at the bcrypt limit", strict, strings.Repeat("Ab1!", 18), "", ""},
+		{"above the bcrypt limit", strict, strings.Repeat("Ab1!", 19), "", errs.ValidTooLong},
+		{"above the bcrypt limit in bytes", strict, strings.Repeat("Aé1!", 15), "", errs.ValidTooLong},
+		{"above the max length", &validators.PasswordPolicy{MaxLength: 10}, "Correct-Horse-7", "", errs.ValidTooLong},
+		{"missing uppercase", strict, "correct-horse-7", "", errs.ValidMissingUpper},
+		{"missing lowercase", strict, "CORRECT-HORSE-7", "", errs.ValidMissingLower},
+		{"missing digit", strict, "Correct-Horse-", "", errs.ValidMissingDigit},
+		{"missing symbol", strict, "CorrectHorse7", "", errs.ValidMissingSymbol},
+		{"common", lenient, "password123", "", errs.ValidCommon},
+		{"common in uppercase", lenient, "PASSWORD123", "", errs.ValidCommon},
+		{"common allowed", &validators.PasswordPolicy{MinLength: 8}, "password123", "", ""},
+		{"contains email", lenient, "my-JOHN.DOE@localhost-7", "john.doe@localhost", errs.ValidContainsEmail},
+		{"contains email local part", lenient, "John.Doe-Horse-7", "john.doe@localhost", errs.ValidContainsEmail},
+		{"short local part", lenient, "Jo-Correct-Horse-7", "jo@localhost", ""},
+		{"no email", lenient, "John.Doe-Horse-7", "", ""},
+	}
+
+	for _, c := range cases {
+		err := c.policy.Validate(c.password, c.email)
+
+		switch {
+		case c.valid == "" && err != nil:
+			t.Errorf("%s: expected the password to be valid, got %v.", c.name, err)
+		case c.valid == "":
+		case err == nil:
+			t.Errorf("%s: expected the %s error, got none.", c.name, c.valid)
+		case err.Error() != snakepit.NewValidationError(errs.FieldPassword, c.valid).Error():
+			t.Errorf("%s: expected the %s error, got %v.", c.name, c.valid, err)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/solher/snakepit"
 	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
 )
 
 type (
@@ -20,6 +21,9 @@ func NewSessions(l *logrus.Entry) *Sessions {
 
 func (v *Sessions) Output(sessions []models.Session) []models.Session {
 	for i := range sessions {
+		if len(sessions[i].Token) != 0 {
+			sessions[i].ID = utils.HashToken(sessions[i].Token)
+		}
 		sessions[i].Policies = nil
 		sessions[i].Payload = ""
 		sessions[i].OwnerToken = ""
@@ -27,3 +31,15 @@ func (v *Sessions) Output(sessions []models.Session) []models.Session {
 
 	return sessions
 }
+
+// ListOutput also redacts the tokens, the sessions being then only identified by their ID.
+func (v *Sessions) ListOutput(sessions []models.Session, currentToken string) []models.Session {
+	sessions = v.Output(sessions)
+
+	for i := range sessions {
+		sessions[i].Current = len(currentToken) != 0 && sessions[i].ID == utils.HashToken(currentToken)
+		sessions[i].Token = ""
+	}
+
+	return sessions
+}
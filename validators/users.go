@@ -1,6 +1,8 @@
 package validators
 
 import (
+	"encoding/json"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/ansel1/merry"
 	"github.com/solher/snakepit"
@@ -8,17 +10,33 @@ import (
 	"github.com/solher/snakepit-seed/constants"
 	"github.com/solher/snakepit-seed/errs"
 	"github.com/solher/snakepit-seed/models"
+	"github.com/solher/snakepit-seed/utils"
 )
 
+// patchableFields lists the user fields a merge patch is allowed to modify.
+var patchableFields = map[string]bool{
+	"firstName":          true,
+	"lastName":           true,
+	"email":              true,
+	"role":               true,
+	"emailVerified":      true,
+	"emailVerifiedAt":    true,
+	"mustChangePassword": true,
+}
+
 type (
 	users struct {
 		snakepit.Validator
+		Users  UsersFinder
+		Policy *PasswordPolicy
 	}
 )
 
-func newUsers(l *logrus.Entry) *users {
+func newUsers(l *logrus.Entry, u UsersFinder, p *PasswordPolicy) *users {
 	return &users{
 		Validator: *snakepit.NewValidator(l),
+		Users:     u,
+		Policy:    p,
 	}
 }
 
@@ -27,25 +45,36 @@ func (v *users) signup(user *models.User) (*models.User, error) {
 		return nil, merry.Here(snakepit.NewValidationError(errs.FieldEmail, errs.ValidBlank))
 	}
 
-	if len(user.Password) == 0 {
-		return nil, merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidBlank))
+	if err := v.Policy.Validate(user.Password, user.Email); err != nil {
+		return nil, err
+	}
+
+	if err := v.emailUniqueness(user.Email, ""); err != nil {
+		return nil, err
 	}
 
 	user.Key = ""
 	user.OwnerToken = ""
 	user.Role = ""
+	user.EmailVerified = false
+	user.EmailVerifiedAt = nil
+	user.MustChangePassword = false
+	v.twoFactorProtection(user)
+	v.deletionProtection(user)
 
 	return user, nil
 }
 
 func (v *users) create(users []models.User) ([]models.User, error) {
+	emails := map[string]bool{}
+
 	for i := range users {
 		if len(users[i].Email) == 0 {
 			return nil, merry.Here(snakepit.NewValidationError(errs.FieldEmail, errs.ValidBlank))
 		}
 
-		if len(users[i].Password) == 0 {
-			return nil, merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidBlank))
+		if err := v.Policy.Validate(users[i].Password, users[i].Email); err != nil {
+			return nil, err
 		}
 
 		if len(users[i].Role) == 0 {
@@ -55,6 +84,18 @@ func (v *users) create(users []models.User) ([]models.User, error) {
 		if err := v.roleExistence(users[i].Role); err != nil {
 			return nil, err
 		}
+
+		if emails[users[i].Email] {
+			return nil, merry.Here(snakepit.NewValidationError(errs.FieldEmail, errs.ValidTaken))
+		}
+		emails[users[i].Email] = true
+
+		if err := v.emailUniqueness(users[i].Email, ""); err != nil {
+			return nil, err
+		}
+
+		v.twoFactorProtection(&users[i])
+		v.deletionProtection(&users[i])
 	}
 
 	return users, nil
@@ -72,34 +113,173 @@ func (v *users) signin(cred *models.Credentials) (*models.Credentials, error) {
 	return cred, nil
 }
 
-func (v *users) update(user *models.User) (*models.User, error) {
+// update validates the user fields replacing the ones of the user with the given key,
+// or of the users matched by a filter when the key is empty.
+func (v *users) update(key string, user *models.User) (*models.User, error) {
 	if err := v.roleExistence(user.Role); err != nil {
 		return nil, err
 	}
 
+	if err := v.emailUniqueness(user.Email, key); err != nil {
+		return nil, err
+	}
+
+	user.ID = ""
 	user.Key = ""
+	user.Rev = ""
 	user.Password = ""
 	user.OwnerToken = ""
+	v.twoFactorProtection(user)
+	v.deletionProtection(user)
 
 	return user, nil
 }
 
-func (v *users) updatePassword(pwd *models.Password) (*models.Password, error) {
-	if len(pwd.Password) == 0 {
-		return nil, merry.Here(snakepit.NewValidationError(errs.FieldPassword, errs.ValidBlank))
+func (v *users) replace(key string, user *models.User) (*models.User, error) {
+	if len(user.Email) == 0 {
+		return nil, merry.Here(snakepit.NewValidationError(errs.FieldEmail, errs.ValidBlank))
+	}
+
+	return v.update(key, user)
+}
+
+// patch validates a RFC 7396 merge patch. The fields which cannot be patched are dropped
+// and the types of the given values are checked against the user model.
+func (v *users) patch(key string, patch map[string]interface{}) (map[string]interface{}, error) {
+	for field := range patch {
+		if !patchableFields[field] {
+			delete(patch, field)
+		}
+	}
+
+	if email, ok := patch["email"]; ok {
+		s, _ := email.(string)
+		if len(s) == 0 {
+			return nil, merry.Here(snakepit.NewValidationError(errs.FieldEmail, errs.ValidBlank))
+		}
+
+		if err := v.emailUniqueness(s, key); err != nil {
+			return nil, err
+		}
+	}
+
+	if role, ok := patch["role"]; ok {
+		s, _ := role.(string)
+		if len(s) == 0 {
+			return nil, merry.Here(snakepit.NewValidationError(errs.FieldRole, errs.ValidBlank))
+		}
+
+		if err := v.roleExistence(models.Role(s)); err != nil {
+			return nil, err
+		}
+	}
+
+	values := map[string]interface{}{}
+	for field, value := range patch {
+		if value != nil {
+			values[field] = value
+		}
+	}
+
+	m, _ := json.Marshal(values)
+	if err := json.Unmarshal(m, &models.User{}); err != nil {
+		return nil, merry.Here(snakepit.NewValidationError(errs.FieldBody, errs.ValidInvalid))
+	}
+
+	return patch, nil
+}
+
+func (v *users) search(query string) (string, error) {
+	if len(utils.SearchWords(query)) == 0 {
+		return "", merry.Here(snakepit.NewValidationError(errs.FieldQuery, errs.ValidBlank))
+	}
+
+	return query, nil
+}
+
+func (v *users) updatePassword(pwd *models.Password, email string) (*models.Password, error) {
+	if err := v.Policy.Validate(pwd.Password, email); err != nil {
+		return nil, err
 	}
 
 	return pwd, nil
 }
 
+func (v *users) forgotPassword(forgot *models.PasswordForgot) (*models.PasswordForgot, error) {
+	if len(forgot.Email) == 0 {
+		return nil, merry.Here(snakepit.NewValidationError(errs.FieldEmail, errs.ValidBlank))
+	}
+
+	return forgot, nil
+}
+
+func (v *users) resetPassword(reset *models.PasswordReset, email string) (*models.PasswordReset, error) {
+	if len(reset.Token) == 0 {
+		return nil, merry.Here(snakepit.NewValidationError(errs.FieldToken, errs.ValidBlank))
+	}
+
+	if err := v.Policy.Validate(reset.Password, email); err != nil {
+		return nil, err
+	}
+
+	return reset, nil
+}
+
+func (v *users) verify(verification *models.Verification) (*models.Verification, error) {
+	if len(verification.Token) == 0 {
+		return nil, merry.Here(snakepit.NewValidationError(errs.FieldToken, errs.ValidBlank))
+	}
+
+	return verification, nil
+}
+
+func (v *users) twoFactorCode(code *models.TwoFactorCode) (*models.TwoFactorCode, error) {
+	if len(code.Code) == 0 {
+		return nil, merry.Here(snakepit.NewValidationError(errs.FieldCode, errs.ValidBlank))
+	}
+
+	return code, nil
+}
+
+func (v *users) twoFactorSignin(signin *models.TwoFactorSignin) (*models.TwoFactorSignin, error) {
+	if len(signin.Challenge) == 0 {
+		return nil, merry.Here(snakepit.NewValidationError(errs.FieldChallenge, errs.ValidBlank))
+	}
+
+	if len(signin.Code) == 0 {
+		return nil, merry.Here(snakepit.NewValidationError(errs.FieldCode, errs.ValidBlank))
+	}
+
+	return signin, nil
+}
+
 func (v *users) output(users []models.User) []models.User {
 	for i := range users {
 		users[i].Password = ""
+		users[i].TwoFactorSecret = ""
+		users[i].TwoFactorPendingSecret = ""
+		users[i].TwoFactorLastCounter = 0
+		users[i].RecoveryCodes = nil
 	}
 
 	return users
 }
 
+// twoFactorProtection clears the two-factor fields, only managed through the dedicated endpoints.
+func (v *users) twoFactorProtection(user *models.User) {
+	user.TwoFactorEnabled = false
+	user.TwoFactorSecret = ""
+	user.TwoFactorPendingSecret = ""
+	user.TwoFactorLastCounter = 0
+	user.RecoveryCodes = nil
+}
+
+// deletionProtection clears the deletion fields, only managed through the delete and restore endpoints.
+func (v *users) deletionProtection(user *models.User) {
+	user.DeletedAt = nil
+	user.DeletedBy = ""
+}
+
 func (v *users) roleExistence(role models.Role) error {
 	if len(role) == 0 {
 		return nil
@@ -114,20 +294,21 @@ func (v *users) roleExistence(role models.Role) error {
 	return merry.Here(snakepit.NewValidationError(errs.FieldRole, errs.ValidInvalid))
 }
 
-// func (v *users) ValidateEmailUniqueness(user *models.User) error {
-// 	if user.Email == nil {
-// 		return nil
-// 	}
-
-// 	err := v.r.View(func(tx *bolt.Tx) error {
-// 		raw := tx.Bucket([]byte("users")).Get([]byte(*user.Email))
-
-// 		if len(raw) != 0 {
-// 			return errs.NewErrValidation("email must be unique")
-// 		}
-
-// 		return nil
-// 	})
+// emailUniqueness checks that no other user than the one with the given key has the email.
+func (v *users) emailUniqueness(email, key string) error {
+	if len(email) == 0 {
+		return nil
+	}
 
-// 	return err
-// }
+	user, err := v.Users.FindByEmail(email)
+	switch {
+	case err == nil && len(key) > 0 && user.Key == key:
+		return nil
+	case err == nil:
+		return merry.Here(snakepit.NewValidationError(errs.FieldEmail, errs.ValidTaken))
+	case merry.Is(err, errs.NotFound):
+		return nil
+	default:
+		return err
+	}
+}
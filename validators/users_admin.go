@@ -4,22 +4,79 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/solher/arangolite/filters"
 
+	"github.com/solher/snakepit-seed/constants"
 	"github.com/solher/snakepit-seed/models"
 )
 
+var usersAdminFilters = &FilterPolicy{
+	Fields: map[string][]string{
+		"_key":             equalityOperators,
+		"email":            textOperators,
+		"firstName":        textOperators,
+		"lastName":         textOperators,
+		"role":             equalityOperators,
+		"emailVerified":    equalityOperators,
+		"emailVerifiedAt":  comparisonOperators,
+		"twoFactorEnabled": equalityOperators,
+		"deletedAt":        comparisonOperators,
+		"deletedBy":        equalityOperators,
+	},
+	Sortable: map[string]bool{
+		"_key":            true,
+		"email":           true,
+		"firstName":       true,
+		"lastName":        true,
+		"role":            true,
+		"emailVerifiedAt": true,
+		"deletedAt":       true,
+	},
+	Projectable: map[string]bool{
+		"_key":               true,
+		"_rev":               true,
+		"email":              true,
+		"firstName":          true,
+		"lastName":           true,
+		"role":               true,
+		"emailVerified":      true,
+		"emailVerifiedAt":    true,
+		"mustChangePassword": true,
+		"twoFactorEnabled":   true,
+		"deletedAt":          true,
+		"deletedBy":          true,
+	},
+	Options: map[string]bool{
+		constants.OptionIncludeDeleted: true,
+	},
+}
+
 type (
 	UsersAdmin struct {
 		users
 	}
 )
 
-func NewUsersAdmin(l *logrus.Entry) *UsersAdmin {
+func NewUsersAdmin(l *logrus.Entry, u UsersFinder, p *PasswordPolicy) *UsersAdmin {
 	return &UsersAdmin{
-		users: *newUsers(l),
+		users: *newUsers(l, u, p),
 	}
 }
 
+func (v *UsersAdmin) Filter(f *filters.Filter) (*filters.Filter, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return usersAdminFilters.validate(f)
+}
+
+func (v *UsersAdmin) Fields(fields []string) ([]string, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return usersAdminFilters.projection(fields)
+}
+
 func (v *UsersAdmin) Signup(user *models.User) (*models.User, error) {
 	start := time.Now()
 	defer v.LogTime(start)
@@ -45,14 +102,70 @@ func (v *UsersAdmin) Update(user *models.User) (*models.User, error) {
 	start := time.Now()
 	defer v.LogTime(start)
 
-	return v.update(user)
+	return v.update("", user)
+}
+
+func (v *UsersAdmin) Replace(key string, user *models.User) (*models.User, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.replace(key, user)
+}
+
+func (v *UsersAdmin) Patch(key string, patch map[string]interface{}) (map[string]interface{}, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.patch(key, patch)
+}
+
+func (v *UsersAdmin) Search(query string) (string, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.search(query)
+}
+
+func (v *UsersAdmin) UpdatePassword(pwd *models.Password, email string) (*models.Password, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.updatePassword(pwd, email)
+}
+
+func (v *UsersAdmin) ForgotPassword(forgot *models.PasswordForgot) (*models.PasswordForgot, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.forgotPassword(forgot)
+}
+
+func (v *UsersAdmin) ResetPassword(reset *models.PasswordReset, email string) (*models.PasswordReset, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.resetPassword(reset, email)
+}
+
+func (v *UsersAdmin) Verify(verification *models.Verification) (*models.Verification, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.verify(verification)
+}
+
+func (v *UsersAdmin) TwoFactorCode(code *models.TwoFactorCode) (*models.TwoFactorCode, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.twoFactorCode(code)
 }
 
-func (v *UsersAdmin) UpdatePassword(pwd *models.Password) (*models.Password, error) {
+func (v *UsersAdmin) TwoFactorSignin(signin *models.TwoFactorSignin) (*models.TwoFactorSignin, error) {
 	start := time.Now()
 	defer v.LogTime(start)
 
-	return v.updatePassword(pwd)
+	return v.twoFactorSignin(signin)
 }
 
 func (v *UsersAdmin) Output(users []models.User) []models.User {
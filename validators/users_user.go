@@ -4,22 +4,63 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/solher/arangolite/filters"
 
 	"github.com/solher/snakepit-seed/models"
 )
 
+var usersUserFilters = &FilterPolicy{
+	Fields: map[string][]string{
+		"_key":      equalityOperators,
+		"email":     equalityOperators,
+		"firstName": equalityOperators,
+		"lastName":  equalityOperators,
+	},
+	Sortable: map[string]bool{
+		"_key":      true,
+		"email":     true,
+		"firstName": true,
+		"lastName":  true,
+	},
+	Projectable: map[string]bool{
+		"_key":             true,
+		"_rev":             true,
+		"email":            true,
+		"firstName":        true,
+		"lastName":         true,
+		"role":             true,
+		"emailVerified":    true,
+		"emailVerifiedAt":  true,
+		"twoFactorEnabled": true,
+	},
+}
+
 type (
 	UsersUser struct {
 		users
 	}
 )
 
-func NewUsersUser(l *logrus.Entry) *UsersUser {
+func NewUsersUser(l *logrus.Entry, u UsersFinder, p *PasswordPolicy) *UsersUser {
 	return &UsersUser{
-		users: *newUsers(l),
+		users: *newUsers(l, u, p),
 	}
 }
 
+func (v *UsersUser) Filter(f *filters.Filter) (*filters.Filter, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return usersUserFilters.validate(f)
+}
+
+func (v *UsersUser) Fields(fields []string) ([]string, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return usersUserFilters.projection(fields)
+}
+
 func (v *UsersUser) Signup(user *models.User) (*models.User, error) {
 	start := time.Now()
 	defer v.LogTime(start)
@@ -47,15 +88,84 @@ func (v *UsersUser) Update(user *models.User) (*models.User, error) {
 	defer v.LogTime(start)
 
 	user.Role = ""
+	user.EmailVerified = false
+	user.EmailVerifiedAt = nil
+	user.MustChangePassword = false
+
+	return v.update("", user)
+}
+
+func (v *UsersUser) Replace(key string, user *models.User) (*models.User, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	user.Role = ""
+	user.EmailVerified = false
+	user.EmailVerifiedAt = nil
+	user.MustChangePassword = false
+
+	return v.replace(key, user)
+}
+
+func (v *UsersUser) Patch(key string, patch map[string]interface{}) (map[string]interface{}, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	delete(patch, "role")
+	delete(patch, "emailVerified")
+	delete(patch, "emailVerifiedAt")
+	delete(patch, "mustChangePassword")
+
+	return v.patch(key, patch)
+}
+
+func (v *UsersUser) Search(query string) (string, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.search(query)
+}
+
+func (v *UsersUser) UpdatePassword(pwd *models.Password, email string) (*models.Password, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.updatePassword(pwd, email)
+}
+
+func (v *UsersUser) ForgotPassword(forgot *models.PasswordForgot) (*models.PasswordForgot, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.forgotPassword(forgot)
+}
+
+func (v *UsersUser) ResetPassword(reset *models.PasswordReset, email string) (*models.PasswordReset, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.resetPassword(reset, email)
+}
+
+func (v *UsersUser) Verify(verification *models.Verification) (*models.Verification, error) {
+	start := time.Now()
+	defer v.LogTime(start)
+
+	return v.verify(verification)
+}
+
+func (v *UsersUser) TwoFactorCode(code *models.TwoFactorCode) (*models.TwoFactorCode, error) {
+	start := time.Now()
+	defer v.LogTime(start)
 
-	return v.update(user)
+	return v.twoFactorCode(code)
 }
 
-func (v *UsersUser) UpdatePassword(pwd *models.Password) (*models.Password, error) {
+func (v *UsersUser) TwoFactorSignin(signin *models.TwoFactorSignin) (*models.TwoFactorSignin, error) {
 	start := time.Now()
 	defer v.LogTime(start)
 
-	return v.updatePassword(pwd)
+	return v.twoFactorSignin(signin)
 }
 
 func (v *UsersUser) Output(users []models.User) []models.User {
@@ -0,0 +1,76 @@
+package workers
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Periodic runs a task at a fixed interval on its own goroutine. The task is given
+// a logger tagged with the name of the worker.
+type Periodic struct {
+	logger   *logrus.Logger
+	name     string
+	interval time.Duration
+	task     func(l *logrus.Entry) error
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewPeriodic(
+	l *logrus.Logger,
+	name string,
+	interval time.Duration,
+	task func(l *logrus.Entry) error,
+) *Periodic {
+	return &Periodic{
+		logger:   l,
+		name:     name,
+		interval: interval,
+		task:     task,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the worker in a new goroutine.
+func (w *Periodic) Start() {
+	go w.run()
+}
+
+// Stop stops the started worker, waiting for the running tick to end.
+func (w *Periodic) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *Periodic) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.tick()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// tick never lets a panic escape as nothing can recover it on the worker goroutine.
+func (w *Periodic) tick() {
+	logger := w.logger.WithField("worker", w.name)
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.WithField("panic", r).Error("Worker panicked.")
+		}
+	}()
+
+	if err := w.task(logger); err != nil {
+		logger.WithField("error", err).Error("Worker failed.")
+	}
+}
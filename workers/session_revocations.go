@@ -0,0 +1,23 @@
+package workers
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+type PendingRetrier interface {
+	RetryPending() error
+}
+
+// NewSessionRevocations returns a worker periodically retrying the session revocations
+// the sessions backend failed to process.
+func NewSessionRevocations(
+	l *logrus.Logger,
+	interval time.Duration,
+	retrier func(l *logrus.Entry) PendingRetrier,
+) *Periodic {
+	return NewPeriodic(l, "sessionRevocations", interval, func(l *logrus.Entry) error {
+		return retrier(l).RetryPending()
+	})
+}
@@ -0,0 +1,26 @@
+package workers
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/solher/snakepit-seed/models"
+)
+
+type UsersPurger interface {
+	Purge(dryRun bool) ([]models.User, error)
+}
+
+// NewUsersPurge returns a worker periodically hard deleting the users soft deleted
+// for longer than the retention window.
+func NewUsersPurge(
+	l *logrus.Logger,
+	interval time.Duration,
+	purger func(l *logrus.Entry) UsersPurger,
+) *Periodic {
+	return NewPeriodic(l, "usersPurge", interval, func(l *logrus.Entry) error {
+		_, err := purger(l).Purge(false)
+		return err
+	})
+}